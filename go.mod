@@ -7,8 +7,6 @@ require (
 	github.com/dghubble/oauth1 v0.7.3
 	github.com/eclipse/paho.mqtt.golang v1.5.1
 	github.com/go-playground/validator/v10 v10.30.0
-	github.com/gregdel/pushover v1.4.0
-	github.com/lorenzobenvenuti/ifttt v0.0.0-20180127163702-fcf7387624e1
 	github.com/mailgun/mailgun-go/v4 v4.23.0
 	github.com/pusher/pusher-http-go v4.0.1+incompatible
 	github.com/sendgrid/sendgrid-go v3.16.1+incompatible
@@ -0,0 +1,341 @@
+// Package format converts a neutral rich message into the markup of a channel, and keeps
+// it within the length limit of the channel.
+//
+// The neutral markup is a small subset of Markdown:
+//
+//	**bold**, _italic_, `code` and [a link](https://example.com)
+//	- a list item
+//	1. an ordered list item
+//
+// Paragraphs are separated by a blank line, a backslash escapes the markup characters.
+package format
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Format is the markup a channel renders messages with
+type Format int
+
+const (
+	// Plain is text without markup, e.g. for SMS
+	Plain Format = iota
+	// SlackMrkdwn is the mrkdwn markup of Slack
+	SlackMrkdwn
+	// TelegramHTML is the HTML subset of Telegram, sent with parse mode HTML
+	TelegramHTML
+	// TelegramMarkdownV2 is the MarkdownV2 markup of Telegram, sent with parse mode MarkdownV2
+	TelegramMarkdownV2
+)
+
+// BlockKind is the kind of a block of a message
+type BlockKind int
+
+const (
+	// Paragraph is a paragraph of text, its lines are kept
+	Paragraph BlockKind = iota
+	// ListItem is an item of a list
+	ListItem
+)
+
+// Span is a run of text with the same style
+type Span struct {
+	Text   string
+	Bold   bool
+	Italic bool
+	Code   bool
+	// Url is the target of the link, if the span is a link
+	Url string
+}
+
+// Block is a paragraph or a list item
+type Block struct {
+	Kind BlockKind
+	// Number is the number of an ordered list item, zero for a bullet
+	Number int
+	Spans  []Span
+}
+
+// Document is a neutral rich message
+type Document struct {
+	Blocks []Block
+}
+
+// escapable are the characters a backslash escapes
+const escapable = "\\`*_{}[]()<>#+-.!|~"
+
+var (
+	bulletItem  = regexp.MustCompile(`^\s*[-*•]\s+(.*)$`)
+	orderedItem = regexp.MustCompile(`^\s*(\d+)[.)]\s+(.*)$`)
+	link        = regexp.MustCompile(`^\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// Parse parses a message written in the neutral markup
+func Parse(text string) Document {
+	doc := Document{}
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			doc.Blocks = append(doc.Blocks, Block{Kind: Paragraph, Spans: parseInline(strings.Join(paragraph, "\n"))})
+			paragraph = nil
+		}
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if match := orderedItem.FindStringSubmatch(line); match != nil {
+			flush()
+			number, _ := strconv.Atoi(match[1])
+			doc.Blocks = append(doc.Blocks, Block{Kind: ListItem, Number: number, Spans: parseInline(match[2])})
+			continue
+		}
+		if match := bulletItem.FindStringSubmatch(line); match != nil {
+			flush()
+			doc.Blocks = append(doc.Blocks, Block{Kind: ListItem, Spans: parseInline(match[1])})
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	flush()
+	return doc
+}
+
+// parseInline parses the bold, italic, code and link spans of a block
+func parseInline(text string) []Span {
+	var spans []Span
+	var current strings.Builder
+	bold, italic := false, false
+	emit := func() {
+		if current.Len() > 0 {
+			spans = append(spans, Span{Text: current.String(), Bold: bold, Italic: italic})
+			current.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.IndexByte(escapable, rest[1]) >= 0:
+			current.WriteByte(rest[1])
+			i += 2
+			continue
+		case strings.HasPrefix(rest, "**") && (bold || strings.Contains(rest[2:], "**")):
+			emit()
+			bold = !bold
+			i += 2
+			continue
+		case rest[0] == '_' && italic && closesItalic(text, i):
+			emit()
+			italic = false
+			i++
+			continue
+		case rest[0] == '_' && !italic && opensItalic(text, i):
+			emit()
+			italic = true
+			i++
+			continue
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end >= 0 {
+				emit()
+				spans = append(spans, Span{Text: rest[1 : end+1], Code: true})
+				i += end + 2
+				continue
+			}
+		case rest[0] == '[':
+			if match := link.FindStringSubmatch(rest); match != nil {
+				emit()
+				spans = append(spans, Span{Text: match[1], Url: match[2], Bold: bold, Italic: italic})
+				i += len(match[0])
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(rest)
+		current.WriteRune(r)
+		i += size
+	}
+	emit()
+	return spans
+}
+
+// opensItalic reports whether the underscore at i opens italic text: it starts a word,
+// and is closed further on. Underscores within words, e.g. front_door, are kept.
+func opensItalic(text string, i int) bool {
+	if i > 0 {
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		if !unicode.IsSpace(before) && !unicode.IsPunct(before) {
+			return false
+		}
+	}
+	after, _ := utf8.DecodeRuneInString(text[i+1:])
+	if after == utf8.RuneError || unicode.IsSpace(after) {
+		return false
+	}
+	for j := i + 1; j < len(text); j++ {
+		if text[j] == '_' && closesItalic(text, j) {
+			return true
+		}
+	}
+	return false
+}
+
+// closesItalic reports whether the underscore at i closes italic text, it ends a word
+func closesItalic(text string, i int) bool {
+	after, _ := utf8.DecodeRuneInString(text[i+1:])
+	return after == utf8.RuneError || unicode.IsSpace(after) || unicode.IsPunct(after)
+}
+
+// Render renders the document in the markup of the format
+func (d Document) Render(format Format) string {
+	var out strings.Builder
+	for i, block := range d.Blocks {
+		if i > 0 {
+			out.WriteString(separator(d.Blocks[i-1], block))
+		}
+		out.WriteString(renderBlock(block, format))
+	}
+	return out.String()
+}
+
+// Text returns the document as plain text
+func (d Document) Text() string {
+	return d.Render(Plain)
+}
+
+// Convert parses a message written in the neutral markup, and renders it in the markup of the format
+func Convert(text string, format Format) string {
+	return Parse(text).Render(format)
+}
+
+// separator returns the text between two blocks, the items of a list are on consecutive lines
+func separator(previous Block, next Block) string {
+	if previous.Kind == ListItem && next.Kind == ListItem && (previous.Number > 0) == (next.Number > 0) {
+		return "\n"
+	}
+	return "\n\n"
+}
+
+// renderBlock renders a block in the markup of the format
+func renderBlock(block Block, format Format) string {
+	var out strings.Builder
+	if block.Kind == ListItem {
+		switch {
+		case block.Number > 0 && format == TelegramMarkdownV2:
+			out.WriteString(strconv.Itoa(block.Number) + "\\. ")
+		case block.Number > 0:
+			out.WriteString(strconv.Itoa(block.Number) + ". ")
+		case format == Plain:
+			out.WriteString("- ")
+		default:
+			out.WriteString("• ")
+		}
+	}
+	for _, span := range block.Spans {
+		out.WriteString(renderSpan(span, format))
+	}
+	return out.String()
+}
+
+// renderSpan renders a span in the markup of the format
+func renderSpan(span Span, format Format) string {
+	switch format {
+	case SlackMrkdwn:
+		if span.Url != "" {
+			if span.Text == span.Url {
+				return "<" + slackUrl.Replace(span.Url) + ">"
+			}
+			return "<" + slackUrl.Replace(span.Url) + "|" + strings.ReplaceAll(escapeSlack(span.Text), "|", "¦") + ">"
+		}
+		if span.Code {
+			return wrap(escapeSlack(span.Text), "`", "`")
+		}
+		text := escapeSlack(span.Text)
+		if span.Italic {
+			text = wrap(text, "_", "_")
+		}
+		if span.Bold {
+			text = wrap(text, "*", "*")
+		}
+		return text
+
+	case TelegramHTML:
+		if span.Code {
+			return "<code>" + escapeHTML(span.Text) + "</code>"
+		}
+		text := escapeHTML(span.Text)
+		if span.Url != "" {
+			text = `<a href="` + escapeHTML(span.Url) + `">` + text + "</a>"
+		}
+		if span.Italic {
+			text = "<i>" + text + "</i>"
+		}
+		if span.Bold {
+			text = "<b>" + text + "</b>"
+		}
+		return text
+
+	case TelegramMarkdownV2:
+		if span.Code {
+			return "`" + markdownV2Code.Replace(span.Text) + "`"
+		}
+		text := markdownV2.Replace(span.Text)
+		if span.Url != "" {
+			text = "[" + text + "](" + markdownV2Url.Replace(span.Url) + ")"
+		}
+		if span.Italic {
+			text = wrap(text, "_", "_")
+		}
+		if span.Bold {
+			text = wrap(text, "*", "*")
+		}
+		return text
+
+	default:
+		if span.Url != "" && span.Text != span.Url {
+			return span.Text + " (" + span.Url + ")"
+		}
+		return span.Text
+	}
+}
+
+// wrap surrounds the text with the markers, leaving its surrounding whitespace outside,
+// as Slack and Telegram don't style "*bold *"
+func wrap(text string, open string, close string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + open + trimmed + close + text[start+len(trimmed):]
+}
+
+var (
+	slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	// slackUrl escapes the URL of a link, a | would end the URL and start the text of the link
+	slackUrl    = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "|", "%7C")
+	htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+	// markdownV2 escapes the characters which are reserved by MarkdownV2
+	markdownV2 = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "~", `\~`, "`", "\\`",
+		">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+	markdownV2Code = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+	markdownV2Url  = strings.NewReplacer(`\`, `\\`, ")", `\)`)
+)
+
+// escapeSlack escapes the control characters of Slack mrkdwn
+func escapeSlack(text string) string {
+	return slackEscaper.Replace(text)
+}
+
+// escapeHTML escapes the characters which are reserved by the HTML subset of Telegram
+func escapeHTML(text string) string {
+	return htmlEscaper.Replace(text)
+}
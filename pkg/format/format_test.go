@@ -0,0 +1,187 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	source := "**Motion** detected by front_door at [the garage](https://example.com/a_b?x=1&y=2)\n\n" +
+		"- `cam<1>`\n- 5 > 3 & more\n\n1. first.\n2. second!"
+	tests := []struct {
+		name     string
+		format   Format
+		expected string
+	}{
+		{
+			"Plain", Plain,
+			"Motion detected by front_door at the garage (https://example.com/a_b?x=1&y=2)\n\n" +
+				"- cam<1>\n- 5 > 3 & more\n\n1. first.\n2. second!",
+		},
+		{
+			"SlackMrkdwn", SlackMrkdwn,
+			"*Motion* detected by front_door at <https://example.com/a_b?x=1&amp;y=2|the garage>\n\n" +
+				"• `cam&lt;1&gt;`\n• 5 &gt; 3 &amp; more\n\n1. first.\n2. second!",
+		},
+		{
+			"TelegramHTML", TelegramHTML,
+			`<b>Motion</b> detected by front_door at <a href="https://example.com/a_b?x=1&amp;y=2">the garage</a>` + "\n\n" +
+				"• <code>cam&lt;1&gt;</code>\n• 5 &gt; 3 &amp; more\n\n1. first.\n2. second!",
+		},
+		{
+			"TelegramMarkdownV2", TelegramMarkdownV2,
+			`*Motion* detected by front\_door at [the garage](https://example.com/a_b?x=1&y=2)` + "\n\n" +
+				"• `cam<1>`\n• 5 \\> 3 & more\n\n1\\. first\\.\n2\\. second\\!",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if converted := Convert(source, test.format); converted != test.expected {
+				t.Errorf("expected\n%q\ngot\n%q", test.expected, converted)
+			}
+		})
+	}
+}
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		text     string
+		format   Format
+		expected string
+	}{
+		// An unclosed marker is kept as is
+		{"2 ** 3", Plain, "2 ** 3"},
+		{"_not italic", Plain, "_not italic"},
+		{"_italic_, and more", TelegramHTML, "<i>italic</i>, and more"},
+		{`\*\*literal\*\* C:\path`, Plain, `**literal** C:\path`},
+		{"**bold _and italic_**", TelegramHTML, "<b>bold </b><b><i>and italic</i></b>"},
+		{"**Motion **detected", SlackMrkdwn, "*Motion* detected"},
+		// The URL of a Slack link is escaped, so its query string can't end the link
+		{"[camera](https://example.com/watch?a=1&b=<2>|3)", SlackMrkdwn, "<https://example.com/watch?a=1&amp;b=&lt;2&gt;%7C3|camera>"},
+		{"[https://example.com/?a|b](https://example.com/?a|b)", SlackMrkdwn, "<https://example.com/?a%7Cb>"},
+	}
+	for _, test := range tests {
+		if converted := Convert(test.text, test.format); converted != test.expected {
+			t.Errorf("%q: expected %q got %q", test.text, test.expected, converted)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	paragraph := strings.Repeat("word ", 30)
+	doc := Parse("**" + strings.TrimSpace(paragraph) + "**\n\n- item one\n- item two")
+
+	parts := Split(doc, TelegramHTML, 60)
+	if len(parts) < 3 {
+		t.Fatalf("expected the document to be split got %q", parts)
+	}
+	for _, part := range parts {
+		if Length(part) > 60 {
+			t.Errorf("expected at most 60 characters got %d: %q", Length(part), part)
+		}
+		if strings.Count(part, "<b>") != strings.Count(part, "</b>") {
+			t.Errorf("expected balanced tags got %q", part)
+		}
+	}
+	if last := parts[len(parts)-1]; !strings.HasSuffix(last, "• item one\n• item two") {
+		t.Errorf("expected the list in the last part got %q", last)
+	}
+
+	// Text which fits is returned whole
+	if parts := Split(Parse("short"), Plain, 10); len(parts) != 1 || parts[0] != "short" {
+		t.Errorf("expected a single part got %q", parts)
+	}
+
+	// A word longer than the limit is cut
+	parts = Split(Parse(strings.Repeat("x", 25)), Plain, 10)
+	if len(parts) != 3 || parts[2] != "xxxxx" {
+		t.Errorf("expected the word to be cut in 3 parts got %q", parts)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	doc := Parse("Motion detected by **the front door camera** in the garden")
+	truncated := Truncate(doc, SlackMrkdwn, 30)
+	if Length(truncated) > 30 || !strings.HasSuffix(truncated, Ellipsis) {
+		t.Errorf("expected a truncated text got %q", truncated)
+	}
+	if truncated != "Motion detected by *the*…" {
+		t.Errorf("expected truncation between words got %q", truncated)
+	}
+	if Truncate(doc, Plain, 100) != doc.Text() {
+		t.Errorf("expected the text as is")
+	}
+
+	if truncated := TruncateText("Motion detected by camera", 20); truncated != "Motion detected by…" {
+		t.Errorf("expected truncation between words got %q", truncated)
+	}
+	if truncated := TruncateText("ééééé", 3); truncated != "éé…" {
+		t.Errorf("expected truncation by character got %q", truncated)
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	text := "the first paragraph of the message\n\nsecond paragraph"
+	parts := SplitText(text, 50)
+	if len(parts) != 2 || parts[0] != "the first paragraph of the message" {
+		t.Errorf("expected a split between paragraphs got %q", parts)
+	}
+
+	parts = SplitText(strings.Repeat("abc ", 10), 12)
+	for _, part := range parts {
+		if Length(part) > 12 || strings.HasPrefix(part, " ") {
+			t.Errorf("expected a split between words got %q", part)
+		}
+	}
+}
+
+func TestUTF16Length(t *testing.T) {
+	// An emoji outside the Basic Multilingual Plane counts as two UTF-16 code units
+	if n := UTF16Length("é 🎥"); n != 4 {
+		t.Errorf("expected 4 code units got %d", n)
+	}
+
+	emoji := strings.Repeat("🎥 ", 3000)
+	parts := SplitTextFunc(emoji, TelegramMaxLength, UTF16Length)
+	if len(parts) != 3 {
+		t.Errorf("expected 3 parts got %d", len(parts))
+	}
+	for _, part := range parts {
+		if UTF16Length(part) > TelegramMaxLength || strings.HasPrefix(part, " ") {
+			t.Errorf("expected a split between words of at most %d code units got %d", TelegramMaxLength, UTF16Length(part))
+		}
+	}
+	if truncated := TruncateTextFunc("🎥🎥🎥", 5, UTF16Length); truncated != "🎥🎥…" {
+		t.Errorf("expected truncation by code units got %q", truncated)
+	}
+	if parts := SplitTextFunc("🎥🎥", 1, UTF16Length); len(parts) != 2 {
+		t.Errorf("expected a character longer than the limit in its own part got %q", parts)
+	}
+}
+
+func TestChannel(t *testing.T) {
+	long := strings.Repeat("Motion detected. ", 200)
+	if parts := SMS.Render(long); len(parts) != 1 || Length(parts[0]) > SMSMaxLength {
+		t.Errorf("expected a truncated SMS")
+	}
+	parts := Telegram.Render(long + "\n\n" + long + "\n\n" + long)
+	if len(parts) < 2 {
+		t.Errorf("expected a split Telegram message")
+	}
+	for _, part := range parts {
+		if UTF16Length(part) > TelegramMaxLength {
+			t.Errorf("expected at most %d code units got %d", TelegramMaxLength, UTF16Length(part))
+		}
+	}
+
+	// Telegram counts emoji as two code units
+	parts = Telegram.Render(strings.Repeat("**Motion** 🎥 ", 800))
+	if len(parts) < 2 {
+		t.Errorf("expected a split Telegram message")
+	}
+	for _, part := range parts {
+		if UTF16Length(part) > TelegramMaxLength {
+			t.Errorf("expected at most %d code units got %d", TelegramMaxLength, UTF16Length(part))
+		}
+	}
+}
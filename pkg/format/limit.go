@@ -0,0 +1,323 @@
+package format
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The length limits of the channels, in characters, or in UTF-16 code units for Telegram
+const (
+	// SMSSegmentLength is the length of a single SMS, longer messages are sent in multiple segments
+	SMSSegmentLength = 160
+	// SMSMaxLength is the longest SMS which is accepted, e.g. by Twilio
+	SMSMaxLength = 1600
+	// TelegramMaxLength is the longest text of a Telegram message
+	TelegramMaxLength = 4096
+	// SlackBlockMaxLength is the longest text of a Slack section block
+	SlackBlockMaxLength = 3000
+	// SlackMaxBlocks is the maximum number of blocks of a Slack message
+	SlackMaxBlocks = 50
+	// PushoverMaxLength is the longest message of a Pushover notification
+	PushoverMaxLength = 1024
+	// PushoverTitleMaxLength is the longest title of a Pushover notification
+	PushoverTitleMaxLength = 250
+	// TwitterMaxLength is the longest tweet
+	TwitterMaxLength = 280
+)
+
+// Ellipsis is appended to a truncated message
+const Ellipsis = "…"
+
+// Channel describes the markup and the length limit of a channel
+type Channel struct {
+	Markup    Format
+	MaxLength int
+	// Length counts the length of a text as the channel does, defaults to Length
+	Length func(text string) int
+	// Split sends a message which is too long in multiple parts, instead of truncating it
+	Split bool
+}
+
+// The channels which have a length limit
+var (
+	SMS      = Channel{Markup: Plain, MaxLength: SMSMaxLength}
+	Telegram = Channel{Markup: TelegramHTML, MaxLength: TelegramMaxLength, Length: UTF16Length, Split: true}
+	Slack    = Channel{Markup: SlackMrkdwn, MaxLength: SlackBlockMaxLength, Split: true}
+	Pushover = Channel{Markup: Plain, MaxLength: PushoverMaxLength}
+	Twitter  = Channel{Markup: Plain, MaxLength: TwitterMaxLength}
+)
+
+// Render converts a message written in the neutral markup to the markup of the channel. A message
+// which is too long is split in parts when the channel supports it, or truncated otherwise.
+func (c Channel) Render(text string) []string {
+	doc := Parse(text)
+	length := c.Length
+	if length == nil {
+		length = Length
+	}
+	if c.Split {
+		return SplitFunc(doc, c.Markup, c.MaxLength, length)
+	}
+	return []string{TruncateFunc(doc, c.Markup, c.MaxLength, length)}
+}
+
+// Length returns the length of a text in characters
+func Length(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// UTF16Length returns the length of a text in UTF-16 code units, as counted by Telegram. A character
+// outside the Basic Multilingual Plane, e.g. most emoji, counts as two.
+func UTF16Length(text string) int {
+	n := 0
+	for _, r := range text {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// prefix returns the number of runes of the longest head of the runes which is at most max long
+func prefix(runes []rune, max int, length func(string) int) int {
+	low, high := 0, len(runes)
+	for low < high {
+		mid := (low + high + 1) / 2
+		if length(string(runes[:mid])) <= max {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return low
+}
+
+// Split renders the document in parts of at most max characters. The document is split between
+// paragraphs and list items, and a paragraph which is too long between words. Every part is valid
+// markup on its own, e.g. bold text is closed at the end of a part and opened again in the next.
+func Split(doc Document, format Format, max int) []string {
+	return SplitFunc(doc, format, max, Length)
+}
+
+// SplitFunc is Split with the length of the parts counted by the length function, e.g. UTF16Length
+func SplitFunc(doc Document, format Format, max int, length func(string) int) []string {
+	if rendered := doc.Render(format); length(rendered) <= max || max <= 0 {
+		return []string{rendered}
+	}
+
+	var parts []string
+	var current strings.Builder
+	var previous Block
+	for i, block := range doc.Blocks {
+		for j, piece := range splitBlock(block, format, max, length) {
+			sep := ""
+			if j > 0 {
+				sep = "\n"
+			} else if i > 0 {
+				sep = separator(previous, block)
+			}
+			if current.Len() > 0 && length(current.String())+length(sep)+length(piece) > max {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+			if current.Len() > 0 {
+				current.WriteString(sep)
+			}
+			current.WriteString(piece)
+		}
+		previous = block
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// Truncate renders the document in at most max characters. When the document is too long, it is cut
+// between paragraphs or words, and the Ellipsis is appended.
+func Truncate(doc Document, format Format, max int) string {
+	return TruncateFunc(doc, format, max, Length)
+}
+
+// TruncateFunc is Truncate with the length counted by the length function, e.g. UTF16Length
+func TruncateFunc(doc Document, format Format, max int, length func(string) int) string {
+	rendered := doc.Render(format)
+	if length(rendered) <= max || max <= 0 {
+		return rendered
+	}
+	if max <= length(Ellipsis) {
+		ellipsis := []rune(Ellipsis)
+		return string(ellipsis[:prefix(ellipsis, max, length)])
+	}
+	parts := SplitFunc(doc, format, max-length(Ellipsis), length)
+	return strings.TrimRightFunc(parts[0], unicode.IsSpace) + Ellipsis
+}
+
+// splitBlock renders a block in pieces of at most max characters, splitting its spans between words
+func splitBlock(block Block, format Format, max int, length func(string) int) []string {
+	rendered := renderBlock(block, format)
+	if length(rendered) <= max {
+		return []string{rendered}
+	}
+
+	var pieces []string
+	current := Block{Kind: block.Kind, Number: block.Number}
+	flush := func() {
+		if len(current.Spans) > 0 {
+			pieces = append(pieces, strings.TrimRightFunc(renderBlock(current, format), unicode.IsSpace))
+		}
+		// The next piece continues the text of the block, without bullet
+		current = Block{Kind: Paragraph}
+	}
+
+	for _, token := range tokens(block.Spans) {
+		candidate := appendSpan(current, token)
+		if length(renderBlock(candidate, format)) <= max {
+			current = candidate
+			continue
+		}
+		flush()
+		token.Text = strings.TrimLeftFunc(token.Text, unicode.IsSpace)
+		candidate = appendSpan(current, token)
+		for length(renderBlock(candidate, format)) > max {
+			// A single word is longer than the limit, it is cut
+			head, tail := cut(current, token, format, max, length)
+			if head.Text == "" {
+				break
+			}
+			current = appendSpan(current, head)
+			flush()
+			token = tail
+			candidate = appendSpan(current, token)
+		}
+		current = candidate
+	}
+	flush()
+	return pieces
+}
+
+// cut returns the longest head of the span which fits in the block, and its tail
+func cut(block Block, span Span, format Format, max int, length func(string) int) (Span, Span) {
+	runes := []rune(span.Text)
+	low, high := 0, len(runes)
+	for low < high {
+		mid := (low + high + 1) / 2
+		head := span
+		head.Text = string(runes[:mid])
+		if length(renderBlock(appendSpan(block, head), format)) <= max {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	head, tail := span, span
+	head.Text = string(runes[:low])
+	tail.Text = string(runes[low:])
+	// A link which is cut keeps its target only in its head
+	if span.Url != "" && low > 0 {
+		tail.Url = ""
+	}
+	return head, tail
+}
+
+// words matches a word with the whitespace following it
+var words = regexp.MustCompile(`\s*\S+\s*`)
+
+// tokens splits the spans into words, a link is kept as a single token
+func tokens(spans []Span) []Span {
+	var out []Span
+	for _, span := range spans {
+		if span.Url != "" || span.Code {
+			out = append(out, span)
+			continue
+		}
+		for _, word := range words.FindAllString(span.Text, -1) {
+			token := span
+			token.Text = word
+			out = append(out, token)
+		}
+	}
+	return out
+}
+
+// appendSpan returns a copy of the block with the span appended, merged with the last span when
+// both have the same style
+func appendSpan(block Block, span Span) Block {
+	spans := make([]Span, len(block.Spans), len(block.Spans)+1)
+	copy(spans, block.Spans)
+	if n := len(spans); n > 0 && span.Url == "" && !span.Code {
+		last := spans[n-1]
+		if last.Url == "" && !last.Code && last.Bold == span.Bold && last.Italic == span.Italic {
+			spans[n-1].Text += span.Text
+			block.Spans = spans
+			return block
+		}
+	}
+	block.Spans = append(spans, span)
+	return block
+}
+
+// boundaries are the boundaries a text is split at, from the most to the least preferred
+var boundaries = []string{"\n\n", "\n", " "}
+
+// SplitText splits a text which is already in the markup of a channel in parts of at most max
+// characters, between paragraphs, lines or words
+func SplitText(text string, max int) []string {
+	return SplitTextFunc(text, max, Length)
+}
+
+// SplitTextFunc is SplitText with the length of the parts counted by the length function, e.g. UTF16Length
+func SplitTextFunc(text string, max int, length func(string) int) []string {
+	if length(text) <= max || max <= 0 {
+		return []string{text}
+	}
+
+	var parts []string
+	for length(text) > max {
+		runes := []rune(text)
+		n := prefix(runes, max, length)
+		if n == 0 {
+			// A single character longer than the limit, e.g. an emoji of two UTF-16 code units
+			n = 1
+		}
+		head := string(runes[:n])
+		at := -1
+		for _, boundary := range boundaries {
+			// Don't split in the first half of a part, to avoid many small parts
+			if i := strings.LastIndex(head, boundary); i > len(head)/2 {
+				at = i
+				break
+			}
+		}
+		if at < 0 {
+			parts = append(parts, head)
+			text = string(runes[n:])
+			continue
+		}
+		parts = append(parts, strings.TrimRightFunc(head[:at], unicode.IsSpace))
+		text = strings.TrimLeftFunc(text[at:], unicode.IsSpace)
+	}
+	if text != "" {
+		parts = append(parts, text)
+	}
+	return parts
+}
+
+// TruncateText truncates a text to at most max characters, between words when possible,
+// and appends the Ellipsis when it is truncated
+func TruncateText(text string, max int) string {
+	return TruncateTextFunc(text, max, Length)
+}
+
+// TruncateTextFunc is TruncateText with the length counted by the length function, e.g. UTF16Length
+func TruncateTextFunc(text string, max int, length func(string) int) string {
+	if length(text) <= max || max <= 0 {
+		return text
+	}
+	if max <= length(Ellipsis) {
+		ellipsis := []rune(Ellipsis)
+		return string(ellipsis[:prefix(ellipsis, max, length)])
+	}
+	return strings.TrimRightFunc(SplitTextFunc(text, max-length(Ellipsis), length)[0], unicode.IsSpace) + Ellipsis
+}
@@ -2,31 +2,54 @@ package integrations
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/uug-ai/models/pkg/models"
 )
 
+// alexaEndpoint is the NotifyMyEcho API endpoint
+var alexaEndpoint = "https://api.notifymyecho.com/v1/NotifyMe"
+
 type Alexa struct {
-	AccessCode string `json:"accesscode,omitempty"`
+	AccessCode string `json:"accesscode,omitempty" validate:"required"`
+}
+
+func init() {
+	MustRegister(IntegrationAlexa, DecodeJSON[Alexa], validated[Alexa])
 }
 
-func (alexa Alexa) Send(message models.Message) bool {
+func (alexa Alexa) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationAlexa}
 
-	url := "https://api.notifymyecho.com/v1/NotifyMe"
 	notification := message.Body
 	values := map[string]string{"notification": notification, "accessCode": alexa.AccessCode}
-	jsonValue, _ := json.Marshal(values)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonValue))
+	jsonValue, err := json.Marshal(values)
+	if err != nil {
+		return result.done(start, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", alexaEndpoint, bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return result.done(start, err)
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		panic(err)
+		return result.done(start, err)
 	}
 	defer resp.Body.Close()
 
-	return true
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result.done(start, fmt.Errorf("alexa request failed with status: %s", resp.Status))
+	}
+
+	return result.done(start, nil)
 }
@@ -1 +1,63 @@
 package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestAlexaSend(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		expectError bool
+	}{
+		{name: "Success", status: http.StatusOK, expectError: false},
+		{name: "Unauthorized", status: http.StatusUnauthorized, expectError: true},
+		{name: "ServerError", status: http.StatusInternalServerError, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received map[string]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&received)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			endpoint := alexaEndpoint
+			alexaEndpoint = server.URL
+			defer func() { alexaEndpoint = endpoint }()
+
+			alexa := Alexa{AccessCode: "access-code"}
+			result, err := alexa.Send(context.Background(), models.Message{Body: "Motion detected"})
+			if tt.expectError && err == nil {
+				t.Errorf("expected error got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("expected no error got %v", err)
+			}
+			if result.StatusCode != tt.status {
+				t.Errorf("expected status code %d, got %d", tt.status, result.StatusCode)
+			}
+			if result.Delivered() == tt.expectError {
+				t.Errorf("expected delivered=%v, got %v", !tt.expectError, result.Delivered())
+			}
+			if tt.expectError {
+				var deliveryErr *DeliveryError
+				if !errors.As(err, &deliveryErr) || deliveryErr.StatusCode != tt.status {
+					t.Errorf("expected a DeliveryError with status %d, got %v", tt.status, err)
+				}
+			}
+			if received["notification"] != "Motion detected" || received["accessCode"] != "access-code" {
+				t.Errorf("unexpected payload %v", received)
+			}
+		})
+	}
+}
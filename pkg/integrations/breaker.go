@@ -0,0 +1,269 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// ErrCircuitOpen is returned when a message is not sent because the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets all messages through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails fast without sending messages
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe messages through
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerOptions holds the configuration for the CircuitBreaker
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures which opens the circuit
+	FailureThreshold int `json:"failure_threshold,omitempty" validate:"gte=1"`
+	// OpenTimeout is the time the circuit stays open before probing the integration again
+	OpenTimeout time.Duration `json:"open_timeout,omitempty" validate:"gt=0"`
+	// HalfOpenRequests is the number of probes let through while half-open, all of them must
+	// succeed to close the circuit again. A probe which neither succeeds nor counts as failure,
+	// e.g. because it was cancelled, is let through again.
+	HalfOpenRequests int `json:"half_open_requests,omitempty" validate:"gte=1"`
+	// IsFailure decides whether a delivery counts as failure, defaults to IsBreakerFailure
+	IsFailure func(result DeliveryResult, err error) bool `json:"-"`
+	// OnStateChange is called whenever the state of the circuit changes. It is called
+	// while the circuit breaker is locked, so it must not call the circuit breaker itself.
+	OnStateChange func(from CircuitState, to CircuitState) `json:"-"`
+}
+
+// CircuitBreakerOptionsBuilder provides a fluent interface for building circuit breaker options
+type CircuitBreakerOptionsBuilder struct {
+	options *CircuitBreakerOptions
+}
+
+// NewCircuitBreakerOptions creates a new circuit breaker options builder. By default the circuit
+// opens after 5 consecutive failures and is probed with a single message after 30s.
+func NewCircuitBreakerOptions() *CircuitBreakerOptionsBuilder {
+	return &CircuitBreakerOptionsBuilder{
+		options: &CircuitBreakerOptions{
+			FailureThreshold: 5,
+			OpenTimeout:      30 * time.Second,
+			HalfOpenRequests: 1,
+		},
+	}
+}
+
+// SetFailureThreshold sets the number of consecutive failures which opens the circuit
+func (b *CircuitBreakerOptionsBuilder) SetFailureThreshold(threshold int) *CircuitBreakerOptionsBuilder {
+	b.options.FailureThreshold = threshold
+	return b
+}
+
+// SetOpenTimeout sets the time the circuit stays open before probing the integration again
+func (b *CircuitBreakerOptionsBuilder) SetOpenTimeout(timeout time.Duration) *CircuitBreakerOptionsBuilder {
+	b.options.OpenTimeout = timeout
+	return b
+}
+
+// SetHalfOpenRequests sets the number of probes let through while half-open
+func (b *CircuitBreakerOptionsBuilder) SetHalfOpenRequests(requests int) *CircuitBreakerOptionsBuilder {
+	b.options.HalfOpenRequests = requests
+	return b
+}
+
+// SetIsFailure sets the function which decides whether a delivery counts as failure
+func (b *CircuitBreakerOptionsBuilder) SetIsFailure(isFailure func(result DeliveryResult, err error) bool) *CircuitBreakerOptionsBuilder {
+	b.options.IsFailure = isFailure
+	return b
+}
+
+// SetOnStateChange sets the function which is called whenever the state of the circuit changes
+func (b *CircuitBreakerOptionsBuilder) SetOnStateChange(onStateChange func(from CircuitState, to CircuitState)) *CircuitBreakerOptionsBuilder {
+	b.options.OnStateChange = onStateChange
+	return b
+}
+
+// Build returns the configured CircuitBreakerOptions
+func (b *CircuitBreakerOptionsBuilder) Build() *CircuitBreakerOptions {
+	return b.options
+}
+
+// CircuitBreaker wraps an integration and stops sending messages to it
+// after consecutive failures, until probes show it recovered
+type CircuitBreaker struct {
+	options  *CircuitBreakerOptions
+	notifier Notifier
+	now      func() time.Time
+
+	mu          sync.Mutex
+	state       CircuitState
+	generation  uint64
+	failures    int
+	probes      int
+	successes   int
+	openedAt    time.Time
+	integration string
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker which delivers messages through the provided notifier
+func NewCircuitBreaker(opts *CircuitBreakerOptions, notifier Notifier) (*CircuitBreaker, error) {
+	// Validate circuit breaker configuration
+	validate := validator.New()
+	err := validate.Struct(opts)
+	if err != nil {
+		return nil, err
+	}
+	if notifier == nil {
+		return nil, errors.New("notifier is required")
+	}
+
+	return &CircuitBreaker{
+		options:  opts,
+		notifier: notifier,
+		now:      time.Now,
+	}, nil
+}
+
+// State returns the current state of the circuit. An open circuit whose
+// timeout expired is reported as half-open, as the next message will probe it.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == CircuitOpen && !cb.now().Before(cb.openedAt.Add(cb.options.OpenTimeout)) {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+// Send implements Notifier. It sends the message through the wrapped integration,
+// or fails fast with ErrCircuitOpen while the circuit is open.
+func (cb *CircuitBreaker) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	generation, integration, ok := cb.allow()
+	if !ok {
+		result := DeliveryResult{Integration: integration}
+		return result.done(start, ErrCircuitOpen)
+	}
+
+	result, err := cb.notifier.Send(ctx, message)
+
+	isFailure := cb.options.IsFailure
+	if isFailure == nil {
+		isFailure = IsBreakerFailure
+	}
+	cb.record(generation, result.Integration, isFailure(result, err), err == nil)
+	return result, err
+}
+
+// allow reports whether a message may be sent, together with the generation
+// of the state it is sent in, so outdated outcomes can be ignored
+func (cb *CircuitBreaker) allow() (uint64, string, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if cb.now().Before(cb.openedAt.Add(cb.options.OpenTimeout)) {
+			return cb.generation, cb.integration, false
+		}
+		cb.setState(CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if cb.probes >= cb.options.HalfOpenRequests {
+			return cb.generation, cb.integration, false
+		}
+		cb.probes++
+	}
+	return cb.generation, cb.integration, true
+}
+
+// record updates the state of the circuit with the outcome of a delivery, which can be
+// neither failed nor succeeded, e.g. when it was cancelled or rejected by a rate limit
+func (cb *CircuitBreaker) record(generation uint64, integration string, failed bool, succeeded bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if integration != "" {
+		cb.integration = integration
+	}
+	if generation != cb.generation {
+		return
+	}
+
+	switch cb.state {
+	case CircuitClosed:
+		if !failed {
+			cb.failures = 0
+			return
+		}
+		cb.failures++
+		if cb.failures >= cb.options.FailureThreshold {
+			cb.setState(CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		switch {
+		case failed:
+			cb.setState(CircuitOpen)
+		case succeeded:
+			cb.successes++
+			if cb.successes >= cb.options.HalfOpenRequests {
+				cb.setState(CircuitClosed)
+			}
+		default:
+			// The probe didn't reach the integration, another one is let through instead
+			cb.probes--
+		}
+	}
+}
+
+// setState moves the circuit to a new state and resets its counters, cb.mu must be held
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	from := cb.state
+	cb.state = state
+	cb.generation++
+	cb.failures = 0
+	cb.probes = 0
+	cb.successes = 0
+	if state == CircuitOpen {
+		cb.openedAt = cb.now()
+	}
+	if cb.options.OnStateChange != nil && from != state {
+		cb.options.OnStateChange(from, state)
+	}
+}
+
+// IsBreakerFailure is the default classification of deliveries for the circuit breaker.
+// Every error counts as failure, except a cancelled context, the local ErrRateLimited and ErrDuplicateInFlight
+// and client errors (4xx) other than rate limits and timeouts, as those don't tell the provider is down.
+func IsBreakerFailure(result DeliveryResult, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrRateLimited) || errors.Is(err, ErrDuplicateInFlight) {
+		return false
+	}
+	statusCode := result.StatusCode
+	if statusCode >= 400 && statusCode < 500 {
+		return statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout
+	}
+	return true
+}
@@ -0,0 +1,206 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// switchNotifier fails while down is set
+type switchNotifier struct {
+	down  bool
+	calls int
+}
+
+func (n *switchNotifier) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationSendgrid}
+	n.calls++
+	if n.down {
+		result.StatusCode = http.StatusBadGateway
+		return result.done(start, errors.New("sendgrid request failed with status 502"))
+	}
+	result.StatusCode = http.StatusAccepted
+	return result.done(start, nil)
+}
+
+func TestCircuitBreakerOptionsValidation(t *testing.T) {
+	_, err := NewCircuitBreaker(NewCircuitBreakerOptions().SetFailureThreshold(0).Build(), &switchNotifier{})
+	if err == nil {
+		t.Errorf("expected error for zero failure threshold got nil")
+	}
+	_, err = NewCircuitBreaker(NewCircuitBreakerOptions().Build(), nil)
+	if err == nil {
+		t.Errorf("expected error for missing notifier got nil")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var transitions []string
+	opts := NewCircuitBreakerOptions().
+		SetFailureThreshold(3).
+		SetOpenTimeout(time.Minute).
+		SetHalfOpenRequests(2).
+		SetOnStateChange(func(from CircuitState, to CircuitState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		}).
+		Build()
+
+	notifier := &switchNotifier{down: true}
+	breaker, err := NewCircuitBreaker(opts, notifier)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// Opens after 3 consecutive failures
+	for i := 0; i < 3; i++ {
+		if breaker.State() != CircuitClosed {
+			t.Fatalf("expected closed circuit after %d failures", i)
+		}
+		breaker.Send(ctx, models.Message{})
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("expected open circuit got %s", breaker.State())
+	}
+
+	// Fails fast while open
+	result, err := breaker.Send(ctx, models.Message{})
+	if !errors.Is(err, ErrCircuitOpen) || notifier.calls != 3 {
+		t.Errorf("expected to fail fast got %v after %d calls", err, notifier.calls)
+	}
+	if result.Integration != IntegrationSendgrid || result.Delivered() {
+		t.Errorf("expected failed sendgrid result got %+v", result)
+	}
+
+	// A failing probe opens the circuit again
+	now = now.Add(time.Minute)
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("expected half-open circuit got %s", breaker.State())
+	}
+	breaker.Send(ctx, models.Message{})
+	if breaker.State() != CircuitOpen || notifier.calls != 4 {
+		t.Fatalf("expected open circuit after failed probe got %s", breaker.State())
+	}
+
+	// Successful probes close the circuit
+	now = now.Add(time.Minute)
+	notifier.down = false
+	for i := 0; i < 2; i++ {
+		if _, err := breaker.Send(ctx, models.Message{}); err != nil {
+			t.Fatalf("expected probe to succeed got %v", err)
+		}
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("expected closed circuit got %s", breaker.State())
+	}
+
+	expected := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if len(transitions) != len(expected) {
+		t.Fatalf("expected transitions %v got %v", expected, transitions)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Errorf("expected transition %s got %s", expected[i], transitions[i])
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenLimit(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	probe := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		close(started)
+		<-release
+		return DeliveryResult{Integration: IntegrationAlexa}, nil
+	})
+
+	breaker, err := NewCircuitBreaker(NewCircuitBreakerOptions().SetOpenTimeout(time.Millisecond).Build(), probe)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	breaker.mu.Lock()
+	breaker.setState(CircuitOpen)
+	breaker.mu.Unlock()
+	time.Sleep(2 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		breaker.Send(context.Background(), models.Message{})
+		close(done)
+	}()
+	<-started
+
+	// Only a single probe is let through while half-open
+	if _, err := breaker.Send(context.Background(), models.Message{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen for a second probe got %v", err)
+	}
+	close(release)
+	<-done
+	if breaker.State() != CircuitClosed {
+		t.Errorf("expected closed circuit got %s", breaker.State())
+	}
+}
+
+func TestCircuitBreakerHalfOpenNeutralProbe(t *testing.T) {
+	var errs []error
+	notifier := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		start := time.Now()
+		result := DeliveryResult{Integration: IntegrationSendgrid}
+		err := errs[0]
+		errs = errs[1:]
+		if err != nil {
+			result.StatusCode = http.StatusBadRequest
+		}
+		return result.done(start, err)
+	})
+	breaker, err := NewCircuitBreaker(NewCircuitBreakerOptions().SetOpenTimeout(time.Minute).Build(), notifier)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+	breaker.mu.Lock()
+	breaker.setState(CircuitOpen)
+	breaker.mu.Unlock()
+	now = now.Add(time.Minute)
+
+	// Cancelled, rate limited and rejected probes neither close nor open the circuit
+	for _, probeErr := range []error{context.Canceled, ErrRateLimited, errors.New("sendgrid request failed with status 400")} {
+		errs = []error{probeErr}
+		breaker.Send(context.Background(), models.Message{})
+		if breaker.State() != CircuitHalfOpen {
+			t.Fatalf("expected half-open circuit after %v got %s", probeErr, breaker.State())
+		}
+	}
+
+	// The probe slot is released, so the next probe is let through and closes the circuit
+	errs = []error{nil}
+	if _, err := breaker.Send(context.Background(), models.Message{}); err != nil {
+		t.Fatalf("expected probe to succeed got %v", err)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Errorf("expected closed circuit got %s", breaker.State())
+	}
+}
+
+func TestIsBreakerFailure(t *testing.T) {
+	if IsBreakerFailure(DeliveryResult{StatusCode: 400}, errors.New("bad request")) {
+		t.Errorf("expected client errors not to count as failure")
+	}
+	if !IsBreakerFailure(DeliveryResult{StatusCode: 429}, errors.New("rate limited")) {
+		t.Errorf("expected rate limits to count as failure")
+	}
+	if !IsBreakerFailure(DeliveryResult{}, context.DeadlineExceeded) {
+		t.Errorf("expected timeouts to count as failure")
+	}
+	if IsBreakerFailure(DeliveryResult{}, context.Canceled) {
+		t.Errorf("expected cancellation not to count as failure")
+	}
+}
@@ -0,0 +1,35 @@
+package integrations
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// withDefaultTimeout returns a context that expires after timeout, unless ctx already
+// carries a deadline, in which case the deadline of the caller is respected
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// contextHTTPClient returns an HTTP client which attaches ctx to every request it sends.
+// It is used for provider libraries which accept an *http.Client but no context.
+func contextHTTPClient(ctx context.Context) *http.Client {
+	return &http.Client{
+		Transport: &contextTransport{ctx: ctx, base: http.DefaultTransport},
+	}
+}
+
+// contextTransport is a http.RoundTripper which replaces the context of a request
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper interface
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
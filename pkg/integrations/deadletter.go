@@ -0,0 +1,477 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrDeadLetterNotFound is returned when a dead letter doesn't exist
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeliveryFailure describes a failed attempt to deliver a message
+type DeliveryFailure struct {
+	Attempt    int       `json:"attempt" bson:"attempt"`
+	StatusCode int       `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Error      string    `json:"error" bson:"error"`
+	At         time.Time `json:"at" bson:"at"`
+}
+
+// DeadLetterStatus is the status of a dead letter
+type DeadLetterStatus string
+
+const (
+	// DeadLetterFailed letters are waiting to be inspected or replayed
+	DeadLetterFailed DeadLetterStatus = "failed"
+	// DeadLetterReplayed letters were delivered by a replay
+	DeadLetterReplayed DeadLetterStatus = "replayed"
+)
+
+// DeadLetter is a message which could not be delivered to a channel
+type DeadLetter struct {
+	Id primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// Channel references the configuration of the channel, it is used to find the integration on replay
+	Channel string `json:"channel" bson:"channel"`
+	// Integration is the name of the integration which failed, e.g. IntegrationSlack
+	Integration string           `json:"integration,omitempty" bson:"integration,omitempty"`
+	Message     models.Message   `json:"message" bson:"message"`
+	Status      DeadLetterStatus `json:"status" bson:"status"`
+	// Attempts is the number of times the message was sent, including replays
+	Attempts   int               `json:"attempts" bson:"attempts"`
+	Failures   []DeliveryFailure `json:"failures,omitempty" bson:"failures,omitempty"`
+	Replays    int               `json:"replays,omitempty" bson:"replays,omitempty"`
+	CreatedAt  time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at" bson:"updated_at"`
+	ReplayedAt time.Time         `json:"replayed_at,omitempty" bson:"replayed_at,omitempty"`
+}
+
+// LastError returns the error of the last failed attempt
+func (l DeadLetter) LastError() string {
+	if len(l.Failures) == 0 {
+		return ""
+	}
+	return l.Failures[len(l.Failures)-1].Error
+}
+
+// DeadLetterFilter selects dead letters, empty fields match all letters
+type DeadLetterFilter struct {
+	Channel     string
+	Integration string
+	Status      DeadLetterStatus
+	// UserId matches the user the message was sent for
+	UserId string
+	// Since and Until match the time the letter was added
+	Since time.Time
+	Until time.Time
+	// Limit is the maximum number of letters returned, zero means all
+	Limit int
+}
+
+// DeadLetterStore persists messages which could not be delivered
+type DeadLetterStore interface {
+	// Add stores a new dead letter
+	Add(ctx context.Context, letter *DeadLetter) error
+	// Get returns the dead letter with the given id, or ErrDeadLetterNotFound
+	Get(ctx context.Context, id primitive.ObjectID) (*DeadLetter, error)
+	// List returns the dead letters matching the filter, the oldest first
+	List(ctx context.Context, filter DeadLetterFilter) ([]DeadLetter, error)
+	// Update stores the changes of a dead letter, e.g. after a replay
+	Update(ctx context.Context, letter *DeadLetter) error
+	// Delete removes the dead letter with the given id
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// DeadLetterQueue keeps the messages which could not be delivered to their channel,
+// so they can be inspected and replayed once the problem is solved
+type DeadLetterQueue struct {
+	store    DeadLetterStore
+	channels map[string]Notifier
+	now      func() time.Time
+}
+
+// NewDeadLetterQueue creates a new DeadLetterQueue on the provided store. The channels
+// are used to replay the dead letters, and are matched by the channel of the letter.
+func NewDeadLetterQueue(store DeadLetterStore, channels ...Channel) (*DeadLetterQueue, error) {
+	if store == nil {
+		return nil, errors.New("dead-letter store is required")
+	}
+	queue := &DeadLetterQueue{
+		store:    store,
+		channels: map[string]Notifier{},
+		now:      time.Now,
+	}
+	for _, channel := range channels {
+		if channel.Name == "" || channel.Notifier == nil {
+			return nil, errors.New("channel requires a name and a notifier")
+		}
+		queue.channels[channel.Name] = channel.Notifier
+	}
+	return queue, nil
+}
+
+// Capture wraps the integration of a channel, so every message it fails to deliver is
+// added to the queue. When the integration is retried, wrap the Retry so only messages
+// which exhausted their attempts are added, with the error of every attempt.
+func (q *DeadLetterQueue) Capture(channel string, notifier Notifier) Notifier {
+	return &deadLetterNotifier{
+		queue:    q,
+		channel:  channel,
+		notifier: notifier,
+	}
+}
+
+// deadLetterNotifier is an integration of which the failed messages are added to a DeadLetterQueue
+type deadLetterNotifier struct {
+	queue    *DeadLetterQueue
+	channel  string
+	notifier Notifier
+}
+
+// Send implements Notifier
+func (n *deadLetterNotifier) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+	result, err := n.notifier.Send(ctx, message)
+	if err == nil || errors.Is(err, context.Canceled) {
+		return result, err
+	}
+
+	now := n.queue.now()
+	letter := &DeadLetter{
+		Channel:     n.channel,
+		Integration: result.Integration,
+		Message:     message,
+		Failures:    failures(result, err, now),
+	}
+	letter.Attempts = len(letter.Failures)
+
+	// The letter is stored, even when the context of the message expired
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), TIMEOUT)
+	defer cancel()
+	if storeErr := n.queue.store.Add(storeCtx, letter); storeErr != nil {
+		err = errors.Join(err, fmt.Errorf("unable to add dead letter: %w", storeErr))
+	}
+	return result, err
+}
+
+// failures returns the failed attempts of a result
+func failures(result DeliveryResult, err error, now time.Time) []DeliveryFailure {
+	if len(result.Attempts) == 0 {
+		return []DeliveryFailure{{Attempt: 1, StatusCode: result.StatusCode, Error: err.Error(), At: now}}
+	}
+	var failures []DeliveryFailure
+	for _, attempt := range result.Attempts {
+		if attempt.Error != nil {
+			failures = append(failures, DeliveryFailure{
+				Attempt:    attempt.Attempt,
+				StatusCode: attempt.StatusCode,
+				Error:      attempt.Error.Error(),
+				At:         now,
+			})
+		}
+	}
+	return failures
+}
+
+// Add adds a message which could not be delivered to the queue
+func (q *DeadLetterQueue) Add(ctx context.Context, letter *DeadLetter) error {
+	return q.store.Add(ctx, letter)
+}
+
+// Get returns the dead letter with the given id
+func (q *DeadLetterQueue) Get(ctx context.Context, id primitive.ObjectID) (*DeadLetter, error) {
+	return q.store.Get(ctx, id)
+}
+
+// List returns the dead letters matching the filter
+func (q *DeadLetterQueue) List(ctx context.Context, filter DeadLetterFilter) ([]DeadLetter, error) {
+	return q.store.List(ctx, filter)
+}
+
+// Delete removes the dead letter with the given id
+func (q *DeadLetterQueue) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return q.store.Delete(ctx, id)
+}
+
+// Replay sends the dead letter again to its channel. When it is delivered the letter is marked
+// as replayed, otherwise the failure is added to the history of the letter.
+func (q *DeadLetterQueue) Replay(ctx context.Context, id primitive.ObjectID) (DeliveryResult, error) {
+	letter, err := q.store.Get(ctx, id)
+	if err != nil {
+		return DeliveryResult{}, err
+	}
+	return q.replay(ctx, letter)
+}
+
+// ReplayAll replays the dead letters matching the filter which are not replayed yet,
+// and returns the result of every replay by the id of the letter
+func (q *DeadLetterQueue) ReplayAll(ctx context.Context, filter DeadLetterFilter) (map[primitive.ObjectID]DeliveryResult, error) {
+	filter.Status = DeadLetterFailed
+	letters, err := q.store.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	results := map[primitive.ObjectID]DeliveryResult{}
+	var errs []error
+	for i := range letters {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		result, err := q.replay(ctx, &letters[i])
+		results[letters[i].Id] = result
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dead letter %s: %w", letters[i].Id.Hex(), err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// replay sends the dead letter again to its channel and stores the outcome
+func (q *DeadLetterQueue) replay(ctx context.Context, letter *DeadLetter) (DeliveryResult, error) {
+	notifier, ok := q.channels[letter.Channel]
+	if !ok {
+		return DeliveryResult{Integration: letter.Integration}, fmt.Errorf("unknown channel %s", letter.Channel)
+	}
+
+	result, err := notifier.Send(ctx, letter.Message)
+
+	now := q.now()
+	letter.Attempts++
+	letter.Replays++
+	letter.UpdatedAt = now
+	if err == nil {
+		letter.Status = DeadLetterReplayed
+		letter.ReplayedAt = now
+	} else {
+		letter.Failures = append(letter.Failures, DeliveryFailure{
+			Attempt:    letter.Attempts,
+			StatusCode: result.StatusCode,
+			Error:      err.Error(),
+			At:         now,
+		})
+	}
+
+	if updateErr := q.store.Update(context.WithoutCancel(ctx), letter); updateErr != nil {
+		return result, errors.Join(err, updateErr)
+	}
+	return result, err
+}
+
+// DeadLetterCollection is the MongoDB collection the dead letters are stored in
+const DeadLetterCollection = "dead_letters"
+
+// MongoDeadLetterStore stores dead letters in MongoDB
+type MongoDeadLetterStore struct {
+	collection *mongo.Collection
+	now        func() time.Time
+}
+
+// NewMongoDeadLetterStore creates a DeadLetterStore on the dead_letters collection of the MongoDB integration,
+// it uses the shared client of New when the integration has no client
+func NewMongoDeadLetterStore(mongodb *Mongodb) *MongoDeadLetterStore {
+	return &MongoDeadLetterStore{
+		collection: mongodb.client().Database(DatabaseName).Collection(DeadLetterCollection),
+		now:        time.Now,
+	}
+}
+
+// EnsureIndexes creates the indexes used to filter dead letters
+func (s *MongoDeadLetterStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "channel", Value: 1}, {Key: "created_at", Value: 1}}},
+	})
+	return err
+}
+
+// Add implements DeadLetterStore
+func (s *MongoDeadLetterStore) Add(ctx context.Context, letter *DeadLetter) error {
+	prepareDeadLetter(letter, s.now())
+	_, err := s.collection.InsertOne(ctx, letter)
+	return err
+}
+
+// Get implements DeadLetterStore
+func (s *MongoDeadLetterStore) Get(ctx context.Context, id primitive.ObjectID) (*DeadLetter, error) {
+	letter := &DeadLetter{}
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(letter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return letter, nil
+}
+
+// List implements DeadLetterStore
+func (s *MongoDeadLetterStore) List(ctx context.Context, filter DeadLetterFilter) ([]DeadLetter, error) {
+	query := bson.M{}
+	if filter.Channel != "" {
+		query["channel"] = filter.Channel
+	}
+	if filter.Integration != "" {
+		query["integration"] = filter.Integration
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.UserId != "" {
+		query["message.userid"] = filter.UserId
+	}
+	createdAt := bson.M{}
+	if !filter.Since.IsZero() {
+		createdAt["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		createdAt["$lt"] = filter.Until
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	letters := []DeadLetter{}
+	if err := cursor.All(ctx, &letters); err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+// Update implements DeadLetterStore
+func (s *MongoDeadLetterStore) Update(ctx context.Context, letter *DeadLetter) error {
+	res, err := s.collection.ReplaceOne(ctx, bson.M{"_id": letter.Id}, letter)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// Delete implements DeadLetterStore
+func (s *MongoDeadLetterStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	res, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// MemoryDeadLetterStore stores dead letters in memory, it is meant for tests
+type MemoryDeadLetterStore struct {
+	mu      sync.Mutex
+	letters map[primitive.ObjectID]DeadLetter
+	now     func() time.Time
+}
+
+// NewMemoryDeadLetterStore creates an empty in-memory DeadLetterStore
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{
+		letters: map[primitive.ObjectID]DeadLetter{},
+		now:     time.Now,
+	}
+}
+
+// Add implements DeadLetterStore
+func (s *MemoryDeadLetterStore) Add(ctx context.Context, letter *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prepareDeadLetter(letter, s.now())
+	s.letters[letter.Id] = *letter
+	return nil
+}
+
+// Get implements DeadLetterStore
+func (s *MemoryDeadLetterStore) Get(ctx context.Context, id primitive.ObjectID) (*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	letter, ok := s.letters[id]
+	if !ok {
+		return nil, ErrDeadLetterNotFound
+	}
+	return &letter, nil
+}
+
+// List implements DeadLetterStore
+func (s *MemoryDeadLetterStore) List(ctx context.Context, filter DeadLetterFilter) ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters := []DeadLetter{}
+	for _, letter := range s.letters {
+		if filter.Channel != "" && letter.Channel != filter.Channel ||
+			filter.Integration != "" && letter.Integration != filter.Integration ||
+			filter.Status != "" && letter.Status != filter.Status ||
+			filter.UserId != "" && letter.Message.UserId != filter.UserId ||
+			!filter.Since.IsZero() && letter.CreatedAt.Before(filter.Since) ||
+			!filter.Until.IsZero() && !letter.CreatedAt.Before(filter.Until) {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].CreatedAt.Before(letters[j].CreatedAt) ||
+			letters[i].CreatedAt.Equal(letters[j].CreatedAt) && letters[i].Id.Hex() < letters[j].Id.Hex()
+	})
+	if filter.Limit > 0 && len(letters) > filter.Limit {
+		letters = letters[:filter.Limit]
+	}
+	return letters, nil
+}
+
+// Update implements DeadLetterStore
+func (s *MemoryDeadLetterStore) Update(ctx context.Context, letter *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.letters[letter.Id]; !ok {
+		return ErrDeadLetterNotFound
+	}
+	s.letters[letter.Id] = *letter
+	return nil
+}
+
+// Delete implements DeadLetterStore
+func (s *MemoryDeadLetterStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.letters[id]; !ok {
+		return ErrDeadLetterNotFound
+	}
+	delete(s.letters, id)
+	return nil
+}
+
+// prepareDeadLetter sets the defaults of a new dead letter
+func prepareDeadLetter(letter *DeadLetter, now time.Time) {
+	if letter.Id.IsZero() {
+		letter.Id = primitive.NewObjectID()
+	}
+	if letter.Status == "" {
+		letter.Status = DeadLetterFailed
+	}
+	if letter.CreatedAt.IsZero() {
+		letter.CreatedAt = now
+	}
+	letter.UpdatedAt = now
+}
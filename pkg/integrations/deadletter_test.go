@@ -0,0 +1,197 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// toggleNotifier fails until healthy is set
+type toggleNotifier struct {
+	healthy bool
+}
+
+func (n *toggleNotifier) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationPushover}
+	if !n.healthy {
+		result.StatusCode = http.StatusInternalServerError
+		return result.done(start, errors.New("pushover request failed"))
+	}
+	result.StatusCode = http.StatusOK
+	return result.done(start, nil)
+}
+
+func TestDeadLetterQueueCapture(t *testing.T) {
+	store := NewMemoryDeadLetterStore()
+	pushover := &toggleNotifier{}
+	queue, err := NewDeadLetterQueue(store, Channel{Name: "pushover-user-1", Notifier: pushover})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	retry, err := NewRetry(NewRetryOptions().SetMaxAttempts(3).SetInitialBackoff(0).SetJitter(0).Build(), pushover)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	notifier := queue.Capture("pushover-user-1", retry)
+
+	message := models.Message{Title: "Motion detected", UserId: "user-1"}
+	if _, err := notifier.Send(context.Background(), message); err == nil {
+		t.Fatalf("expected error got nil")
+	}
+
+	letters, err := queue.List(context.Background(), DeadLetterFilter{})
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("expected a single dead letter got %d %v", len(letters), err)
+	}
+	letter := letters[0]
+	if letter.Channel != "pushover-user-1" || letter.Integration != IntegrationPushover || letter.Status != DeadLetterFailed {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+	if letter.Message.Title != "Motion detected" {
+		t.Errorf("expected the original message got %+v", letter.Message)
+	}
+	if letter.Attempts != 3 || len(letter.Failures) != 3 || letter.Failures[2].StatusCode != 500 {
+		t.Errorf("expected the error history of 3 attempts got %+v", letter.Failures)
+	}
+	if letter.LastError() == "" {
+		t.Errorf("expected last error got empty")
+	}
+
+	// Delivered messages are not added
+	pushover.healthy = true
+	notifier.Send(context.Background(), message)
+	if letters, _ := queue.List(context.Background(), DeadLetterFilter{}); len(letters) != 1 {
+		t.Errorf("expected delivered message not to be added got %d letters", len(letters))
+	}
+}
+
+func TestDeadLetterQueueFilter(t *testing.T) {
+	store := NewMemoryDeadLetterStore()
+	queue, _ := NewDeadLetterQueue(store)
+	ctx := context.Background()
+
+	now := time.Now()
+	letters := []*DeadLetter{
+		{Channel: "slack", Integration: IntegrationSlack, Message: models.Message{UserId: "user-1"}, CreatedAt: now.Add(-2 * time.Hour)},
+		{Channel: "smtp", Integration: IntegrationSMTP, Message: models.Message{UserId: "user-1"}, CreatedAt: now.Add(-time.Hour)},
+		{Channel: "smtp", Integration: IntegrationSMTP, Message: models.Message{UserId: "user-2"}, CreatedAt: now, Status: DeadLetterReplayed},
+	}
+	for _, letter := range letters {
+		if err := queue.Add(ctx, letter); err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filter   DeadLetterFilter
+		expected int
+	}{
+		{"All", DeadLetterFilter{}, 3},
+		{"Channel", DeadLetterFilter{Channel: "smtp"}, 2},
+		{"Integration", DeadLetterFilter{Integration: IntegrationSlack}, 1},
+		{"Status", DeadLetterFilter{Status: DeadLetterFailed}, 2},
+		{"User", DeadLetterFilter{UserId: "user-2"}, 1},
+		{"Since", DeadLetterFilter{Since: now.Add(-90 * time.Minute)}, 2},
+		{"Until", DeadLetterFilter{Until: now.Add(-90 * time.Minute)}, 1},
+		{"Limit", DeadLetterFilter{Limit: 2}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := queue.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("expected no error got %v", err)
+			}
+			if len(result) != tt.expected {
+				t.Errorf("expected %d letters got %d", tt.expected, len(result))
+			}
+		})
+	}
+
+	oldest, _ := queue.List(ctx, DeadLetterFilter{Limit: 1})
+	if oldest[0].Channel != "slack" {
+		t.Errorf("expected the oldest letter first got %s", oldest[0].Channel)
+	}
+
+	if err := queue.Delete(ctx, letters[0].Id); err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+	if _, err := queue.Get(ctx, letters[0].Id); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("expected ErrDeadLetterNotFound got %v", err)
+	}
+}
+
+func TestDeadLetterQueueReplay(t *testing.T) {
+	store := NewMemoryDeadLetterStore()
+	pushover := &toggleNotifier{}
+	queue, _ := NewDeadLetterQueue(store, Channel{Name: "pushover", Notifier: pushover})
+	ctx := context.Background()
+
+	letter := &DeadLetter{Channel: "pushover", Message: models.Message{Title: "Motion"}, Attempts: 1}
+	queue.Add(ctx, letter)
+	orphan := &DeadLetter{Channel: "removed-channel", Message: models.Message{Title: "Motion"}, Attempts: 1}
+	queue.Add(ctx, orphan)
+
+	// A failed replay is added to the history
+	if _, err := queue.Replay(ctx, letter.Id); err == nil {
+		t.Fatalf("expected error got nil")
+	}
+	stored, _ := queue.Get(ctx, letter.Id)
+	if stored.Status != DeadLetterFailed || stored.Replays != 1 || stored.Attempts != 2 || len(stored.Failures) != 1 {
+		t.Errorf("expected failed replay to be recorded got %+v", stored)
+	}
+
+	pushover.healthy = true
+	results, err := queue.ReplayAll(ctx, DeadLetterFilter{})
+	if err == nil {
+		t.Errorf("expected error for the letter of an unknown channel got nil")
+	}
+	if !results[letter.Id].Delivered() {
+		t.Errorf("expected letter to be delivered got %+v", results[letter.Id])
+	}
+	stored, _ = queue.Get(ctx, letter.Id)
+	if stored.Status != DeadLetterReplayed || stored.ReplayedAt.IsZero() {
+		t.Errorf("expected letter to be marked as replayed got %+v", stored)
+	}
+
+	if _, err := queue.Replay(ctx, primitive.NewObjectID()); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("expected ErrDeadLetterNotFound got %v", err)
+	}
+}
+
+func TestOutboxDeadLetters(t *testing.T) {
+	deadLetters := NewMemoryDeadLetterStore()
+	store := NewMemoryOutboxStore()
+	outbox, err := NewOutbox(NewOutboxOptions().SetMaxAttempts(2).SetBackoff(0).SetDeadLetters(deadLetters).Build(), store,
+		Channel{Name: "pushover", Notifier: &toggleNotifier{}},
+	)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	ctx := context.Background()
+	outbox.Enqueue(ctx, models.Message{Title: "Motion detected"})
+	for {
+		processed, err := outbox.Process(ctx)
+		if err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		if !processed {
+			break
+		}
+	}
+
+	letters, _ := deadLetters.List(ctx, DeadLetterFilter{})
+	if len(letters) != 1 {
+		t.Fatalf("expected a dead letter got %d", len(letters))
+	}
+	if letters[0].Channel != "pushover" || letters[0].Integration != IntegrationPushover || letters[0].Attempts != 2 || len(letters[0].Failures) != 2 {
+		t.Errorf("unexpected dead letter %+v", letters[0])
+	}
+}
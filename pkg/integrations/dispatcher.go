@@ -0,0 +1,197 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// Channel is a configured integration the dispatcher delivers to, e.g. the Slack
+// hook or the Telegram chat of a user. The name identifies the channel in the report.
+type Channel struct {
+	Name     string
+	Notifier Notifier
+}
+
+// DispatcherOptions holds the configuration for the Dispatcher
+type DispatcherOptions struct {
+	// Concurrency is the maximum number of channels delivered to in parallel,
+	// zero means all channels at once
+	Concurrency int `json:"concurrency,omitempty" validate:"gte=0"`
+	// Timeout bounds the delivery to a single channel, zero means no timeout
+	Timeout time.Duration `json:"timeout,omitempty" validate:"gte=0"`
+}
+
+// DispatcherOptionsBuilder provides a fluent interface for building Dispatcher options
+type DispatcherOptionsBuilder struct {
+	options *DispatcherOptions
+}
+
+// NewDispatcherOptions creates a new Dispatcher options builder
+func NewDispatcherOptions() *DispatcherOptionsBuilder {
+	return &DispatcherOptionsBuilder{
+		options: &DispatcherOptions{},
+	}
+}
+
+// SetConcurrency sets the maximum number of channels delivered to in parallel
+func (b *DispatcherOptionsBuilder) SetConcurrency(concurrency int) *DispatcherOptionsBuilder {
+	b.options.Concurrency = concurrency
+	return b
+}
+
+// SetTimeout sets the timeout of the delivery to a single channel
+func (b *DispatcherOptionsBuilder) SetTimeout(timeout time.Duration) *DispatcherOptionsBuilder {
+	b.options.Timeout = timeout
+	return b
+}
+
+// Build returns the configured DispatcherOptions
+func (b *DispatcherOptionsBuilder) Build() *DispatcherOptions {
+	return b.options
+}
+
+// Dispatcher sends one message to several channels concurrently
+type Dispatcher struct {
+	options  *DispatcherOptions
+	channels []Channel
+}
+
+// NewDispatcher creates a new Dispatcher which delivers to the provided channels
+func NewDispatcher(opts *DispatcherOptions, channels ...Channel) (*Dispatcher, error) {
+	validate := validator.New()
+	if err := validate.Struct(opts); err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if channel.Name == "" || channel.Notifier == nil {
+			return nil, errors.New("channel requires a name and a notifier")
+		}
+	}
+
+	return &Dispatcher{
+		options:  opts,
+		channels: channels,
+	}, nil
+}
+
+// ChannelResult is the outcome of the delivery to a single channel
+type ChannelResult struct {
+	Channel string
+	DeliveryResult
+}
+
+// DispatchReport aggregates the outcome of the delivery to all channels,
+// results are in the same order as the channels of the dispatcher
+type DispatchReport struct {
+	Results []ChannelResult
+	Latency time.Duration
+}
+
+// Delivered reports whether the message was delivered to every channel
+func (r DispatchReport) Delivered() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the results of the channels the message couldn't be delivered to
+func (r DispatchReport) Failed() []ChannelResult {
+	var failed []ChannelResult
+	for _, result := range r.Results {
+		if !result.Delivered() {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err joins the errors of all failed channels, or returns nil if all channels succeeded
+func (r DispatchReport) Err() error {
+	var errs []error
+	for _, result := range r.Failed() {
+		errs = append(errs, fmt.Errorf("channel %s: %w", result.Channel, result.Error))
+	}
+	return errors.Join(errs...)
+}
+
+// Dispatch sends the message to all channels and waits until every delivery finished.
+// A failing channel doesn't stop the delivery to the other channels.
+func (d *Dispatcher) Dispatch(ctx context.Context, message models.Message) DispatchReport {
+
+	start := time.Now()
+	report := DispatchReport{Results: make([]ChannelResult, len(d.channels))}
+
+	concurrency := d.options.Concurrency
+	if concurrency <= 0 || concurrency > len(d.channels) {
+		concurrency = len(d.channels)
+	}
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, channel := range d.channels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				report.Results[i] = d.send(ctx, channel, message)
+			case <-ctx.Done():
+				result := DeliveryResult{
+					Integration: channel.Name,
+					Error:       &DeliveryError{Integration: channel.Name, Err: ctx.Err()},
+				}
+				report.Results[i] = ChannelResult{Channel: channel.Name, DeliveryResult: result}
+			}
+		}()
+	}
+	wg.Wait()
+
+	report.Latency = time.Since(start)
+	return report
+}
+
+// send delivers the message to a single channel, a panicking integration
+// is reported as a failed delivery instead of taking down the dispatcher
+func (d *Dispatcher) send(ctx context.Context, channel Channel, message models.Message) (channelResult ChannelResult) {
+
+	start := time.Now()
+	channelResult.Channel = channel.Name
+
+	defer func() {
+		if r := recover(); r != nil {
+			channelResult.DeliveryResult = DeliveryResult{
+				Integration: channel.Name,
+				Latency:     time.Since(start),
+				Error:       &DeliveryError{Integration: channel.Name, Err: fmt.Errorf("panic: %v", r)},
+			}
+		}
+	}()
+
+	if d.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.options.Timeout)
+		defer cancel()
+	}
+
+	result, err := channel.Notifier.Send(ctx, message)
+	if result.Integration == "" {
+		result.Integration = channel.Name
+	}
+	if result.Latency == 0 {
+		result.Latency = time.Since(start)
+	}
+	if err != nil && result.Error == nil {
+		var deliveryErr *DeliveryError
+		if !errors.As(err, &deliveryErr) {
+			deliveryErr = &DeliveryError{Integration: result.Integration, StatusCode: result.StatusCode, Err: err}
+		}
+		result.Error = deliveryErr
+	}
+	channelResult.DeliveryResult = result
+	return channelResult
+}
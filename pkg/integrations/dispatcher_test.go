@@ -0,0 +1,146 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// notifierFunc turns a function into a Notifier
+type notifierFunc func(ctx context.Context, message models.Message) (DeliveryResult, error)
+
+func (f notifierFunc) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+	return f(ctx, message)
+}
+
+func TestDispatcherOptionsBuilder(t *testing.T) {
+	opts := NewDispatcherOptions().
+		SetConcurrency(2).
+		SetTimeout(5 * time.Second).
+		Build()
+
+	if opts.Concurrency != 2 {
+		t.Errorf("expected concurrency 2 got %d", opts.Concurrency)
+	}
+	if opts.Timeout != 5*time.Second {
+		t.Errorf("expected timeout 5s got %s", opts.Timeout)
+	}
+
+	_, err := NewDispatcher(NewDispatcherOptions().SetConcurrency(-1).Build())
+	if err == nil {
+		t.Errorf("expected error for negative concurrency got nil")
+	}
+	_, err = NewDispatcher(NewDispatcherOptions().Build(), Channel{Name: "slack"})
+	if err == nil {
+		t.Errorf("expected error for channel without notifier got nil")
+	}
+}
+
+func TestDispatcherDispatch(t *testing.T) {
+	succeed := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		start := time.Now()
+		result := DeliveryResult{Integration: IntegrationSlack, StatusCode: 200}
+		return result.done(start, nil)
+	})
+	fail := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		start := time.Now()
+		result := DeliveryResult{Integration: IntegrationSMTP}
+		return result.done(start, errors.New("connection refused"))
+	})
+	panics := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		panic("nil client")
+	})
+
+	dispatcher, err := NewDispatcher(NewDispatcherOptions().Build(),
+		Channel{Name: "slack", Notifier: succeed},
+		Channel{Name: "smtp", Notifier: fail},
+		Channel{Name: "telegram", Notifier: panics},
+	)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	report := dispatcher.Dispatch(context.Background(), models.Message{Title: "Motion detected"})
+	if len(report.Results) != 3 {
+		t.Fatalf("expected 3 results got %d", len(report.Results))
+	}
+	if report.Delivered() {
+		t.Errorf("expected report to contain failures")
+	}
+	if !report.Results[0].Delivered() || report.Results[0].Channel != "slack" {
+		t.Errorf("expected slack to be delivered got %+v", report.Results[0])
+	}
+	if report.Results[1].Delivered() || report.Results[1].Channel != "smtp" {
+		t.Errorf("expected smtp to fail got %+v", report.Results[1])
+	}
+	if report.Results[2].Delivered() || report.Results[2].Integration != "telegram" {
+		t.Errorf("expected telegram panic to be reported got %+v", report.Results[2])
+	}
+	if len(report.Failed()) != 2 {
+		t.Errorf("expected 2 failed channels got %d", len(report.Failed()))
+	}
+	if report.Err() == nil {
+		t.Errorf("expected an aggregated error got nil")
+	}
+}
+
+func TestDispatcherConcurrency(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	notifier := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return DeliveryResult{Integration: "test"}, nil
+	})
+
+	var channels []Channel
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		channels = append(channels, Channel{Name: name, Notifier: notifier})
+	}
+	dispatcher, err := NewDispatcher(NewDispatcherOptions().SetConcurrency(2).Build(), channels...)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	report := dispatcher.Dispatch(context.Background(), models.Message{})
+	if !report.Delivered() {
+		t.Errorf("expected all channels to be delivered got %v", report.Err())
+	}
+	if maxRunning.Load() > 2 {
+		t.Errorf("expected at most 2 concurrent sends got %d", maxRunning.Load())
+	}
+	for i, result := range report.Results {
+		if result.Channel != channels[i].Name {
+			t.Errorf("expected result %d for channel %s got %s", i, channels[i].Name, result.Channel)
+		}
+	}
+}
+
+func TestDispatcherTimeout(t *testing.T) {
+	slow := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		<-ctx.Done()
+		return DeliveryResult{Integration: IntegrationWebhook}, ctx.Err()
+	})
+
+	dispatcher, err := NewDispatcher(NewDispatcherOptions().SetTimeout(10*time.Millisecond).Build(),
+		Channel{Name: "webhook", Notifier: slow},
+	)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	report := dispatcher.Dispatch(context.Background(), models.Message{})
+	if !errors.Is(report.Err(), context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded got %v", report.Err())
+	}
+}
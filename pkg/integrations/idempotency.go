@@ -0,0 +1,337 @@
+package integrations
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/uug-ai/models/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrDuplicateInFlight is returned for a message of which the first send is still in progress. It is
+// retryable, as the first send can still fail and release the key.
+var ErrDuplicateInFlight = errors.New("a message with the same idempotency key is being sent")
+
+// IdempotencyKeyField is the key in the Data of a message which holds its explicit idempotency key
+const IdempotencyKeyField = "idempotency_key"
+
+// IdempotencyKey returns the idempotency key of a message. This is the explicit key in the
+// Data of the message, or a key derived from the device, the timestamp of the media and the
+// type of the message. It returns an empty key when the message can't be identified.
+func IdempotencyKey(message models.Message) string {
+	if key := message.Data[IdempotencyKeyField]; key != "" {
+		return key
+	}
+
+	deviceId := message.DeviceId
+	timestamp := message.Timestamp
+	if len(message.Media) > 0 {
+		if deviceId == "" {
+			deviceId = message.Media[0].DeviceId
+		}
+		if message.Media[0].StartTimestamp > 0 {
+			timestamp = message.Media[0].StartTimestamp
+		}
+	}
+	if deviceId == "" || timestamp == 0 {
+		return ""
+	}
+
+	hash := sha256.Sum256([]byte(deviceId + "\x00" + strconv.FormatInt(timestamp, 10) + "\x00" + message.Type))
+	return hex.EncodeToString(hash[:])
+}
+
+// IdempotencyStore records the keys of the messages which were sent
+type IdempotencyStore interface {
+	// Reserve records the key for the window. It reports false when the key was already recorded and
+	// confirmed within the window, and returns ErrDuplicateInFlight when it is recorded but not confirmed yet.
+	Reserve(ctx context.Context, key string, window time.Duration) (bool, error)
+	// Confirm marks the key as sent
+	Confirm(ctx context.Context, key string) error
+	// Release removes the key, so the message can be sent again
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyOptions holds the configuration for Idempotency
+type IdempotencyOptions struct {
+	// Window is the time in which a message with the same key is not sent again
+	Window time.Duration `json:"window,omitempty" validate:"gt=0"`
+	// Key returns the idempotency key of a message, defaults to IdempotencyKey
+	Key func(message models.Message) string `json:"-"`
+}
+
+// IdempotencyOptionsBuilder provides a fluent interface for building Idempotency options
+type IdempotencyOptionsBuilder struct {
+	options *IdempotencyOptions
+}
+
+// NewIdempotencyOptions creates a new Idempotency options builder, with a window of 10 minutes by default
+func NewIdempotencyOptions() *IdempotencyOptionsBuilder {
+	return &IdempotencyOptionsBuilder{
+		options: &IdempotencyOptions{
+			Window: 10 * time.Minute,
+		},
+	}
+}
+
+// SetWindow sets the time in which a message with the same key is not sent again
+func (b *IdempotencyOptionsBuilder) SetWindow(window time.Duration) *IdempotencyOptionsBuilder {
+	b.options.Window = window
+	return b
+}
+
+// SetKey sets the function which returns the idempotency key of a message
+func (b *IdempotencyOptionsBuilder) SetKey(key func(message models.Message) string) *IdempotencyOptionsBuilder {
+	b.options.Key = key
+	return b
+}
+
+// Build returns the configured IdempotencyOptions
+func (b *IdempotencyOptionsBuilder) Build() *IdempotencyOptions {
+	return b.options
+}
+
+// Idempotency suppresses messages which were already sent to a channel within a window,
+// e.g. when the same event is delivered twice by an at-least-once event bus
+type Idempotency struct {
+	options *IdempotencyOptions
+	store   IdempotencyStore
+}
+
+// NewIdempotency creates a new Idempotency which records the keys in the provided store
+func NewIdempotency(opts *IdempotencyOptions, store IdempotencyStore) (*Idempotency, error) {
+	// Validate Idempotency configuration
+	validate := validator.New()
+	err := validate.Struct(opts)
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return nil, errors.New("idempotency store is required")
+	}
+
+	return &Idempotency{
+		options: opts,
+		store:   store,
+	}, nil
+}
+
+// Deduplicate wraps the integration of a channel, so a message is sent at most once to the
+// channel within the window. Keys are recorded per channel, so the same message can still
+// be sent to other channels.
+func (i *Idempotency) Deduplicate(channel string, notifier Notifier) Notifier {
+	return &idempotentNotifier{
+		idempotency: i,
+		channel:     channel,
+		notifier:    notifier,
+	}
+}
+
+// idempotentNotifier is an integration which doesn't send the same message twice
+type idempotentNotifier struct {
+	idempotency *Idempotency
+	channel     string
+	notifier    Notifier
+}
+
+// Send implements Notifier. A message which was already sent within the window is not sent
+// again, and its result is reported as Duplicate. While the first send of the message is still
+// in progress, it fails with the retryable ErrDuplicateInFlight. Messages without a key are always sent.
+func (n *idempotentNotifier) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	keyOf := n.idempotency.options.Key
+	if keyOf == nil {
+		keyOf = IdempotencyKey
+	}
+	messageKey := keyOf(message)
+	if messageKey == "" {
+		return n.notifier.Send(ctx, message)
+	}
+
+	start := time.Now()
+	key := n.channel + ":" + messageKey
+	reserved, err := n.idempotency.store.Reserve(ctx, key, n.idempotency.options.Window)
+	if err != nil {
+		result := DeliveryResult{Integration: n.channel}
+		return result.done(start, err)
+	}
+	if !reserved {
+		result := DeliveryResult{Integration: n.channel, Duplicate: true}
+		return result.done(start, nil)
+	}
+
+	result, err := n.notifier.Send(ctx, message)
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), TIMEOUT)
+	defer cancel()
+	if err == nil {
+		// The message is delivered, failing to confirm the key only makes duplicates retry until the window ends
+		n.idempotency.store.Confirm(storeCtx, key)
+		return result, nil
+	}
+	// The message was not delivered, so it may be sent again
+	if releaseErr := n.idempotency.store.Release(storeCtx, key); releaseErr != nil {
+		err = errors.Join(err, releaseErr)
+	}
+	return result, err
+}
+
+// MemoryIdempotencyStore records keys in memory. When it holds its maximum number
+// of keys, the least recently reserved key is evicted.
+type MemoryIdempotencyStore struct {
+	size int
+	now  func() time.Time
+
+	mu    sync.Mutex
+	keys  map[string]*list.Element
+	order *list.List
+}
+
+// memoryIdempotencyKey is a key recorded in the MemoryIdempotencyStore
+type memoryIdempotencyKey struct {
+	key       string
+	expiresAt time.Time
+	confirmed bool
+}
+
+// NewMemoryIdempotencyStore creates an in-memory IdempotencyStore holding at most size keys
+func NewMemoryIdempotencyStore(size int) *MemoryIdempotencyStore {
+	if size <= 0 {
+		size = 10000
+	}
+	return &MemoryIdempotencyStore{
+		size:  size,
+		now:   time.Now,
+		keys:  map[string]*list.Element{},
+		order: list.New(),
+	}
+}
+
+// Reserve implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, key string, window time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if element, ok := s.keys[key]; ok {
+		if recorded := element.Value.(*memoryIdempotencyKey); now.Before(recorded.expiresAt) {
+			if !recorded.confirmed {
+				return false, ErrDuplicateInFlight
+			}
+			return false, nil
+		}
+		s.order.Remove(element)
+		delete(s.keys, key)
+	}
+
+	for s.order.Len() >= s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.keys, oldest.Value.(*memoryIdempotencyKey).key)
+	}
+	s.keys[key] = s.order.PushFront(&memoryIdempotencyKey{key: key, expiresAt: now.Add(window)})
+	return true, nil
+}
+
+// Confirm implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Confirm(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.keys[key]; ok {
+		element.Value.(*memoryIdempotencyKey).confirmed = true
+	}
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.keys[key]; ok {
+		s.order.Remove(element)
+		delete(s.keys, key)
+	}
+	return nil
+}
+
+// IdempotencyCollection is the MongoDB collection the idempotency keys are stored in
+const IdempotencyCollection = "idempotency_keys"
+
+// MongoIdempotencyStore records keys in MongoDB, expired keys are removed by a TTL index
+type MongoIdempotencyStore struct {
+	collection *mongo.Collection
+	now        func() time.Time
+}
+
+// NewMongoIdempotencyStore creates an IdempotencyStore on the idempotency_keys collection of the MongoDB integration,
+// it uses the shared client of New when the integration has no client
+func NewMongoIdempotencyStore(mongodb *Mongodb) *MongoIdempotencyStore {
+	return &MongoIdempotencyStore{
+		collection: mongodb.client().Database(DatabaseName).Collection(IdempotencyCollection),
+		now:        time.Now,
+	}
+}
+
+// EnsureIndexes creates the TTL index which removes expired keys
+func (s *MongoIdempotencyStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// Reserve implements IdempotencyStore
+func (s *MongoIdempotencyStore) Reserve(ctx context.Context, key string, window time.Duration) (bool, error) {
+	now := s.now()
+	expiresAt := now.Add(window)
+	_, err := s.collection.InsertOne(ctx, bson.M{"_id": key, "expires_at": expiresAt, "confirmed": false})
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, err
+	}
+
+	// The TTL monitor only runs every minute, so the key might be expired without being removed
+	res, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": key, "expires_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"expires_at": expiresAt, "confirmed": false}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if res.ModifiedCount > 0 {
+		return true, nil
+	}
+
+	var recorded struct {
+		Confirmed bool `bson:"confirmed"`
+	}
+	err = s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&recorded)
+	if errors.Is(err, mongo.ErrNoDocuments) || err == nil && !recorded.Confirmed {
+		// A key which was released in the meantime is reported as in flight as well, the retry reserves it
+		return false, ErrDuplicateInFlight
+	}
+	return false, err
+}
+
+// Confirm implements IdempotencyStore
+func (s *MongoIdempotencyStore) Confirm(ctx context.Context, key string) error {
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"confirmed": true}})
+	return err
+}
+
+// Release implements IdempotencyStore
+func (s *MongoIdempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
@@ -0,0 +1,196 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	recording := models.Message{
+		Type:     "motion",
+		DeviceId: "camera-1",
+		Media:    []models.Media{{StartTimestamp: 1700000000}},
+	}
+	key := IdempotencyKey(recording)
+	if key == "" {
+		t.Fatalf("expected a derived key got empty")
+	}
+
+	same := recording
+	same.Title = "Another title"
+	if IdempotencyKey(same) != key {
+		t.Errorf("expected the same key for the same recording")
+	}
+
+	otherType := recording
+	otherType.Type = "person"
+	if IdempotencyKey(otherType) == key {
+		t.Errorf("expected another key for another type")
+	}
+
+	otherMedia := recording
+	otherMedia.Media = []models.Media{{StartTimestamp: 1700000001}}
+	if IdempotencyKey(otherMedia) == key {
+		t.Errorf("expected another key for another media timestamp")
+	}
+
+	mediaDevice := models.Message{Type: "motion", Media: []models.Media{{DeviceId: "camera-1", StartTimestamp: 1700000000}}}
+	if IdempotencyKey(mediaDevice) != key {
+		t.Errorf("expected the device of the media to be used")
+	}
+
+	explicit := models.Message{Data: map[string]string{IdempotencyKeyField: "event-42"}}
+	if IdempotencyKey(explicit) != "event-42" {
+		t.Errorf("expected the explicit key got %s", IdempotencyKey(explicit))
+	}
+
+	if IdempotencyKey(models.Message{Title: "No device"}) != "" {
+		t.Errorf("expected no key for a message without device")
+	}
+}
+
+func TestIdempotencyDeduplicate(t *testing.T) {
+	calls := 0
+	failNext := false
+	smtp := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		start := time.Now()
+		calls++
+		result := DeliveryResult{Integration: IntegrationSMTP}
+		if failNext {
+			failNext = false
+			return result.done(start, errors.New("connection refused"))
+		}
+		return result.done(start, nil)
+	})
+
+	store := NewMemoryIdempotencyStore(100)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	idempotency, err := NewIdempotency(NewIdempotencyOptions().SetWindow(time.Minute).Build(), store)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	email := idempotency.Deduplicate("smtp", smtp)
+	slack := idempotency.Deduplicate("slack", smtp)
+	ctx := context.Background()
+	message := models.Message{Type: "motion", DeviceId: "camera-1", Timestamp: 1700000000}
+
+	result, err := email.Send(ctx, message)
+	if err != nil || result.Duplicate {
+		t.Fatalf("expected first message to be sent got %v %+v", err, result)
+	}
+	result, err = email.Send(ctx, message)
+	if err != nil || !result.Duplicate || !result.Delivered() {
+		t.Errorf("expected second message to be a duplicate got %v %+v", err, result)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call got %d", calls)
+	}
+
+	// Other channels have their own keys
+	if result, _ := slack.Send(ctx, message); result.Duplicate {
+		t.Errorf("expected message to another channel not to be a duplicate")
+	}
+
+	// After the window the message is sent again
+	now = now.Add(time.Minute)
+	if result, _ := email.Send(ctx, message); result.Duplicate {
+		t.Errorf("expected message to be sent after the window")
+	}
+
+	// A failed message can be sent again
+	other := models.Message{Type: "motion", DeviceId: "camera-2", Timestamp: 1700000000}
+	failNext = true
+	if _, err := email.Send(ctx, other); err == nil {
+		t.Fatalf("expected error got nil")
+	}
+	if result, err := email.Send(ctx, other); err != nil || result.Duplicate {
+		t.Errorf("expected failed message to be sent again got %v %+v", err, result)
+	}
+
+	// Messages without a key are always sent
+	before := calls
+	email.Send(ctx, models.Message{Title: "test"})
+	email.Send(ctx, models.Message{Title: "test"})
+	if calls != before+2 {
+		t.Errorf("expected messages without key to be sent got %d calls", calls-before)
+	}
+}
+
+func TestIdempotencyDuplicateInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan error)
+	calls := 0
+	smtp := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		start := time.Now()
+		calls++
+		result := DeliveryResult{Integration: IntegrationSMTP}
+		if calls == 1 {
+			close(started)
+			return result.done(start, <-release)
+		}
+		return result.done(start, nil)
+	})
+	idempotency, err := NewIdempotency(NewIdempotencyOptions().Build(), NewMemoryIdempotencyStore(100))
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	email := idempotency.Deduplicate("smtp", smtp)
+	ctx := context.Background()
+	message := models.Message{Type: "motion", DeviceId: "camera-1", Timestamp: 1700000000}
+
+	done := make(chan error)
+	go func() {
+		_, err := email.Send(ctx, message)
+		done <- err
+	}()
+	<-started
+
+	// The duplicate isn't reported as delivered while the first send can still fail
+	result, err := email.Send(ctx, message)
+	if !errors.Is(err, ErrDuplicateInFlight) || result.Duplicate || !IsRetryable(result, err) {
+		t.Errorf("expected a retryable ErrDuplicateInFlight got %v %+v", err, result)
+	}
+
+	release <- errors.New("connection refused")
+	if err := <-done; err == nil {
+		t.Fatalf("expected the first send to fail")
+	}
+
+	// The retry of the duplicate sends the message
+	if result, err := email.Send(ctx, message); err != nil || result.Duplicate || calls != 2 {
+		t.Errorf("expected the retried duplicate to be sent got %v %+v after %d calls", err, result, calls)
+	}
+	if result, err := email.Send(ctx, message); err != nil || !result.Duplicate {
+		t.Errorf("expected a duplicate of the confirmed message got %v %+v", err, result)
+	}
+}
+
+func TestMemoryIdempotencyStoreEviction(t *testing.T) {
+	store := NewMemoryIdempotencyStore(2)
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		if reserved, _ := store.Reserve(ctx, key, time.Hour); !reserved {
+			t.Fatalf("expected %s to be reserved", key)
+		}
+	}
+	if reserved, _ := store.Reserve(ctx, "a", time.Hour); !reserved {
+		t.Errorf("expected the oldest key to be evicted")
+	}
+	if reserved, _ := store.Reserve(ctx, "c", time.Hour); reserved {
+		t.Errorf("expected the newest key to be kept")
+	}
+}
+
+func TestIdempotencyOptionsValidation(t *testing.T) {
+	if _, err := NewIdempotency(NewIdempotencyOptions().SetWindow(0).Build(), NewMemoryIdempotencyStore(0)); err == nil {
+		t.Errorf("expected error for zero window got nil")
+	}
+	if _, err := NewIdempotency(NewIdempotencyOptions().Build(), nil); err == nil {
+		t.Errorf("expected error for missing store got nil")
+	}
+}
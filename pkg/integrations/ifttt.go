@@ -1,21 +1,69 @@
 package integrations
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
-	ift "github.com/lorenzobenvenuti/ifttt"
 	"github.com/uug-ai/models/pkg/models"
 )
 
+// iftttEndpoint is the IFTTT Maker webhook endpoint, formatted with the event and the key
+var iftttEndpoint = "https://maker.ifttt.com/trigger/%s/with/key/%s"
+
 type Ifttt struct {
-	Token string `json:"token,omitempty"`
+	Token string `json:"token,omitempty" validate:"required"`
+}
+
+func init() {
+	MustRegister(IntegrationIfttt, DecodeJSON[Ifttt], validated[Ifttt])
 }
 
-func (ifthisthenthat Ifttt) Send(m models.Message) bool {
+// Send triggers the IFTTT event named after the message type, with the title,
+// body and timestamp of the message as value1, value2 and value3
+func (ifthisthenthat Ifttt) Send(ctx context.Context, m models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationIfttt}
+
+	if m.Type == "" {
+		return result.done(start, errors.New("message type is empty"))
+	}
+
+	values := map[string]string{
+		"value1": m.Title,
+		"value2": m.Body,
+		"value3": strconv.FormatInt(m.Timestamp, 10),
+	}
+	jsonValue, err := json.Marshal(values)
+	if err != nil {
+		return result.done(start, err)
+	}
+
+	// The event and the key are path segments, a / ? or # in them would change the request
+	endpoint := fmt.Sprintf(iftttEndpoint, url.PathEscape(m.Type), url.PathEscape(ifthisthenthat.Token))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return result.done(start, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return result.done(start, err)
+	}
+	defer resp.Body.Close()
 
-	iftttClient := ift.NewIftttClient(ifthisthenthat.Token)
-	values := []string{m.Title, m.Body, strconv.FormatInt(m.Timestamp, 10)}
-	iftttClient.Trigger(m.Type, values)
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result.done(start, fmt.Errorf("ifttt request failed with status: %s", resp.Status))
+	}
 
-	return true
+	return result.done(start, nil)
 }
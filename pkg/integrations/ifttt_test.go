@@ -1,25 +1,65 @@
 package integrations
 
-/*func TestIfttt(t *testing.T) {
-	m := models.Message{}
-	m.Type = "message"
-	m.Timestamp = int64(time.Now().Unix())
-	m.Title = "Something happened"
-	m.Body = "zgeezgzegezzgeezzge"
-	m.User = "cedricve"
-	m.UserId = "23235235235235"
-	m.SequenceId = "5a72d0f6e17699d18adb5e17"
-	m.Unread = true
-
-	// Get User notification channels.
-	// ....
-
-	// Send message to all channels.
-	ifttt := Ifttt{
-		Token: "xxx",
-	}
-	ifttt.Send(m)
-
-	// Successful test if we reach this point.
-	//t.Log("IFTTT test executed")
-}*/
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestIftttSend(t *testing.T) {
+	var path, query string
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		query = r.URL.RawQuery
+		json.NewDecoder(r.Body).Decode(&received)
+		if r.URL.Path == "/trigger/failing/with/key/token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	endpoint := iftttEndpoint
+	iftttEndpoint = server.URL + "/trigger/%s/with/key/%s"
+	defer func() { iftttEndpoint = endpoint }()
+
+	ifttt := Ifttt{Token: "token"}
+	m := models.Message{Type: "motion", Title: "Something happened", Body: "Motion detected", Timestamp: 1700000000}
+
+	result, err := ifttt.Send(context.Background(), m)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if path != "/trigger/motion/with/key/token" {
+		t.Errorf("unexpected path %q", path)
+	}
+	if received["value1"] != m.Title || received["value2"] != m.Body || received["value3"] != "1700000000" {
+		t.Errorf("unexpected payload %v", received)
+	}
+	if result.StatusCode != http.StatusOK {
+		t.Errorf("expected status code 200, got %d", result.StatusCode)
+	}
+
+	// The event and the key stay in their path segments
+	m.Type = "motion/alarm?zone=1#front"
+	if _, err := (Ifttt{Token: "to/ken"}).Send(context.Background(), m); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if path != "/trigger/motion%2Falarm%3Fzone=1%23front/with/key/to%2Fken" || query != "" {
+		t.Errorf("expected the escaped event and key got path %q and query %q", path, query)
+	}
+
+	m.Type = "failing"
+	if _, err := ifttt.Send(context.Background(), m); err == nil {
+		t.Errorf("expected error got nil")
+	}
+
+	m.Type = ""
+	if _, err := ifttt.Send(context.Background(), m); err == nil {
+		t.Errorf("expected error for empty message type got nil")
+	}
+}
@@ -2,28 +2,38 @@ package integrations
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	//shorturl "github.com/subosito/shorturl"
 	mailgun "github.com/mailgun/mailgun-go/v4"
+	"github.com/uug-ai/integrations/pkg/templates"
 	"github.com/uug-ai/models/pkg/models"
 )
 
 type Mail struct {
-	Domain     string `json:"domain,omitempty"`
-	ApiKey     string `json:"api_key,omitempty"`
+	Domain     string `json:"domain,omitempty" validate:"required"`
+	ApiKey     string `json:"api_key,omitempty" validate:"required"`
 	TemplateId string `json:"templateId,omitempty"`
-	EmailTo    string `json:"email_to,omitempty"`
-	EmailFrom  string `json:"email_from,omitempty"`
+	EmailTo    string `json:"email_to,omitempty" validate:"omitempty,email"`
+	EmailFrom  string `json:"email_from,omitempty" validate:"required,email"`
 }
 
-func (mail Mail) Send(message models.Message) error {
+func init() {
+	MustRegister(IntegrationMail, DecodeJSON[Mail], validated[Mail])
+}
+
+func (mail Mail) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationMail}
 
 	domain := mail.Domain
 	ApiKey := mail.ApiKey
 
 	mg := mailgun.NewMailgun(domain, ApiKey)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	// Use a default timeout, unless the caller set a deadline
+	ctx, cancel := withDefaultTimeout(ctx, time.Second*30)
 	defer cancel()
 
 	msg := mg.NewMessage(mail.EmailFrom,
@@ -32,10 +42,12 @@ func (mail Mail) Send(message models.Message) error {
 	msg.SetTemplate(mail.TemplateId)
 
 	// Add recipients
-	if mail.EmailTo != "" {
-		msg.AddRecipient(mail.EmailTo)
-	} else {
-		msg.AddRecipient(message.Email)
+	recipient := mail.EmailTo
+	if recipient == "" {
+		recipient = message.Email
+	}
+	if err := msg.AddRecipient(recipient); err != nil {
+		return result.done(start, err)
 	}
 
 	if message.NumberOfMedia != "" {
@@ -49,8 +61,7 @@ func (mail Mail) Send(message models.Message) error {
 	msg.AddVariable("user", message.User)
 	msg.AddVariable("text", message.Body)
 
-	if len(message.Media) > 0 {
-		longUrl := message.Media[0].AtRuntimeMetadata.VideoUrl
+	if longUrl := templates.VideoUrl(message); longUrl != "" {
 		msg.AddVariable("link", longUrl)
 	}
 
@@ -59,7 +70,16 @@ func (mail Mail) Send(message models.Message) error {
 		msg.AddVariable(key, element)
 	}
 
-	_, _, err := mg.Send(ctx, msg)
+	_, id, err := mg.Send(ctx, msg)
+	if err != nil {
+		var unexpected *mailgun.UnexpectedResponseError
+		if errors.As(err, &unexpected) {
+			result.StatusCode = unexpected.Actual
+		}
+		return result.done(start, err)
+	}
 
-	return err
+	result.MessageId = id
+	result.Recipients = []string{recipient}
+	return result.done(start, nil)
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/uug-ai/models/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
@@ -17,6 +18,10 @@ type Mongodb struct {
 	Client *mongo.Client
 }
 
+func init() {
+	MustRegister(IntegrationMongodb, DecodeJSON[*Mongodb], validated[*Mongodb])
+}
+
 var TIMEOUT = 10 * time.Second
 var _init_ctx sync.Once
 var _instance *Mongodb
@@ -85,11 +90,24 @@ func New() *Mongodb {
 	return _instance
 }
 
-func (mongodb *Mongodb) SendNotification(msg models.Message) error {
+// client returns the client of the integration, or the shared client of New when it has none,
+// e.g. when the integration is decoded from its configuration
+func (mongodb *Mongodb) client() *mongo.Client {
+	if mongodb != nil && mongodb.Client != nil {
+		return mongodb.Client
+	}
+	return New().Client
+}
+
+func (mongodb *Mongodb) Send(ctx context.Context, msg models.Message) (DeliveryResult, error) {
 
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationMongodb}
+
+	// Notifications are only stored for messages targeting a user
 	if msg.UserId != "" {
-		client := New().Client
-		ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT)
+		client := mongodb.client()
+		ctx, cancel := withDefaultTimeout(ctx, TIMEOUT)
 		defer cancel()
 
 		// Open users collection
@@ -97,16 +115,24 @@ func (mongodb *Mongodb) SendNotification(msg models.Message) error {
 		notificationsCollection := db.Collection("notifications")
 
 		// Create event
-		_, err := notificationsCollection.InsertOne(ctx, msg)
-		return err
+		res, err := notificationsCollection.InsertOne(ctx, msg)
+		if err != nil {
+			return result.done(start, err)
+		}
+		if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+			result.MessageId = id.Hex()
+		} else {
+			result.MessageId = fmt.Sprintf("%v", res.InsertedID)
+		}
+		result.Recipients = []string{msg.UserId}
 	}
 
-	return nil
+	return result.done(start, nil)
 }
 
 func (mongodb *Mongodb) Ping() error {
 	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT)
 	defer cancel()
-	err := New().Client.Ping(ctx, nil)
+	err := mongodb.client().Ping(ctx, nil)
 	return err
 }
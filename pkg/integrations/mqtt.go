@@ -1,6 +1,9 @@
 package integrations
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,19 +12,36 @@ import (
 )
 
 type MQTT struct {
-	URI      string
-	Username string
-	Password string
+	URI      string `json:"uri,omitempty" validate:"required"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Topic    string `json:"topic,omitempty" validate:"required"`
 }
 
-func (mqtt MQTT) SendNotification(message models.Message) bool {
+func init() {
+	MustRegister(IntegrationMQTT, DecodeJSON[MQTT], validated[MQTT])
+}
+
+// Send connects to the MQTT broker and publishes the message, encoded as JSON, on the configured topic
+func (mqtt MQTT) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationMQTT}
 
 	MQTTURI := mqtt.URI
 	MQTTUsername := mqtt.Username
 	MQTTPassword := mqtt.Password
 
 	if MQTTURI == "" {
-		return false
+		return result.done(start, errors.New("mqtt uri is empty"))
+	}
+	if mqtt.Topic == "" {
+		return result.done(start, errors.New("mqtt topic is empty"))
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return result.done(start, err)
 	}
 
 	opts := mqttPaho.NewClientOptions()
@@ -51,31 +71,36 @@ func (mqtt MQTT) SendNotification(message models.Message) bool {
 	}
 
 	mqc := mqttPaho.NewClient(opts)
-	if token := mqc.Connect(); token.WaitTimeout(3 * time.Second) {
-		if token.Error() != nil {
-			//log.Log.Error("routers.mqtt.main.ConfigureMQTT(): unable to establish mqtt broker connection, error was: " + token.Error().Error())
-			fmt.Println("Unable to establish mqtt broker connection")
-		}
+	// Disconnecting also stops the connect retries in the background
+	defer mqc.Disconnect(250)
+
+	token := mqc.Connect()
+	if err := waitToken(ctx, token, 3*time.Second); err != nil {
+		return result.done(start, fmt.Errorf("unable to establish mqtt broker connection: %w", err))
+	}
+
+	// Publish with QoS 1, so the broker acknowledges the message.
+	token = mqc.Publish(mqtt.Topic, 1, false, payload)
+	if err := waitToken(ctx, token, 3*time.Second); err != nil {
+		return result.done(start, fmt.Errorf("unable to publish mqtt message: %w", err))
 	}
 
-	/*posString := fmt.Sprintf("%f,%f,%f", pos.PanTilt.X, pos.PanTilt.Y, pos.Zoom.X)
-	m := models.Message{
-		Payload: models.Payload{
-			Action:   "ptz-position",
-			DeviceId: configuration.Config.Key,
-			Value: map[string]interface{}{
-				"timestamp": positionPayload.Timestamp,
-				"position":  posString,
-			},
-		},
+	if publishToken, ok := token.(*mqttPaho.PublishToken); ok {
+		result.MessageId = fmt.Sprintf("%d", publishToken.MessageID())
+	}
+	result.Recipients = []string{mqtt.Topic}
+	return result.done(start, nil)
+}
+
+// waitToken waits until the token completes or the context is done. When the context
+// has no deadline, it waits at most for the given timeout.
+func waitToken(ctx context.Context, token mqttPaho.Token, timeout time.Duration) error {
+	ctx, cancel := withDefaultTimeout(ctx, timeout)
+	defer cancel()
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	payload, err := models.PackageMQTTMessage(configuration, m)
-	if err == nil {
-		mqttClient.Publish("kerberos/hub/"+hubKey, 0, false, payload)
-	} else {
-		fmt.Println("Something went wrong while sending position to hub")
-		//log.Log.Info("routers.mqtt.main.HandlePTZPosition(): something went wrong while sending position to hub: " + string(payload))
-	}*/
-
-	return true
 }
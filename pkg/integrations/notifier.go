@@ -0,0 +1,49 @@
+package integrations
+
+import (
+	"context"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// Names of the integrations shipped with this package
+const (
+	IntegrationAlexa      = "alexa"
+	IntegrationIfttt      = "ifttt"
+	IntegrationMail       = "mail"
+	IntegrationMongodb    = "mongodb"
+	IntegrationMQTT       = "mqtt"
+	IntegrationPushbullet = "pushbullet"
+	IntegrationPusher     = "pusher"
+	IntegrationPushover   = "pushover"
+	IntegrationSendgrid   = "sendgrid"
+	IntegrationSlack      = "slack"
+	IntegrationSms        = "sms"
+	IntegrationSMTP       = "smtp"
+	IntegrationTelegram   = "telegram"
+	IntegrationWebhook    = "webhook"
+)
+
+// Notifier is implemented by every integration, so a message can be delivered
+// to any channel without knowing which integration is behind it
+type Notifier interface {
+	Send(ctx context.Context, message models.Message) (DeliveryResult, error)
+}
+
+// Make sure all integrations implement the Notifier interface
+var (
+	_ Notifier = Alexa{}
+	_ Notifier = Ifttt{}
+	_ Notifier = Mail{}
+	_ Notifier = (*Mongodb)(nil)
+	_ Notifier = MQTT{}
+	_ Notifier = Pushbullet{}
+	_ Notifier = Pusher{}
+	_ Notifier = Pushover{}
+	_ Notifier = Sendgrid{}
+	_ Notifier = (*Slack)(nil)
+	_ Notifier = Sms{}
+	_ Notifier = (*SMTP)(nil)
+	_ Notifier = Telegram{}
+	_ Notifier = (*Webhook)(nil)
+)
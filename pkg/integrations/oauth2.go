@@ -0,0 +1,139 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryMargin is the time before its expiry an access token is refreshed, at most half its lifetime
+const tokenExpiryMargin = time.Minute
+
+// defaultTokenLifetime is the lifetime of an access token when the token response has no expires_in
+const defaultTokenLifetime = time.Hour
+
+// TokenSource returns OAuth2 access tokens, e.g. for XOAUTH2 authentication
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenSourceFunc is an adapter to use a function as TokenSource
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+// Token implements TokenSource interface
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// OAuth2Options holds the configuration of the token endpoint access tokens are requested at,
+// e.g. https://oauth2.googleapis.com/token or https://login.microsoftonline.com/<tenant>/oauth2/v2.0/token
+type OAuth2Options struct {
+	TokenURL     string `json:"token_url,omitempty" validate:"required_with=ClientID,omitempty,url"`
+	ClientID     string `json:"client_id,omitempty" validate:"required_with=TokenURL"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	// RefreshToken requests the access tokens with the refresh_token grant, on behalf of a user.
+	// Without refresh token, the client_credentials grant is used.
+	RefreshToken string   `json:"refresh_token,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+// OAuth2TokenSource requests access tokens at the token endpoint, and caches them until shortly
+// before they expire
+type OAuth2TokenSource struct {
+	options OAuth2Options
+	client  *http.Client
+
+	mu           sync.Mutex
+	token        string
+	expiry       time.Time
+	refreshToken string
+}
+
+// NewOAuth2TokenSource creates a token source for the token endpoint
+func NewOAuth2TokenSource(opts OAuth2Options) *OAuth2TokenSource {
+	return &OAuth2TokenSource{
+		options:      opts,
+		client:       http.DefaultClient,
+		refreshToken: opts.RefreshToken,
+	}
+}
+
+// Token implements TokenSource interface, it returns the cached access token or requests a new one
+func (s *OAuth2TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expiry) {
+		return s.token, nil
+	}
+
+	form := url.Values{"client_id": {s.options.ClientID}}
+	if s.options.ClientSecret != "" {
+		form.Set("client_secret", s.options.ClientSecret)
+	}
+	if s.refreshToken != "" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", s.refreshToken)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if len(s.options.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.options.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.options.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		RefreshToken     string `json:"refresh_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("oauth2: invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if token.Error != "" {
+			return "", fmt.Errorf("oauth2: token request failed with status %s: %s %s", resp.Status, token.Error, token.ErrorDescription)
+		}
+		return "", fmt.Errorf("oauth2: token request failed with status: %s", resp.Status)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("oauth2: no access token in the token response")
+	}
+
+	s.token = token.AccessToken
+	lifetime := time.Duration(token.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+	s.expiry = time.Now().Add(lifetime - min(tokenExpiryMargin, lifetime/2))
+	// The authorization server can rotate the refresh token
+	if token.RefreshToken != "" && s.refreshToken != "" {
+		s.refreshToken = token.RefreshToken
+	}
+	return s.token, nil
+}
+
+// Invalidate drops the cached access token, e.g. when it was rejected, so the next token is requested again
+func (s *OAuth2TokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = ""
+}
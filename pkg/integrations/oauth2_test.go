@@ -0,0 +1,89 @@
+package integrations
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOAuth2TokenSource(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Form.Get("client_id") != "client" || r.Form.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid_client", "error_description": "unknown client"}`))
+			return
+		}
+		switch r.Form.Get("grant_type") {
+		case "refresh_token":
+			// The refresh token is rotated on every request
+			token := r.Form.Get("refresh_token")
+			w.Write([]byte(`{"access_token": "access-` + token + `", "expires_in": 3600, "refresh_token": "` + token + `-next"}`))
+		case "client_credentials":
+			w.Write([]byte(`{"access_token": "access-` + strings.ReplaceAll(r.Form.Get("scope"), " ", "+") + `", "expires_in": 3600}`))
+		}
+	}))
+	defer server.Close()
+
+	tokens := NewOAuth2TokenSource(OAuth2Options{TokenURL: server.URL, ClientID: "client", ClientSecret: "secret", RefreshToken: "refresh"})
+	for i := 0; i < 2; i++ {
+		token, err := tokens.Token(context.Background())
+		if err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		if token != "access-refresh" {
+			t.Errorf("expected the access token got %s", token)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected the token to be cached, got %d requests", requests.Load())
+	}
+	tokens.Invalidate()
+	if token, _ := tokens.Token(context.Background()); token != "access-refresh-next" {
+		t.Errorf("expected a token requested with the rotated refresh token got %s", token)
+	}
+
+	tokens = NewOAuth2TokenSource(OAuth2Options{TokenURL: server.URL, ClientID: "client", ClientSecret: "secret", Scopes: []string{"alerts.write", "alerts.read"}})
+	if token, err := tokens.Token(context.Background()); err != nil || token != "access-alerts.write+alerts.read" {
+		t.Errorf("expected a client credentials token got %s, %v", token, err)
+	}
+
+	tokens = NewOAuth2TokenSource(OAuth2Options{TokenURL: server.URL, ClientID: "unknown"})
+	if _, err := tokens.Token(context.Background()); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("expected the error of the token endpoint got %v", err)
+	}
+}
+
+func TestOAuth2TokenSourceExpiry(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if expiresIn := r.URL.Query().Get("expires_in"); expiresIn != "" {
+			w.Write([]byte(`{"access_token": "access-token", "expires_in": ` + expiresIn + `}`))
+			return
+		}
+		w.Write([]byte(`{"access_token": "access-token"}`))
+	}))
+	defer server.Close()
+
+	// A short lifetime, and no lifetime at all, still cache the token
+	for _, expiresIn := range []string{"30", "60", ""} {
+		requests.Store(0)
+		tokens := NewOAuth2TokenSource(OAuth2Options{TokenURL: server.URL + "?expires_in=" + expiresIn, ClientID: "client"})
+		for i := 0; i < 2; i++ {
+			if _, err := tokens.Token(context.Background()); err != nil {
+				t.Fatalf("expected no error got %v", err)
+			}
+		}
+		if requests.Load() != 1 {
+			t.Errorf("expected the token with expires_in %q to be cached, got %d requests", expiresIn, requests.Load())
+		}
+	}
+}
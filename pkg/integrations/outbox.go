@@ -0,0 +1,524 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/uug-ai/models/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrClaimLost is returned when an outbox entry is no longer claimed by the worker,
+// e.g. when its lease expired and another worker claimed it
+var ErrClaimLost = errors.New("outbox entry is claimed by another worker")
+
+// OutboxStatus is the delivery status of an outbox entry
+type OutboxStatus string
+
+const (
+	// OutboxPending entries are waiting to be delivered
+	OutboxPending OutboxStatus = "pending"
+	// OutboxProcessing entries are claimed by a worker
+	OutboxProcessing OutboxStatus = "processing"
+	// OutboxDelivered entries are delivered
+	OutboxDelivered OutboxStatus = "delivered"
+	// OutboxFailed entries failed permanently, or exhausted their attempts
+	OutboxFailed OutboxStatus = "failed"
+)
+
+// OutboxEntry is a message waiting in the outbox to be delivered to a single channel
+type OutboxEntry struct {
+	Id            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Channel       string             `json:"channel" bson:"channel"`
+	Integration   string             `json:"integration,omitempty" bson:"integration,omitempty"`
+	Message       models.Message     `json:"message" bson:"message"`
+	Status        OutboxStatus       `json:"status" bson:"status"`
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	LastError     string             `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	Failures      []DeliveryFailure  `json:"failures,omitempty" bson:"failures,omitempty"`
+	MessageId     string             `json:"message_id,omitempty" bson:"message_id,omitempty"`
+	ClaimedBy     string             `json:"claimed_by,omitempty" bson:"claimed_by,omitempty"`
+	LeaseUntil    time.Time          `json:"lease_until" bson:"lease_until"`
+	NextAttemptAt time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+	DeliveredAt   time.Time          `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+}
+
+// OutboxStore persists the entries of the outbox
+type OutboxStore interface {
+	// Insert stores new entries
+	Insert(ctx context.Context, entries ...*OutboxEntry) error
+	// Claim atomically claims the next entry which is due, for the given worker until the lease expires.
+	// Entries of which the lease expired are claimed again, e.g. when a worker crashed.
+	// It returns nil when no entry is due.
+	Claim(ctx context.Context, worker string, now time.Time, lease time.Duration) (*OutboxEntry, error)
+	// Update stores the outcome of a delivery, as long as the entry is still claimed by the worker.
+	// It returns ErrClaimLost when it isn't.
+	Update(ctx context.Context, entry *OutboxEntry) error
+}
+
+// OutboxOptions holds the configuration for the Outbox
+type OutboxOptions struct {
+	// Workers is the number of entries delivered in parallel
+	Workers int `json:"workers,omitempty" validate:"gte=1"`
+	// PollInterval is the time a worker waits when there are no entries due
+	PollInterval time.Duration `json:"poll_interval,omitempty" validate:"gt=0"`
+	// Lease is the time an entry is claimed by a worker, after that it is claimed again
+	Lease time.Duration `json:"lease,omitempty" validate:"gt=0"`
+	// Timeout bounds the delivery of a single entry, it must be shorter than the lease
+	Timeout time.Duration `json:"timeout,omitempty" validate:"gt=0,ltfield=Lease"`
+	// MaxAttempts is the number of attempts before an entry is marked as failed
+	MaxAttempts int `json:"max_attempts,omitempty" validate:"gte=1"`
+	// Backoff is the time waited after the first failed attempt, it doubles after every attempt
+	Backoff time.Duration `json:"backoff,omitempty" validate:"gte=0"`
+	// MaxBackoff caps the time waited between two attempts
+	MaxBackoff time.Duration `json:"max_backoff,omitempty" validate:"gte=0"`
+	// DeadLetters stores the entries which failed permanently, optional
+	DeadLetters DeadLetterStore `json:"-"`
+}
+
+// OutboxOptionsBuilder provides a fluent interface for building Outbox options
+type OutboxOptionsBuilder struct {
+	options *OutboxOptions
+}
+
+// NewOutboxOptions creates a new Outbox options builder. By default 4 workers poll every second,
+// and an entry is attempted 5 times with a backoff starting at 30s up to 1h.
+func NewOutboxOptions() *OutboxOptionsBuilder {
+	return &OutboxOptionsBuilder{
+		options: &OutboxOptions{
+			Workers:      4,
+			PollInterval: time.Second,
+			Lease:        2 * time.Minute,
+			Timeout:      30 * time.Second,
+			MaxAttempts:  5,
+			Backoff:      30 * time.Second,
+			MaxBackoff:   time.Hour,
+		},
+	}
+}
+
+// SetWorkers sets the number of entries delivered in parallel
+func (b *OutboxOptionsBuilder) SetWorkers(workers int) *OutboxOptionsBuilder {
+	b.options.Workers = workers
+	return b
+}
+
+// SetPollInterval sets the time a worker waits when there are no entries due
+func (b *OutboxOptionsBuilder) SetPollInterval(interval time.Duration) *OutboxOptionsBuilder {
+	b.options.PollInterval = interval
+	return b
+}
+
+// SetLease sets the time an entry is claimed by a worker
+func (b *OutboxOptionsBuilder) SetLease(lease time.Duration) *OutboxOptionsBuilder {
+	b.options.Lease = lease
+	return b
+}
+
+// SetTimeout sets the timeout of the delivery of a single entry
+func (b *OutboxOptionsBuilder) SetTimeout(timeout time.Duration) *OutboxOptionsBuilder {
+	b.options.Timeout = timeout
+	return b
+}
+
+// SetMaxAttempts sets the number of attempts before an entry is marked as failed
+func (b *OutboxOptionsBuilder) SetMaxAttempts(attempts int) *OutboxOptionsBuilder {
+	b.options.MaxAttempts = attempts
+	return b
+}
+
+// SetBackoff sets the time waited after the first failed attempt
+func (b *OutboxOptionsBuilder) SetBackoff(backoff time.Duration) *OutboxOptionsBuilder {
+	b.options.Backoff = backoff
+	return b
+}
+
+// SetMaxBackoff sets the maximum time waited between two attempts
+func (b *OutboxOptionsBuilder) SetMaxBackoff(backoff time.Duration) *OutboxOptionsBuilder {
+	b.options.MaxBackoff = backoff
+	return b
+}
+
+// SetDeadLetters sets the store the entries which failed permanently are added to
+func (b *OutboxOptionsBuilder) SetDeadLetters(store DeadLetterStore) *OutboxOptionsBuilder {
+	b.options.DeadLetters = store
+	return b
+}
+
+// Build returns the configured OutboxOptions
+func (b *OutboxOptionsBuilder) Build() *OutboxOptions {
+	return b.options
+}
+
+// Outbox stores messages before they are delivered, so they survive a crash of the process.
+// Workers claim the stored messages and deliver them through the channels of the outbox.
+type Outbox struct {
+	options  *OutboxOptions
+	store    OutboxStore
+	channels map[string]Notifier
+	names    []string
+	id       string
+	now      func() time.Time
+}
+
+// NewOutbox creates a new Outbox which stores messages in the provided store
+// and delivers them to the provided channels
+func NewOutbox(opts *OutboxOptions, store OutboxStore, channels ...Channel) (*Outbox, error) {
+	// Validate Outbox configuration
+	validate := validator.New()
+	err := validate.Struct(opts)
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return nil, errors.New("outbox store is required")
+	}
+
+	outbox := &Outbox{
+		options:  opts,
+		store:    store,
+		channels: map[string]Notifier{},
+		id:       primitive.NewObjectID().Hex(),
+		now:      time.Now,
+	}
+	for _, channel := range channels {
+		if channel.Name == "" || channel.Notifier == nil {
+			return nil, errors.New("channel requires a name and a notifier")
+		}
+		if _, ok := outbox.channels[channel.Name]; ok {
+			return nil, fmt.Errorf("channel %s is configured twice", channel.Name)
+		}
+		outbox.channels[channel.Name] = channel.Notifier
+		outbox.names = append(outbox.names, channel.Name)
+	}
+	return outbox, nil
+}
+
+// Enqueue stores the message in the outbox, once for every channel it should be delivered to.
+// Without channels, the message is delivered to all channels of the outbox.
+func (o *Outbox) Enqueue(ctx context.Context, message models.Message, channels ...string) ([]*OutboxEntry, error) {
+	if len(channels) == 0 {
+		channels = o.names
+	}
+
+	now := o.now()
+	entries := make([]*OutboxEntry, 0, len(channels))
+	for _, channel := range channels {
+		if _, ok := o.channels[channel]; !ok {
+			return nil, fmt.Errorf("unknown channel %s", channel)
+		}
+		entries = append(entries, &OutboxEntry{
+			Id:            primitive.NewObjectID(),
+			Channel:       channel,
+			Message:       message,
+			Status:        OutboxPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+	if err := o.store.Insert(ctx, entries...); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Run starts the workers and delivers entries until the context is done
+func (o *Outbox) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < o.options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o.work(ctx, fmt.Sprintf("%s-%d", o.id, i))
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// work delivers entries until the context is done, waiting for the poll interval
+// whenever no entry is due or the store fails
+func (o *Outbox) work(ctx context.Context, worker string) {
+	for ctx.Err() == nil {
+		processed, err := o.process(ctx, worker)
+		if processed && err == nil {
+			continue
+		}
+		if sleep(ctx, o.options.PollInterval) != nil {
+			return
+		}
+	}
+}
+
+// Process claims and delivers a single entry which is due. It reports whether an entry was processed,
+// so the outbox can be drained without running the workers, e.g. from a scheduled job.
+func (o *Outbox) Process(ctx context.Context) (bool, error) {
+	return o.process(ctx, o.id)
+}
+
+// process claims and delivers a single entry for the worker
+func (o *Outbox) process(ctx context.Context, worker string) (bool, error) {
+	entry, err := o.store.Claim(ctx, worker, o.now(), o.options.Lease)
+	if err != nil || entry == nil {
+		return false, err
+	}
+
+	o.deliver(ctx, entry)
+
+	// The outcome is stored, even when the outbox is stopped during the delivery
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.options.Timeout)
+	defer cancel()
+	// When another worker claimed the entry in the meantime, the outcome is up to that worker
+	if err := o.store.Update(ctx, entry); errors.Is(err, ErrClaimLost) {
+		return true, nil
+	} else if err != nil {
+		return true, err
+	}
+
+	// Entries which failed permanently are kept in the dead-letter store, so they can be replayed
+	if entry.Status == OutboxFailed && o.options.DeadLetters != nil {
+		return true, o.options.DeadLetters.Add(ctx, &DeadLetter{
+			Channel:     entry.Channel,
+			Integration: entry.Integration,
+			Message:     entry.Message,
+			Attempts:    entry.Attempts,
+			Failures:    entry.Failures,
+		})
+	}
+	return true, nil
+}
+
+// deliver sends the entry to its channel and records the outcome on the entry
+func (o *Outbox) deliver(ctx context.Context, entry *OutboxEntry) {
+
+	notifier, ok := o.channels[entry.Channel]
+	if !ok {
+		o.fail(entry, DeliveryResult{}, fmt.Errorf("unknown channel %s", entry.Channel), false)
+		return
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, o.options.Timeout)
+	defer cancel()
+	result, err := notifier.Send(sendCtx, entry.Message)
+
+	now := o.now()
+	entry.UpdatedAt = now
+	entry.LeaseUntil = time.Time{}
+	if result.Integration != "" {
+		entry.Integration = result.Integration
+	}
+	if err == nil {
+		entry.Status = OutboxDelivered
+		entry.LastError = ""
+		entry.MessageId = result.MessageId
+		entry.DeliveredAt = now
+		return
+	}
+
+	// The outbox is stopped, the attempt doesn't count
+	if ctx.Err() != nil {
+		entry.Status = OutboxPending
+		entry.Attempts--
+		entry.NextAttemptAt = now
+		return
+	}
+	o.fail(entry, result, err, IsRetryable(result, err))
+}
+
+// fail records a failed attempt, the entry is attempted again after the backoff
+// if the error is retryable and it has attempts left
+func (o *Outbox) fail(entry *OutboxEntry, result DeliveryResult, err error, retryable bool) {
+	now := o.now()
+	entry.UpdatedAt = now
+	entry.LeaseUntil = time.Time{}
+	entry.LastError = err.Error()
+	entry.Failures = append(entry.Failures, DeliveryFailure{
+		Attempt:    entry.Attempts,
+		StatusCode: result.StatusCode,
+		Error:      err.Error(),
+		At:         now,
+	})
+	if !retryable || entry.Attempts >= o.options.MaxAttempts {
+		entry.Status = OutboxFailed
+		return
+	}
+
+	backoff := o.options.Backoff
+	for i := 1; i < entry.Attempts && (o.options.MaxBackoff == 0 || backoff < o.options.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if o.options.MaxBackoff > 0 && backoff > o.options.MaxBackoff {
+		backoff = o.options.MaxBackoff
+	}
+	entry.Status = OutboxPending
+	entry.NextAttemptAt = now.Add(backoff)
+}
+
+// OutboxCollection is the MongoDB collection the outbox is stored in
+const OutboxCollection = "outbox"
+
+// MongoOutboxStore stores the outbox in MongoDB
+type MongoOutboxStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoOutboxStore creates an OutboxStore on the outbox collection of the MongoDB integration,
+// it uses the shared client of New when the integration has no client
+func NewMongoOutboxStore(mongodb *Mongodb) *MongoOutboxStore {
+	return &MongoOutboxStore{
+		collection: mongodb.client().Database(DatabaseName).Collection(OutboxCollection),
+	}
+}
+
+// EnsureIndexes creates the index used to claim entries
+func (s *MongoOutboxStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+	})
+	return err
+}
+
+// Insert implements OutboxStore
+func (s *MongoOutboxStore) Insert(ctx context.Context, entries ...*OutboxEntry) error {
+	documents := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		documents = append(documents, entry)
+	}
+	if len(documents) == 0 {
+		return nil
+	}
+	_, err := s.collection.InsertMany(ctx, documents)
+	return err
+}
+
+// Claim implements OutboxStore
+func (s *MongoOutboxStore) Claim(ctx context.Context, worker string, now time.Time, lease time.Duration) (*OutboxEntry, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": OutboxPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"status": OutboxProcessing, "lease_until": bson.M{"$lt": now}},
+	}}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      OutboxProcessing,
+			"claimed_by":  worker,
+			"lease_until": now.Add(lease),
+			"updated_at":  now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	entry := &OutboxEntry{}
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Update implements OutboxStore
+func (s *MongoOutboxStore) Update(ctx context.Context, entry *OutboxEntry) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": entry.Id, "claimed_by": entry.ClaimedBy}, entry)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrClaimLost
+	}
+	return nil
+}
+
+// MemoryOutboxStore stores the outbox in memory, it is meant for tests
+// and for processes which don't need to survive a restart
+type MemoryOutboxStore struct {
+	mu      sync.Mutex
+	entries map[primitive.ObjectID]OutboxEntry
+}
+
+// NewMemoryOutboxStore creates an empty in-memory OutboxStore
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{
+		entries: map[primitive.ObjectID]OutboxEntry{},
+	}
+}
+
+// Insert implements OutboxStore
+func (s *MemoryOutboxStore) Insert(ctx context.Context, entries ...*OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		if entry.Id.IsZero() {
+			entry.Id = primitive.NewObjectID()
+		}
+		s.entries[entry.Id] = *entry
+	}
+	return nil
+}
+
+// Claim implements OutboxStore
+func (s *MemoryOutboxStore) Claim(ctx context.Context, worker string, now time.Time, lease time.Duration) (*OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due *OutboxEntry
+	for _, entry := range s.entries {
+		isDue := entry.Status == OutboxPending && !entry.NextAttemptAt.After(now) ||
+			entry.Status == OutboxProcessing && entry.LeaseUntil.Before(now)
+		if isDue && (due == nil || entry.NextAttemptAt.Before(due.NextAttemptAt)) {
+			due = &entry
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+
+	due.Status = OutboxProcessing
+	due.ClaimedBy = worker
+	due.LeaseUntil = now.Add(lease)
+	due.UpdatedAt = now
+	due.Attempts++
+	s.entries[due.Id] = *due
+	return due, nil
+}
+
+// Update implements OutboxStore
+func (s *MemoryOutboxStore) Update(ctx context.Context, entry *OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.entries[entry.Id]; !ok || stored.ClaimedBy != entry.ClaimedBy {
+		return ErrClaimLost
+	}
+	s.entries[entry.Id] = *entry
+	return nil
+}
+
+// Entries returns all entries of the outbox, sorted by creation time
+func (s *MemoryOutboxStore) Entries() []OutboxEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]OutboxEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt) ||
+			entries[i].CreatedAt.Equal(entries[j].CreatedAt) && entries[i].Id.Hex() < entries[j].Id.Hex()
+	})
+	return entries
+}
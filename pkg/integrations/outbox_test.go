@@ -0,0 +1,254 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestOutboxOptionsValidation(t *testing.T) {
+	store := NewMemoryOutboxStore()
+	if _, err := NewOutbox(NewOutboxOptions().Build(), store); err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+	if _, err := NewOutbox(NewOutboxOptions().SetTimeout(time.Hour).Build(), store); err == nil {
+		t.Errorf("expected error for a timeout longer than the lease got nil")
+	}
+	if _, err := NewOutbox(NewOutboxOptions().Build(), nil); err == nil {
+		t.Errorf("expected error for missing store got nil")
+	}
+	slack := Channel{Name: "slack", Notifier: notifierFunc(nil)}
+	if _, err := NewOutbox(NewOutboxOptions().Build(), store, slack, slack); err == nil {
+		t.Errorf("expected error for duplicate channel got nil")
+	}
+}
+
+func TestOutboxEnqueue(t *testing.T) {
+	store := NewMemoryOutboxStore()
+	outbox, err := NewOutbox(NewOutboxOptions().Build(), store,
+		Channel{Name: "slack", Notifier: notifierFunc(nil)},
+		Channel{Name: "smtp", Notifier: notifierFunc(nil)},
+	)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	entries, err := outbox.Enqueue(context.Background(), models.Message{Title: "Motion detected"})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if len(entries) != 2 || len(store.Entries()) != 2 {
+		t.Fatalf("expected an entry per channel got %d", len(entries))
+	}
+	for _, entry := range store.Entries() {
+		if entry.Status != OutboxPending || entry.Message.Title != "Motion detected" {
+			t.Errorf("expected pending entry got %+v", entry)
+		}
+	}
+
+	if _, err := outbox.Enqueue(context.Background(), models.Message{}, "telegram"); err == nil {
+		t.Errorf("expected error for unknown channel got nil")
+	}
+}
+
+func TestOutboxProcess(t *testing.T) {
+	var webhookCalls int
+	webhook := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		start := time.Now()
+		webhookCalls++
+		result := DeliveryResult{Integration: IntegrationWebhook, StatusCode: http.StatusServiceUnavailable}
+		if webhookCalls < 2 {
+			return result.done(start, errors.New("webhook request failed with status: 503"))
+		}
+		result.StatusCode = http.StatusOK
+		result.MessageId = "webhook-1"
+		return result.done(start, nil)
+	})
+	smtp := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		start := time.Now()
+		result := DeliveryResult{Integration: IntegrationSMTP, StatusCode: http.StatusBadRequest}
+		return result.done(start, errors.New("invalid recipient"))
+	})
+
+	store := NewMemoryOutboxStore()
+	outbox, err := NewOutbox(NewOutboxOptions().SetBackoff(time.Minute).Build(), store,
+		Channel{Name: "webhook", Notifier: webhook},
+		Channel{Name: "smtp", Notifier: smtp},
+	)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	now := time.Now()
+	outbox.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := outbox.Enqueue(ctx, models.Message{Title: "Motion detected"}); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if processed, err := outbox.Process(ctx); !processed || err != nil {
+			t.Fatalf("expected entry to be processed got %v %v", processed, err)
+		}
+	}
+	if processed, _ := outbox.Process(ctx); processed {
+		t.Fatalf("expected no entry to be due")
+	}
+
+	entries := map[string]OutboxEntry{}
+	for _, entry := range store.Entries() {
+		entries[entry.Channel] = entry
+	}
+	if entries["smtp"].Status != OutboxFailed || entries["smtp"].LastError == "" {
+		t.Errorf("expected smtp to fail permanently got %+v", entries["smtp"])
+	}
+	if entries["webhook"].Status != OutboxPending || entries["webhook"].Attempts != 1 {
+		t.Errorf("expected webhook to be pending for a retry got %+v", entries["webhook"])
+	}
+	if !entries["webhook"].NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected webhook to be retried after 1m got %s", entries["webhook"].NextAttemptAt)
+	}
+
+	// The webhook is delivered after the backoff
+	now = now.Add(time.Minute)
+	if processed, err := outbox.Process(ctx); !processed || err != nil {
+		t.Fatalf("expected entry to be processed got %v %v", processed, err)
+	}
+	for _, entry := range store.Entries() {
+		if entry.Channel == "webhook" {
+			if entry.Status != OutboxDelivered || entry.Attempts != 2 || entry.MessageId != "webhook-1" || entry.LastError != "" {
+				t.Errorf("expected webhook to be delivered got %+v", entry)
+			}
+		}
+	}
+}
+
+func TestOutboxMaxAttempts(t *testing.T) {
+	failing := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		start := time.Now()
+		result := DeliveryResult{Integration: IntegrationSlack, StatusCode: http.StatusBadGateway}
+		return result.done(start, errors.New("bad gateway"))
+	})
+
+	store := NewMemoryOutboxStore()
+	outbox, err := NewOutbox(NewOutboxOptions().SetMaxAttempts(2).SetBackoff(0).Build(), store,
+		Channel{Name: "slack", Notifier: failing},
+	)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	outbox.Enqueue(context.Background(), models.Message{})
+	for {
+		if processed, _ := outbox.Process(context.Background()); !processed {
+			break
+		}
+	}
+	entry := store.Entries()[0]
+	if entry.Status != OutboxFailed || entry.Attempts != 2 {
+		t.Errorf("expected entry to fail after 2 attempts got %+v", entry)
+	}
+}
+
+func TestOutboxReclaimsExpiredLease(t *testing.T) {
+	store := NewMemoryOutboxStore()
+	now := time.Now()
+	store.Insert(context.Background(), &OutboxEntry{Channel: "slack", Status: OutboxPending, NextAttemptAt: now})
+
+	// A worker claims the entry and crashes
+	if entry, _ := store.Claim(context.Background(), "crashed", now, time.Minute); entry == nil {
+		t.Fatalf("expected entry to be claimed")
+	}
+	if entry, _ := store.Claim(context.Background(), "worker", now, time.Minute); entry != nil {
+		t.Fatalf("expected claimed entry not to be claimed again before the lease expires")
+	}
+	entry, _ := store.Claim(context.Background(), "worker", now.Add(2*time.Minute), time.Minute)
+	if entry == nil || entry.ClaimedBy != "worker" || entry.Attempts != 2 {
+		t.Fatalf("expected entry to be claimed again got %+v", entry)
+	}
+
+	// The crashed worker can no longer overwrite the entry
+	stale := *entry
+	stale.ClaimedBy = "crashed"
+	stale.Status = OutboxFailed
+	if err := store.Update(context.Background(), &stale); !errors.Is(err, ErrClaimLost) {
+		t.Errorf("expected ErrClaimLost got %v", err)
+	}
+	if store.Entries()[0].Status != OutboxProcessing {
+		t.Errorf("expected stale update to be ignored got %s", store.Entries()[0].Status)
+	}
+}
+
+func TestOutboxClaimLost(t *testing.T) {
+	store := NewMemoryOutboxStore()
+	deadLetters := NewMemoryDeadLetterStore()
+	// The lease expires during the delivery, another worker claims the entry before it fails permanently
+	failing := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		start := time.Now()
+		if entry, _ := store.Claim(ctx, "other", time.Now().Add(time.Hour), time.Minute); entry == nil {
+			t.Errorf("expected the entry to be claimed by the other worker")
+		}
+		result := DeliveryResult{Integration: IntegrationSlack, StatusCode: http.StatusBadRequest}
+		return result.done(start, errors.New("bad request"))
+	})
+	outbox, err := NewOutbox(NewOutboxOptions().SetDeadLetters(deadLetters).Build(), store,
+		Channel{Name: "slack", Notifier: failing},
+	)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	outbox.Enqueue(context.Background(), models.Message{})
+
+	if processed, err := outbox.Process(context.Background()); !processed || err != nil {
+		t.Fatalf("expected the entry to be processed got %v, %v", processed, err)
+	}
+	if entry := store.Entries()[0]; entry.Status != OutboxProcessing || entry.ClaimedBy != "other" {
+		t.Errorf("expected the entry to stay claimed by the other worker got %+v", entry)
+	}
+	if letters, _ := deadLetters.List(context.Background(), DeadLetterFilter{}); len(letters) != 0 {
+		t.Errorf("expected no dead letter for a lost claim got %d", len(letters))
+	}
+}
+
+func TestOutboxRun(t *testing.T) {
+	var delivered atomic.Int32
+	notifier := notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		delivered.Add(1)
+		return DeliveryResult{Integration: IntegrationTelegram}, nil
+	})
+
+	store := NewMemoryOutboxStore()
+	outbox, err := NewOutbox(NewOutboxOptions().SetWorkers(3).SetPollInterval(time.Millisecond).Build(), store,
+		Channel{Name: "telegram", Notifier: notifier},
+	)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		outbox.Enqueue(context.Background(), models.Message{})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- outbox.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for delivered.Load() < 10 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled got %v", err)
+	}
+	if delivered.Load() != 10 {
+		t.Errorf("expected 10 deliveries got %d", delivered.Load())
+	}
+	for _, entry := range store.Entries() {
+		if entry.Status != OutboxDelivered {
+			t.Errorf("expected all entries to be delivered got %s", entry.Status)
+		}
+	}
+}
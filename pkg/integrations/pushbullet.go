@@ -1,44 +1,74 @@
 package integrations
 
 import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/uug-ai/integrations/pkg/templates"
 	"github.com/uug-ai/models/pkg/models"
 	pushb "github.com/xconstruct/go-pushbullet"
 )
 
 type Pushbullet struct {
-	ApiKey string `json:"api_key,omitempty"`
+	ApiKey string `json:"api_key,omitempty" validate:"required"`
 }
 
-func (pushbullet Pushbullet) SendLink(message models.Message) bool {
-
-	// Instantiate a client
-	pb := pushb.New(pushbullet.ApiKey)
+func init() {
+	MustRegister(IntegrationPushbullet, DecodeJSON[Pushbullet], validated[Pushbullet])
+}
 
-	// Get all the devices
-	devs, err := pb.Devices()
-	if err == nil {
-		// Send a message to the first device
-		for _, dev := range devs {
-			pb.PushLink(dev.Iden, message.Title, message.Media[0].AtRuntimeMetadata.VideoUrl, message.Body)
-		}
+// Send pushes a link to the recording when the message has media attached,
+// otherwise a note with the title and body of the message
+func (pushbullet Pushbullet) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+	if templates.VideoUrl(message) != "" {
+		return pushbullet.SendLink(ctx, message)
 	}
+	return pushbullet.SendMessage(ctx, message)
+}
+
+// SendLink pushes a link to the recording to all devices of the account
+func (pushbullet Pushbullet) SendLink(ctx context.Context, message models.Message) (DeliveryResult, error) {
+	link := templates.VideoUrl(message)
+	return pushbullet.push(ctx, func(pb *pushb.Client, dev *pushb.Device) error {
+		return pb.PushLink(dev.Iden, message.Title, link, message.Body)
+	})
+}
 
-	return true
+// SendMessage pushes a note to all devices of the account
+func (pushbullet Pushbullet) SendMessage(ctx context.Context, message models.Message) (DeliveryResult, error) {
+	return pushbullet.push(ctx, func(pb *pushb.Client, dev *pushb.Device) error {
+		return pb.PushNote(dev.Iden, message.Title, message.Body)
+	})
 }
 
-func (pushbullet Pushbullet) SendMessage(message models.Message) bool {
+// push runs send for every device of the account. The devices that accepted
+// the push are reported as recipients, failing devices are reported as error.
+func (pushbullet Pushbullet) push(ctx context.Context, send func(pb *pushb.Client, dev *pushb.Device) error) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationPushbullet}
 
 	// Instantiate a client
-	pb := pushb.New(pushbullet.ApiKey)
+	pb := pushb.NewWithClient(pushbullet.ApiKey, contextHTTPClient(ctx))
 
 	// Get all the devices
 	devs, err := pb.Devices()
-	if err == nil {
-		// Send a message to the first device
-		for _, dev := range devs {
-			pb.PushNote(dev.Iden, message.Title, message.Body)
+	if err != nil {
+		return result.done(start, err)
+	}
+	if len(devs) == 0 {
+		return result.done(start, errors.New("no pushbullet devices found"))
+	}
+
+	var errs []error
+	for _, dev := range devs {
+		if err := send(pb, dev); err != nil {
+			errs = append(errs, err)
+			continue
 		}
+		result.Recipients = append(result.Recipients, dev.Iden)
 	}
 
-	return true
+	return result.done(start, errors.Join(errs...))
 }
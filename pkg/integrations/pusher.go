@@ -1,9 +1,12 @@
 package integrations
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	push "github.com/pusher/pusher-http-go"
+	"github.com/uug-ai/integrations/pkg/templates"
 	"github.com/uug-ai/models/pkg/models"
 )
 
@@ -46,46 +49,68 @@ type PusherMedia struct {
 }
 
 type Pusher struct {
-	Channel string `json:"channel,omitempty"`
+	Channel string `json:"channel,omitempty" validate:"required"`
 }
 
-func (pusher Pusher) SendNotification(message models.Message) bool {
+func init() {
+	MustRegister(IntegrationPusher, DecodeJSON[Pusher], validated[Pusher])
+}
+
+// SendNotification triggers the message in the sequence format expected by the web interface
+func (pusher Pusher) SendNotification(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationPusher}
 
 	// instantiate a client
 	client := push.Client{
-		AppID:   "256802",
-		Key:     "dbfbe47444eddb7e21e5",
-		Secret:  "57e0315f3e4246225e62",
-		Cluster: "eu",
+		AppID:      "256802",
+		Key:        "dbfbe47444eddb7e21e5",
+		Secret:     "57e0315f3e4246225e62",
+		Cluster:    "eu",
+		HTTPClient: contextHTTPClient(ctx),
 	}
 
 	pusherMessage := PusherMessageWrapper{}
 	pusherMessage.Sequence.Title = message.Title
 	pusherMessage.Sequence.Text = message.Body
 	pusherMessage.Sequence.Media = []PusherMedia{}
-	pusherMessage.Sequence.Media = append(pusherMessage.Sequence.Media, PusherMedia{
-		Title: fmt.Sprintf("%v", message.Media[0].StartTimestamp),
-		Media: message.Media[0].AtRuntimeMetadata.VideoUrl,
-	})
+	if len(message.Media) > 0 {
+		pusherMessage.Sequence.Media = append(pusherMessage.Sequence.Media, PusherMedia{
+			Title: fmt.Sprintf("%v", message.Media[0].StartTimestamp),
+			Media: templates.VideoUrl(message),
+		})
+	}
 
 	// trigger an event on the users channel, along with a data payload.
-	client.Trigger(message.User, pusher.Channel, pusherMessage)
+	if err := client.Trigger(message.User, pusher.Channel, pusherMessage); err != nil {
+		return result.done(start, err)
+	}
 
-	return true
+	result.Recipients = []string{message.User}
+	return result.done(start, nil)
 }
 
-func (pusher Pusher) Send(message models.Message) bool {
+// Send triggers the message as-is on the channel of the user
+func (pusher Pusher) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationPusher}
 
 	// instantiate a client
 	client := push.Client{
-		AppID:   "256802",
-		Key:     "dbfbe47444eddb7e21e5",
-		Secret:  "57e0315f3e4246225e62",
-		Cluster: "eu",
+		AppID:      "256802",
+		Key:        "dbfbe47444eddb7e21e5",
+		Secret:     "57e0315f3e4246225e62",
+		Cluster:    "eu",
+		HTTPClient: contextHTTPClient(ctx),
 	}
 
 	// trigger an event on the users channel, along with a data payload.
-	client.Trigger(message.User, pusher.Channel, message)
+	if err := client.Trigger(message.User, pusher.Channel, message); err != nil {
+		return result.done(start, err)
+	}
 
-	return true
+	result.Recipients = []string{message.User}
+	return result.done(start, nil)
 }
@@ -18,5 +18,5 @@ package integrations
 	pusher := Pusher{
 		Channel: "notification",
 	}
-	pusher.Send(m)
+	pusher.Send(context.Background(), m)
 }*/
@@ -1,31 +1,126 @@
 package integrations
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
-	pusho "github.com/gregdel/pushover"
+	"github.com/uug-ai/integrations/pkg/format"
+	"github.com/uug-ai/integrations/pkg/templates"
 	"github.com/uug-ai/models/pkg/models"
 )
 
+// pushoverEndpoint is the Pushover messages API endpoint
+var pushoverEndpoint = "https://api.pushover.net/1/messages.json"
+
 type Pushover struct {
-	ApiKey string `json:"api_key,omitempty"`
-	SendTo string `json:"send_to,omitempty"`
+	ApiKey string `json:"api_key,omitempty" validate:"required"`
+	SendTo string `json:"send_to,omitempty" validate:"required"`
+	// TitleTemplate and BodyTemplate render the title and body of the message,
+	// see the templates package for the variables
+	TitleTemplate string `json:"title_template,omitempty"`
+	BodyTemplate  string `json:"body_template,omitempty"`
+	// TemplateId is the named template the message is rendered with, from its subject and short
+	// variants. It takes precedence over the title and body templates.
+	TemplateId string `json:"template_id,omitempty"`
+	// Templates is the store of the named template, defaults to TemplateStore
+	Templates templates.Store `json:"-"`
+
+	template *messageTemplate
 }
 
-func (pushover Pushover) Send(m models.Message) bool {
-	// Create a new pushover app with a token
-	app := pusho.New(pushover.ApiKey)
+func init() {
+	MustRegister(IntegrationPushover, DecodeJSON[Pushover], func(pushover Pushover) (Notifier, error) {
+		return NewPushover(pushover)
+	})
+}
 
-	// Create a new recipient
-	recipient := pusho.NewRecipient(pushover.SendTo)
+// NewPushover validates the configuration of Pushover and parses its title and body templates,
+// so they aren't parsed again for every message
+func NewPushover(pushover Pushover) (Pushover, error) {
+	if _, err := validated(pushover); err != nil {
+		return pushover, err
+	}
+	tmpl, err := newMessageTemplate(pushover.TitleTemplate, pushover.BodyTemplate)
+	if err != nil {
+		return pushover, err
+	}
+	pushover.template = &tmpl
+	return pushover, nil
+}
+
+// pushoverResponse is the response of the Pushover messages API
+type pushoverResponse struct {
+	Status  int      `json:"status"`
+	Request string   `json:"request"`
+	Errors  []string `json:"errors"`
+}
+
+// Destination implements Destination, it returns the user or group key the messages are sent to
+func (pushover Pushover) Destination() string {
+	return pushover.SendTo
+}
 
-	// Create the message to send
-	mess := pusho.NewMessage(m.Title + " " + m.Body)
+func (pushover Pushover) Send(ctx context.Context, m models.Message) (DeliveryResult, error) {
 
-	_, err := app.SendMessage(mess, recipient)
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationPushover}
+
+	// Create the message to send, for the app (token) and recipient (user). The message is converted
+	// to plain text and truncated to the limits of Pushover, which rejects longer messages.
+	values := url.Values{}
+	values.Set("token", pushover.ApiKey)
+	values.Set("user", pushover.SendTo)
+	if pushover.TemplateId != "" {
+		rendered, _, err := renderNamed(ctx, pushover.Templates, pushover.TemplateId, templates.VariantShort, m)
+		if err != nil {
+			return result.done(start, err)
+		}
+		values.Set("title", format.TruncateText(rendered.Title, format.PushoverTitleMaxLength))
+		values.Set("message", format.Pushover.Render(rendered.Body)[0])
+	} else {
+		tmpl, err := parsedTemplate(pushover.template, pushover.TitleTemplate, pushover.BodyTemplate)
+		if err != nil {
+			return result.done(start, err)
+		}
+		rendered, err := tmpl.render(m)
+		if err != nil {
+			return result.done(start, err)
+		}
+		values.Set("message", format.Pushover.Render(rendered.Title + " " + rendered.Body)[0])
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", pushoverEndpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return result.done(start, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		fmt.Println(err)
+		return result.done(start, err)
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	response := pushoverResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil && resp.StatusCode < 500 {
+		return result.done(start, err)
+	}
+	result.MessageId = response.Request
+
+	// Pushover reports a status of 1 when the message was accepted
+	if response.Status != 1 {
+		if len(response.Errors) > 0 {
+			return result.done(start, fmt.Errorf("pushover request failed: %s", strings.Join(response.Errors, ", ")))
+		}
+		return result.done(start, fmt.Errorf("pushover request failed with status: %s", resp.Status))
 	}
 
-	return true
+	result.Recipients = []string{pushover.SendTo}
+	return result.done(start, nil)
 }
@@ -1,5 +1,98 @@
 package integrations
 
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/uug-ai/integrations/pkg/format"
+	"github.com/uug-ai/integrations/pkg/templates"
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestPushoverTemplates(t *testing.T) {
+	var received, title string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		received = r.PostForm.Get("message")
+		title = r.PostForm.Get("title")
+		w.Write([]byte(`{"status":1,"request":"request-1"}`))
+	}))
+	defer server.Close()
+
+	endpoint := pushoverEndpoint
+	pushoverEndpoint = server.URL
+	defer func() { pushoverEndpoint = endpoint }()
+
+	pushover := Pushover{
+		ApiKey:        "token",
+		SendTo:        "user",
+		TitleTemplate: "{{devicename}}:",
+		BodyTemplate:  "{{default \"motion\" classifications}} at {{eventtime}}",
+	}
+	result, err := pushover.Send(context.Background(), models.Message{DeviceName: "Front door", Timestamp: 1700000000})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if result.MessageId != "request-1" {
+		t.Errorf("expected message id request-1, got %q", result.MessageId)
+	}
+	if received != "Front door: motion at 22:13:20" {
+		t.Errorf("expected rendered message, got %q", received)
+	}
+
+	pushover.BodyTemplate = "{{end}}"
+	if _, err := pushover.Send(context.Background(), models.Message{}); err == nil {
+		t.Errorf("expected an error for an invalid template")
+	}
+
+	// Built from its configuration, the templates are parsed once
+	if _, err := Build(IntegrationPushover, []byte(`{"api_key": "token", "send_to": "user", "body_template": "{{end}}"}`)); err == nil {
+		t.Errorf("expected an error for an invalid template")
+	}
+	notifier, err := Build(IntegrationPushover, []byte(`{"api_key": "token", "send_to": "user", "title_template": "{{devicename}}:", "body_template": "{{text}}"}`))
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if notifier.(Pushover).template == nil {
+		t.Errorf("expected the templates to be parsed")
+	}
+	if _, err := notifier.Send(context.Background(), models.Message{DeviceName: "Front door", Body: "motion"}); err != nil || received != "Front door: motion" {
+		t.Errorf("expected rendered message, got %q, %v", received, err)
+	}
+
+	// A named template is rendered from its subject and short variants
+	store := templates.NewMemoryStore(nil)
+	store.Add(templates.Definition{Id: "motion", Variants: map[string]string{
+		templates.VariantSubject: "{{devicename}}",
+		templates.VariantText:    "{{devicename}} detected {{classifications}} and more",
+		templates.VariantShort:   "{{classifications}}",
+	}})
+	pushover.TemplateId = "motion"
+	pushover.Templates = store
+	message := models.Message{DeviceName: "Front door", Classifications: []string{"person"}}
+	if _, err := pushover.Send(context.Background(), message); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if title != "Front door" || received != "person" {
+		t.Errorf("expected rendered title and message, got %q and %q", title, received)
+	}
+
+	// A message longer than Pushover accepts is converted to plain text and truncated
+	pushover.TemplateId = ""
+	pushover.TitleTemplate = ""
+	pushover.BodyTemplate = ""
+	message = models.Message{Title: "**Motion**", Body: strings.Repeat("detected ", 200)}
+	if _, err := pushover.Send(context.Background(), message); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if format.Length(received) > format.PushoverMaxLength || !strings.HasPrefix(received, "Motion detected") || !strings.HasSuffix(received, format.Ellipsis) {
+		t.Errorf("expected a truncated plain text message, got %q", received)
+	}
+}
+
 /*func TestPushover(t *testing.T) {
 	m := models.Message{}
 	m.Type = "message"
@@ -19,5 +112,5 @@ package integrations
 		ApiKey: "xxx",
 		SendTo: "xxx",
 	}
-	pushover.Send(m)
+	pushover.Send(context.Background(), m)
 }*/
@@ -0,0 +1,294 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// ErrRateLimited is returned when a message is not sent because the rate limit of its destination is exceeded
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Destination is implemented by integrations which deliver to a fixed destination,
+// such as a webhook URL, chat ID or phone number. It is used to key rate limits.
+type Destination interface {
+	Destination() string
+}
+
+// RateLimitMode defines what happens with a message when the rate limit is exceeded
+type RateLimitMode string
+
+const (
+	// RateLimitDrop drops the message immediately with ErrRateLimited
+	RateLimitDrop RateLimitMode = "drop"
+	// RateLimitDelay waits until the message can be sent, for at most MaxDelay
+	RateLimitDelay RateLimitMode = "delay"
+	// RateLimitQueue waits in line until the message can be sent, with at most QueueSize messages waiting per destination
+	RateLimitQueue RateLimitMode = "queue"
+)
+
+// RateLimit allows Count messages per Interval, with bursts of at most Burst messages
+type RateLimit struct {
+	Count    int           `json:"count" validate:"gte=1"`
+	Interval time.Duration `json:"interval" validate:"gt=0"`
+	// Burst defaults to Count
+	Burst int `json:"burst,omitempty" validate:"gte=0"`
+}
+
+// rate returns the number of tokens added per second
+func (l RateLimit) rate() float64 {
+	return float64(l.Count) / l.Interval.Seconds()
+}
+
+// burst returns the size of the bucket
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Count)
+}
+
+// RateLimiterOptions holds the configuration for the RateLimiter
+type RateLimiterOptions struct {
+	// Limits holds the limit of every destination per integration name, e.g. IntegrationTelegram
+	Limits map[string]RateLimit `json:"limits,omitempty" validate:"dive"`
+	// Default is the limit for integrations without a limit in Limits, nil means unlimited
+	Default *RateLimit `json:"default,omitempty"`
+	// Mode defines what happens with a message when the limit is exceeded
+	Mode RateLimitMode `json:"mode,omitempty" validate:"oneof=drop delay queue"`
+	// MaxDelay is the longest a message is delayed in RateLimitDelay mode, zero means no maximum
+	MaxDelay time.Duration `json:"max_delay,omitempty" validate:"gte=0"`
+	// QueueSize is the maximum number of messages waiting per destination in RateLimitQueue mode, zero means no maximum
+	QueueSize int `json:"queue_size,omitempty" validate:"gte=0"`
+}
+
+// RateLimiterOptionsBuilder provides a fluent interface for building rate limiter options
+type RateLimiterOptionsBuilder struct {
+	options *RateLimiterOptions
+}
+
+// NewRateLimiterOptions creates a new rate limiter options builder. By default it applies the limits
+// documented by the providers (Telegram 20 messages per minute per chat, Slack 1 message per second
+// per webhook, Twilio 1 SMS per second per number) and delays messages for at most 30 seconds.
+func NewRateLimiterOptions() *RateLimiterOptionsBuilder {
+	return &RateLimiterOptionsBuilder{
+		options: &RateLimiterOptions{
+			Limits: map[string]RateLimit{
+				IntegrationTelegram: {Count: 20, Interval: time.Minute, Burst: 3},
+				IntegrationSlack:    {Count: 1, Interval: time.Second, Burst: 3},
+				IntegrationSms:      {Count: 1, Interval: time.Second},
+			},
+			Mode:     RateLimitDelay,
+			MaxDelay: 30 * time.Second,
+		},
+	}
+}
+
+// SetLimit sets the limit of every destination of the given integration
+func (b *RateLimiterOptionsBuilder) SetLimit(integration string, limit RateLimit) *RateLimiterOptionsBuilder {
+	b.options.Limits[integration] = limit
+	return b
+}
+
+// SetDefault sets the limit for integrations without their own limit
+func (b *RateLimiterOptionsBuilder) SetDefault(limit RateLimit) *RateLimiterOptionsBuilder {
+	b.options.Default = &limit
+	return b
+}
+
+// SetMode sets what happens with a message when the limit is exceeded
+func (b *RateLimiterOptionsBuilder) SetMode(mode RateLimitMode) *RateLimiterOptionsBuilder {
+	b.options.Mode = mode
+	return b
+}
+
+// SetMaxDelay sets the longest a message is delayed in RateLimitDelay mode
+func (b *RateLimiterOptionsBuilder) SetMaxDelay(delay time.Duration) *RateLimiterOptionsBuilder {
+	b.options.MaxDelay = delay
+	return b
+}
+
+// SetQueueSize sets the maximum number of messages waiting per destination in RateLimitQueue mode
+func (b *RateLimiterOptionsBuilder) SetQueueSize(size int) *RateLimiterOptionsBuilder {
+	b.options.QueueSize = size
+	return b
+}
+
+// Build returns the configured RateLimiterOptions
+func (b *RateLimiterOptionsBuilder) Build() *RateLimiterOptions {
+	return b.options
+}
+
+// tokenBucket holds the tokens of a single destination. Tokens go negative
+// for messages which are waiting for their turn.
+type tokenBucket struct {
+	tokens  float64
+	last    time.Time
+	full    time.Time
+	waiting int
+}
+
+// RateLimiter limits the messages sent per destination. A single RateLimiter is shared by
+// all integrations it limits, so clients which deliver to the same destination share the limit.
+type RateLimiter struct {
+	options *RateLimiterOptions
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewRateLimiter creates a new RateLimiter with the provided options
+func NewRateLimiter(opts *RateLimiterOptions) (*RateLimiter, error) {
+	// Validate rate limiter configuration
+	validate := validator.New()
+	err := validate.Struct(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RateLimiter{
+		options: opts,
+		now:     time.Now,
+		sleep:   sleep,
+		buckets: map[string]*tokenBucket{},
+	}, nil
+}
+
+// Limit wraps the integration, registered under the given name, so every message
+// it sends is subject to the limit of the integration and its destination
+func (l *RateLimiter) Limit(integration string, notifier Notifier) Notifier {
+	return &rateLimitedNotifier{
+		limiter:     l,
+		integration: integration,
+		notifier:    notifier,
+	}
+}
+
+// rateLimitedNotifier is an integration limited by a RateLimiter
+type rateLimitedNotifier struct {
+	limiter     *RateLimiter
+	integration string
+	notifier    Notifier
+}
+
+// Send implements Notifier. It sends the message when the limit allows it, depending on the
+// mode it waits for its turn or fails with ErrRateLimited and the time until a message is allowed.
+func (n *rateLimitedNotifier) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: n.integration}
+
+	destination := ""
+	if d, ok := n.notifier.(Destination); ok {
+		destination = d.Destination()
+	}
+	key := n.integration + "|" + destination
+
+	wait, err := n.limiter.reserve(ctx, n.integration, key)
+	if err != nil {
+		result.RetryAfter = wait
+		if destination != "" {
+			err = fmt.Errorf("%w for %s", err, destination)
+		}
+		return result.done(start, err)
+	}
+	if wait > 0 {
+		err := n.limiter.sleep(ctx, wait)
+		n.limiter.release(key, err != nil)
+		if err != nil {
+			return result.done(start, err)
+		}
+	}
+
+	result, err = n.notifier.Send(ctx, message)
+	result.Latency = time.Since(start)
+	return result, err
+}
+
+// reserve takes a token from the bucket of the destination and returns how long
+// to wait before sending. When the message can't wait, it returns ErrRateLimited
+// together with the time until a token is available.
+func (l *RateLimiter) reserve(ctx context.Context, integration string, key string) (time.Duration, error) {
+	limit, ok := l.options.Limits[integration]
+	if !ok {
+		if l.options.Default == nil {
+			return 0, nil
+		}
+		limit = *l.options.Default
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		l.evict(now)
+		bucket = &tokenBucket{tokens: limit.burst(), last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(limit.burst(), bucket.tokens+now.Sub(bucket.last).Seconds()*limit.rate())
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		bucket.full = now.Add(time.Duration((limit.burst() - bucket.tokens) / limit.rate() * float64(time.Second)))
+		return 0, nil
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / limit.rate() * float64(time.Second))
+	switch l.options.Mode {
+	case RateLimitDrop:
+		return wait, ErrRateLimited
+	case RateLimitDelay:
+		if l.options.MaxDelay > 0 && wait > l.options.MaxDelay {
+			return wait, ErrRateLimited
+		}
+	case RateLimitQueue:
+		if l.options.QueueSize > 0 && bucket.waiting >= l.options.QueueSize {
+			return wait, ErrRateLimited
+		}
+	}
+	if !beforeDeadline(ctx, wait) {
+		return wait, ErrRateLimited
+	}
+
+	bucket.tokens--
+	bucket.waiting++
+	bucket.full = now.Add(time.Duration((limit.burst() - bucket.tokens) / limit.rate() * float64(time.Second)))
+	return wait, nil
+}
+
+// release is called when a message stopped waiting, the token is given back if it wasn't used
+func (l *RateLimiter) release(key string, cancelled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bucket, ok := l.buckets[key]; ok {
+		bucket.waiting--
+		if cancelled {
+			bucket.tokens++
+		}
+	}
+}
+
+// evict removes the buckets of destinations which haven't been used long enough
+// to be full again, so the buckets don't grow with every destination ever seen.
+// It only runs once there is a considerable number of buckets, l.mu must be held.
+func (l *RateLimiter) evict(now time.Time) {
+	if len(l.buckets) < 1024 {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if bucket.waiting == 0 && !now.Before(bucket.full) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// newTestRateLimiter returns a rate limiter with a fake clock, sleeping advances the clock
+func newTestRateLimiter(t *testing.T, opts *RateLimiterOptions) (*RateLimiter, *time.Time, *[]time.Duration) {
+	limiter, err := NewRateLimiter(opts)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	now := time.Now()
+	var waits []time.Duration
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return ctx.Err()
+	}
+	return limiter, &now, &waits
+}
+
+func countingNotifier(calls *int) Notifier {
+	return notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		*calls++
+		return DeliveryResult{Integration: IntegrationTelegram}, nil
+	})
+}
+
+func TestRateLimiterOptionsValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        *RateLimiterOptions
+		expectError bool
+	}{
+		{"Defaults", NewRateLimiterOptions().Build(), false},
+		{"InvalidMode", NewRateLimiterOptions().SetMode("wait").Build(), true},
+		{"InvalidLimit", NewRateLimiterOptions().SetLimit(IntegrationWebhook, RateLimit{Count: 0, Interval: time.Second}).Build(), true},
+		{"NegativeQueue", NewRateLimiterOptions().SetQueueSize(-1).Build(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRateLimiter(tt.opts)
+			if tt.expectError && err == nil {
+				t.Errorf("expected error got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("expected no error got %v", err)
+			}
+		})
+	}
+}
+
+func TestRateLimiterDrop(t *testing.T) {
+	opts := NewRateLimiterOptions().
+		SetLimit(IntegrationTelegram, RateLimit{Count: 2, Interval: time.Second}).
+		SetMode(RateLimitDrop).
+		Build()
+	limiter, now, _ := newTestRateLimiter(t, opts)
+
+	calls := 0
+	chat := limiter.Limit(IntegrationTelegram, destinationNotifier{"chat-1", countingNotifier(&calls)})
+	otherChat := limiter.Limit(IntegrationTelegram, destinationNotifier{"chat-2", countingNotifier(&calls)})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := chat.Send(ctx, models.Message{}); err != nil {
+			t.Fatalf("expected message %d to be sent got %v", i, err)
+		}
+	}
+	result, err := chat.Send(ctx, models.Message{})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited got %v", err)
+	}
+	if result.Integration != IntegrationTelegram || result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected telegram result with retry after 500ms got %+v", result)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls got %d", calls)
+	}
+
+	// Other destinations have their own bucket
+	if _, err := otherChat.Send(ctx, models.Message{}); err != nil {
+		t.Errorf("expected other chat not to be limited got %v", err)
+	}
+
+	// Tokens are refilled over time
+	*now = now.Add(500 * time.Millisecond)
+	if _, err := chat.Send(ctx, models.Message{}); err != nil {
+		t.Errorf("expected message to be sent after refill got %v", err)
+	}
+}
+
+func TestRateLimiterDelay(t *testing.T) {
+	opts := NewRateLimiterOptions().
+		SetLimit(IntegrationSlack, RateLimit{Count: 1, Interval: time.Second}).
+		SetMode(RateLimitDelay).
+		SetMaxDelay(1500 * time.Millisecond).
+		Build()
+	limiter, _, waits := newTestRateLimiter(t, opts)
+
+	calls := 0
+	hook := limiter.Limit(IntegrationSlack, destinationNotifier{"https://hooks.slack.com/1", countingNotifier(&calls)})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := hook.Send(ctx, models.Message{}); err != nil {
+			t.Fatalf("expected message %d to be sent got %v", i, err)
+		}
+	}
+	if len(*waits) != 1 || (*waits)[0] != time.Second {
+		t.Errorf("expected the second message to wait 1s got %v", *waits)
+	}
+}
+
+func TestRateLimiterDelayExceedsMaximum(t *testing.T) {
+	opts := NewRateLimiterOptions().
+		SetLimit(IntegrationSms, RateLimit{Count: 1, Interval: time.Minute}).
+		SetMaxDelay(time.Second).
+		Build()
+	limiter, _, _ := newTestRateLimiter(t, opts)
+
+	calls := 0
+	phone := limiter.Limit(IntegrationSms, destinationNotifier{"+32000000000", countingNotifier(&calls)})
+	phone.Send(context.Background(), models.Message{})
+	result, err := phone.Send(context.Background(), models.Message{})
+	if !errors.Is(err, ErrRateLimited) || result.RetryAfter != time.Minute {
+		t.Errorf("expected ErrRateLimited with retry after 1m got %v %s", err, result.RetryAfter)
+	}
+	if !IsRetryable(result, err) || IsBreakerFailure(result, err) {
+		t.Errorf("expected a rate limited message to be retryable, but no breaker failure")
+	}
+}
+
+func TestRateLimiterQueue(t *testing.T) {
+	opts := NewRateLimiterOptions().
+		SetLimit(IntegrationWebhook, RateLimit{Count: 1, Interval: time.Second}).
+		SetMode(RateLimitQueue).
+		SetQueueSize(1).
+		Build()
+	limiter, err := NewRateLimiter(opts)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	release := make(chan struct{})
+	waiting := make(chan struct{})
+	limiter.sleep = func(ctx context.Context, d time.Duration) error {
+		close(waiting)
+		<-release
+		return nil
+	}
+
+	calls := 0
+	webhook := limiter.Limit(IntegrationWebhook, destinationNotifier{"https://example.com/hook", countingNotifier(&calls)})
+	ctx := context.Background()
+	webhook.Send(ctx, models.Message{})
+
+	done := make(chan error)
+	go func() {
+		_, err := webhook.Send(ctx, models.Message{})
+		done <- err
+	}()
+	<-waiting
+
+	// The queue of the destination is full
+	if _, err := webhook.Send(ctx, models.Message{}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited for a full queue got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("expected queued message to be sent got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls got %d", calls)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	limiter, _, waits := newTestRateLimiter(t, NewRateLimiterOptions().Build())
+	calls := 0
+	mqtt := limiter.Limit(IntegrationMQTT, countingNotifier(&calls))
+	for i := 0; i < 100; i++ {
+		if _, err := mqtt.Send(context.Background(), models.Message{}); err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+	}
+	if len(*waits) != 0 {
+		t.Errorf("expected no waits for an integration without limit got %d", len(*waits))
+	}
+}
+
+// destinationNotifier is a Notifier with a fixed destination
+type destinationNotifier struct {
+	destination string
+	Notifier
+}
+
+func (d destinationNotifier) Destination() string {
+	return d.destination
+}
@@ -0,0 +1,130 @@
+package integrations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrUnknownIntegration is returned when building an integration which is not registered
+var ErrUnknownIntegration = errors.New("unknown integration")
+
+// ErrIntegrationRegistered is returned when registering a name which is already taken
+var ErrIntegrationRegistered = errors.New("integration already registered")
+
+// Decoder decodes the raw configuration of an integration into its configuration type
+type Decoder[C any] func(config []byte) (C, error)
+
+// Constructor creates a ready-to-send integration from its decoded configuration
+type Constructor[C any] func(config C) (Notifier, error)
+
+// factory builds a Notifier from a raw configuration
+type factory func(config []byte) (Notifier, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]factory{}
+)
+
+// Register registers an integration under the given name, so it can be created with Build.
+// The decoder turns the raw configuration into the configuration type of the integration,
+// the constructor validates that configuration and creates the client.
+func Register[C any](name string, decode Decoder[C], constructor Constructor[C]) error {
+	if name == "" {
+		return errors.New("integration name is empty")
+	}
+	if decode == nil || constructor == nil {
+		return fmt.Errorf("integration %s: decoder and constructor are required", name)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("%w: %s", ErrIntegrationRegistered, name)
+	}
+	registry[name] = func(config []byte) (Notifier, error) {
+		c, err := decode(config)
+		if err != nil {
+			return nil, err
+		}
+		return constructor(c)
+	}
+	return nil
+}
+
+// MustRegister is like Register but panics if the integration can't be registered.
+// It is meant to be used from init functions.
+func MustRegister[C any](name string, decode Decoder[C], constructor Constructor[C]) {
+	if err := Register(name, decode, constructor); err != nil {
+		panic(err)
+	}
+}
+
+// Build creates the integration registered under name from its raw (JSON) configuration,
+// e.g. Build("telegram", []byte(`{"token":"...","channel":"..."}`))
+func Build(name string, config []byte) (Notifier, error) {
+	registryMu.RLock()
+	build, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownIntegration, name)
+	}
+
+	notifier, err := build(config)
+	if err != nil {
+		return nil, fmt.Errorf("integration %s: %w", name, err)
+	}
+	return notifier, nil
+}
+
+// BuildConfig creates an integration from a configuration which holds
+// the name of the integration in its type field, e.g. {"type":"telegram",...}
+func BuildConfig(config []byte) (Notifier, error) {
+	header := struct {
+		Type string `json:"type"`
+	}{}
+	if err := json.Unmarshal(config, &header); err != nil {
+		return nil, err
+	}
+	if header.Type == "" {
+		return nil, errors.New("integration type is empty")
+	}
+	return Build(header.Type, config)
+}
+
+// Registered returns the sorted names of all registered integrations
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DecodeJSON is a Decoder which decodes a JSON configuration.
+// An empty configuration results in the zero value of C.
+func DecodeJSON[C any](config []byte) (C, error) {
+	var c C
+	if len(config) == 0 {
+		return c, nil
+	}
+	err := json.Unmarshal(config, &c)
+	return c, err
+}
+
+// validated is a Constructor for integrations which are configured by their own fields.
+// It validates the fields and returns the integration as-is.
+func validated[C Notifier](config C) (Notifier, error) {
+	validate := validator.New()
+	if err := validate.Struct(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
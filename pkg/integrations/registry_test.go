@@ -0,0 +1,161 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// testNotifier is a Notifier used to test third-party registrations
+type testNotifier struct {
+	Endpoint string `json:"endpoint" validate:"required,url"`
+}
+
+func (n testNotifier) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+	return DeliveryResult{Integration: "test"}, nil
+}
+
+func TestRegistryBuiltins(t *testing.T) {
+	expected := []string{
+		IntegrationAlexa, IntegrationIfttt, IntegrationMail, IntegrationMongodb, IntegrationMQTT,
+		IntegrationPushbullet, IntegrationPusher, IntegrationPushover, IntegrationSendgrid,
+		IntegrationSlack, IntegrationSms, IntegrationSMTP, IntegrationTelegram, IntegrationWebhook,
+	}
+	registered := map[string]bool{}
+	for _, name := range Registered() {
+		registered[name] = true
+	}
+	for _, name := range expected {
+		if !registered[name] {
+			t.Errorf("expected %s to be registered", name)
+		}
+	}
+}
+
+func TestRegistryBuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		integration string
+		config      string
+		expectError bool
+	}{
+		{
+			name:        "ValidTelegram",
+			integration: IntegrationTelegram,
+			config:      `{"token":"123:abc","channel":"c1375189391_8694429167782276799"}`,
+			expectError: false,
+		},
+		{
+			name:        "TelegramMissingChannel",
+			integration: IntegrationTelegram,
+			config:      `{"token":"123:abc"}`,
+			expectError: true,
+		},
+		{
+			name:        "ValidSMTP",
+			integration: IntegrationSMTP,
+			config:      `{"server":"smtp.test.com","port":587,"username":"user","password":"pass","email_from":"from@test.com","email_to":"to@test.com"}`,
+			expectError: false,
+		},
+		{
+			name:        "SMTPInvalidEmail",
+			integration: IntegrationSMTP,
+			config:      `{"server":"smtp.test.com","port":587,"username":"user","password":"pass","email_from":"from@test.com","email_to":"not-an-email"}`,
+			expectError: true,
+		},
+		{
+			name:        "SMTPEmptyConfig",
+			integration: IntegrationSMTP,
+			config:      ``,
+			expectError: true,
+		},
+		{
+			name:        "ValidWebhook",
+			integration: IntegrationWebhook,
+			config:      `{"url":"https://example.com/webhook","timeout":5}`,
+			expectError: false,
+		},
+		{
+			name:        "InvalidJSON",
+			integration: IntegrationSlack,
+			config:      `{"hook":`,
+			expectError: true,
+		},
+		{
+			name:        "UnknownIntegration",
+			integration: "carrier-pigeon",
+			config:      `{}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier, err := Build(tt.integration, []byte(tt.config))
+			if tt.expectError && err == nil {
+				t.Errorf("expected error got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("expected no error got %v", err)
+			}
+			if !tt.expectError && notifier == nil {
+				t.Errorf("expected a notifier got nil")
+			}
+		})
+	}
+
+	_, err := Build("carrier-pigeon", nil)
+	if !errors.Is(err, ErrUnknownIntegration) {
+		t.Errorf("expected ErrUnknownIntegration got %v", err)
+	}
+}
+
+func TestRegistryBuildConfig(t *testing.T) {
+	notifier, err := BuildConfig([]byte(`{"type":"telegram","token":"123:abc","channel":"mychannel"}`))
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	telegram, ok := notifier.(Telegram)
+	if !ok {
+		t.Fatalf("expected a Telegram integration got %T", notifier)
+	}
+	if telegram.Token != "123:abc" || telegram.Channel != "mychannel" {
+		t.Errorf("unexpected configuration %+v", telegram)
+	}
+
+	if _, err := BuildConfig([]byte(`{"token":"123:abc"}`)); err == nil {
+		t.Errorf("expected error for missing type got nil")
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	name := "test-registry-register"
+	err := Register(name, DecodeJSON[testNotifier], validated[testNotifier])
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	err = Register(name, DecodeJSON[testNotifier], validated[testNotifier])
+	if !errors.Is(err, ErrIntegrationRegistered) {
+		t.Errorf("expected ErrIntegrationRegistered got %v", err)
+	}
+
+	notifier, err := Build(name, []byte(`{"endpoint":"https://example.com"}`))
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	result, err := notifier.Send(context.Background(), models.Message{})
+	if err != nil || result.Integration != "test" {
+		t.Errorf("expected the registered notifier to be used")
+	}
+
+	if _, err := Build(name, []byte(`{"endpoint":"not-a-url"}`)); err == nil {
+		t.Errorf("expected validation error got nil")
+	}
+
+	if err := Register[testNotifier]("", DecodeJSON[testNotifier], validated[testNotifier]); err == nil {
+		t.Errorf("expected error for empty name got nil")
+	}
+}
@@ -0,0 +1,87 @@
+package integrations
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeliveryResult describes the outcome of delivering a message through an integration
+type DeliveryResult struct {
+	// Integration is the name of the integration that delivered the message
+	Integration string
+	// MessageId is the identifier the provider assigned to the message, if any
+	MessageId string
+	// StatusCode is the HTTP or provider specific status code of the delivery
+	StatusCode int
+	// Recipients are the recipients accepted by the provider
+	Recipients []string
+	// Latency is the time it took to deliver the message
+	Latency time.Duration
+	// RetryAfter is the delay the provider asked to wait before trying again, if any
+	RetryAfter time.Duration
+	// Attempts holds every attempt made to deliver the message, when the integration is retried
+	Attempts []DeliveryAttempt
+	// Duplicate is set when the message was not sent again, as it was already sent within the idempotency window
+	Duplicate bool
+	// Error is set when the delivery failed, it always holds a *DeliveryError
+	Error error
+}
+
+// DeliveryAttempt describes a single attempt to deliver a message
+type DeliveryAttempt struct {
+	// Attempt is the number of the attempt, starting at 1
+	Attempt int
+	// StatusCode is the HTTP or provider specific status code of the attempt
+	StatusCode int
+	// Latency is the time the attempt took
+	Latency time.Duration
+	// Backoff is the time waited after the attempt before the next one, if any
+	Backoff time.Duration
+	// Error is set when the attempt failed
+	Error error
+}
+
+// Delivered reports whether the message was delivered
+func (r DeliveryResult) Delivered() bool {
+	return r.Error == nil
+}
+
+// done completes the result with the latency since start. If err is not nil it is
+// wrapped in a DeliveryError, which is both stored on the result and returned.
+func (r DeliveryResult) done(start time.Time, err error) (DeliveryResult, error) {
+	r.Latency = time.Since(start)
+	if err == nil {
+		return r, nil
+	}
+	var deliveryErr *DeliveryError
+	if !errors.As(err, &deliveryErr) {
+		deliveryErr = &DeliveryError{
+			Integration: r.Integration,
+			StatusCode:  r.StatusCode,
+			Err:         err,
+		}
+	}
+	r.Error = deliveryErr
+	return r, deliveryErr
+}
+
+// DeliveryError is the error returned when an integration failed to deliver a message
+type DeliveryError struct {
+	// Integration is the name of the integration that failed
+	Integration string
+	// StatusCode is the HTTP or provider specific status code, if any
+	StatusCode int
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements the error interface
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Integration, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,44 @@
+package integrations
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeliveryResultDone(t *testing.T) {
+	start := time.Now().Add(-10 * time.Millisecond)
+
+	result, err := DeliveryResult{Integration: IntegrationWebhook}.done(start, nil)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if !result.Delivered() {
+		t.Errorf("expected message to be delivered")
+	}
+	if result.Latency < 10*time.Millisecond {
+		t.Errorf("expected latency of at least 10ms, got %s", result.Latency)
+	}
+
+	cause := errors.New("connection refused")
+	result, err = DeliveryResult{Integration: IntegrationWebhook, StatusCode: 502}.done(start, cause)
+	if result.Delivered() {
+		t.Errorf("expected message not to be delivered")
+	}
+	if result.Error != err {
+		t.Errorf("expected the returned error to be stored on the result")
+	}
+	var deliveryErr *DeliveryError
+	if !errors.As(err, &deliveryErr) {
+		t.Fatalf("expected a DeliveryError got %T", err)
+	}
+	if deliveryErr.Integration != IntegrationWebhook || deliveryErr.StatusCode != 502 {
+		t.Errorf("unexpected delivery error %+v", deliveryErr)
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("expected the delivery error to wrap the cause")
+	}
+	if err.Error() != "webhook: connection refused" {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+}
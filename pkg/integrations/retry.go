@@ -0,0 +1,271 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// RetryOptions holds the configuration of the retry policy
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of attempts, including the first one
+	MaxAttempts int `json:"max_attempts,omitempty" validate:"gte=1"`
+	// InitialBackoff is the time waited after the first failed attempt
+	InitialBackoff time.Duration `json:"initial_backoff,omitempty" validate:"gte=0"`
+	// MaxBackoff caps the time waited between two attempts
+	MaxBackoff time.Duration `json:"max_backoff,omitempty" validate:"gte=0"`
+	// Multiplier is the factor the backoff grows with after every attempt
+	Multiplier float64 `json:"multiplier,omitempty" validate:"gte=1"`
+	// Jitter randomizes the backoff with the given fraction, e.g. 0.2 means +/- 20%
+	Jitter float64 `json:"jitter,omitempty" validate:"gte=0,lte=1"`
+	// MaxRetryAfter is the longest Retry-After the provider may ask for, if it asks
+	// for more the delivery is given up. Zero means any Retry-After is honored.
+	MaxRetryAfter time.Duration `json:"max_retry_after,omitempty" validate:"gte=0"`
+	// Retryable decides whether a failed attempt is retried, defaults to IsRetryable
+	Retryable func(result DeliveryResult, err error) bool `json:"-"`
+}
+
+// RetryOptionsBuilder provides a fluent interface for building retry options
+type RetryOptionsBuilder struct {
+	options *RetryOptions
+}
+
+// NewRetryOptions creates a new retry options builder. By default a message is
+// attempted 3 times, with a backoff starting at 500ms, doubling up to 30s, with 20% jitter.
+func NewRetryOptions() *RetryOptionsBuilder {
+	return &RetryOptionsBuilder{
+		options: &RetryOptions{
+			MaxAttempts:    3,
+			InitialBackoff: 500 * time.Millisecond,
+			MaxBackoff:     30 * time.Second,
+			Multiplier:     2,
+			Jitter:         0.2,
+			MaxRetryAfter:  time.Minute,
+		},
+	}
+}
+
+// SetMaxAttempts sets the maximum number of attempts, including the first one
+func (b *RetryOptionsBuilder) SetMaxAttempts(attempts int) *RetryOptionsBuilder {
+	b.options.MaxAttempts = attempts
+	return b
+}
+
+// SetInitialBackoff sets the time waited after the first failed attempt
+func (b *RetryOptionsBuilder) SetInitialBackoff(backoff time.Duration) *RetryOptionsBuilder {
+	b.options.InitialBackoff = backoff
+	return b
+}
+
+// SetMaxBackoff sets the maximum time waited between two attempts
+func (b *RetryOptionsBuilder) SetMaxBackoff(backoff time.Duration) *RetryOptionsBuilder {
+	b.options.MaxBackoff = backoff
+	return b
+}
+
+// SetMultiplier sets the factor the backoff grows with after every attempt
+func (b *RetryOptionsBuilder) SetMultiplier(multiplier float64) *RetryOptionsBuilder {
+	b.options.Multiplier = multiplier
+	return b
+}
+
+// SetJitter sets the fraction the backoff is randomized with
+func (b *RetryOptionsBuilder) SetJitter(jitter float64) *RetryOptionsBuilder {
+	b.options.Jitter = jitter
+	return b
+}
+
+// SetMaxRetryAfter sets the longest Retry-After which is honored
+func (b *RetryOptionsBuilder) SetMaxRetryAfter(retryAfter time.Duration) *RetryOptionsBuilder {
+	b.options.MaxRetryAfter = retryAfter
+	return b
+}
+
+// SetRetryable sets the function which decides whether a failed attempt is retried
+func (b *RetryOptionsBuilder) SetRetryable(retryable func(result DeliveryResult, err error) bool) *RetryOptionsBuilder {
+	b.options.Retryable = retryable
+	return b
+}
+
+// Build returns the configured RetryOptions
+func (b *RetryOptionsBuilder) Build() *RetryOptions {
+	return b.options
+}
+
+// Retry wraps an integration and retries failed deliveries with exponential backoff
+type Retry struct {
+	options  *RetryOptions
+	notifier Notifier
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetry creates a new Retry which delivers messages through the provided notifier
+func NewRetry(opts *RetryOptions, notifier Notifier) (*Retry, error) {
+	// Validate retry configuration
+	validate := validator.New()
+	err := validate.Struct(opts)
+	if err != nil {
+		return nil, err
+	}
+	if notifier == nil {
+		return nil, errors.New("notifier is required")
+	}
+
+	return &Retry{
+		options:  opts,
+		notifier: notifier,
+		sleep:    sleep,
+	}, nil
+}
+
+// Send implements Notifier. It sends the message through the wrapped integration until
+// it is delivered, the error is not retryable, the attempts are exhausted or the context is done.
+// Every attempt is recorded in the Attempts of the returned result.
+func (r *Retry) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	retryable := r.options.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	var attempts []DeliveryAttempt
+	var result DeliveryResult
+	var err error
+	for attempt := 1; ; attempt++ {
+
+		attemptStart := time.Now()
+		result, err = r.notifier.Send(ctx, message)
+		attempts = append(attempts, DeliveryAttempt{
+			Attempt:    attempt,
+			StatusCode: result.StatusCode,
+			Latency:    time.Since(attemptStart),
+			Error:      err,
+		})
+
+		if err == nil || attempt >= r.options.MaxAttempts || ctx.Err() != nil || !retryable(result, err) {
+			break
+		}
+
+		backoff, ok := r.backoff(attempt, result.RetryAfter)
+		if !ok || !beforeDeadline(ctx, backoff) {
+			break
+		}
+		attempts[len(attempts)-1].Backoff = backoff
+		if r.sleep(ctx, backoff) != nil {
+			break
+		}
+	}
+
+	result.Attempts = attempts
+	result.Latency = time.Since(start)
+	return result, err
+}
+
+// backoff returns the time to wait after the given attempt. The Retry-After of the provider
+// is honored when it is longer than the backoff, unless it exceeds MaxRetryAfter.
+func (r *Retry) backoff(attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	backoff := float64(r.options.InitialBackoff) * math.Pow(r.options.Multiplier, float64(attempt-1))
+	if r.options.Jitter > 0 {
+		backoff = backoff * (1 + r.options.Jitter*(2*rand.Float64()-1))
+	}
+	if r.options.MaxBackoff > 0 && backoff > float64(r.options.MaxBackoff) {
+		backoff = float64(r.options.MaxBackoff)
+	}
+
+	wait := time.Duration(backoff)
+	if retryAfter > 0 {
+		if r.options.MaxRetryAfter > 0 && retryAfter > r.options.MaxRetryAfter {
+			return 0, false
+		}
+		wait = max(wait, retryAfter)
+	}
+	return wait, true
+}
+
+// IsRetryable is the default classification of failed deliveries. Rate limits (429 and ErrRateLimited),
+// timeouts (408) and server errors (5xx) are retried, as are network errors, timeouts, transient (4xx)
+// SMTP replies and ErrDuplicateInFlight. Other errors, including a cancelled context, are not.
+func IsRetryable(result DeliveryResult, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrDuplicateInFlight) {
+		return true
+	}
+
+	statusCode := result.StatusCode
+	var deliveryErr *DeliveryError
+	if statusCode == 0 && errors.As(err, &deliveryErr) {
+		statusCode = deliveryErr.StatusCode
+	}
+	switch {
+	case statusCode == http.StatusTooManyRequests, statusCode == http.StatusRequestTimeout:
+		return true
+	case statusCode >= 500 && statusCode < 600:
+		return true
+	case statusCode >= 400 && statusCode < 500:
+		return false
+	}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+
+	var netErr net.Error
+	var opErr *net.OpError
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr) && netErr.Timeout() ||
+		errors.As(err, &opErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which holds
+// either a number of seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// beforeDeadline reports whether waiting for d still leaves time before the deadline of the context
+func beforeDeadline(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Now().Add(d).Before(deadline)
+}
+
+// sleep waits for the given duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,266 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// failingNotifier fails with the given status codes before it delivers the message
+func failingNotifier(calls *int, statusCodes ...int) Notifier {
+	return notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+		start := time.Now()
+		result := DeliveryResult{Integration: IntegrationWebhook}
+		*calls++
+		if *calls <= len(statusCodes) {
+			result.StatusCode = statusCodes[*calls-1]
+			return result.done(start, fmt.Errorf("webhook request failed with status: %d", result.StatusCode))
+		}
+		result.StatusCode = http.StatusOK
+		return result.done(start, nil)
+	})
+}
+
+func newTestRetry(t *testing.T, opts *RetryOptions, notifier Notifier) (*Retry, *[]time.Duration) {
+	retry, err := NewRetry(opts, notifier)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	var waits []time.Duration
+	retry.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	return retry, &waits
+}
+
+func TestRetryOptionsValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        *RetryOptions
+		expectError bool
+	}{
+		{"Defaults", NewRetryOptions().Build(), false},
+		{"ZeroAttempts", NewRetryOptions().SetMaxAttempts(0).Build(), true},
+		{"MultiplierBelowOne", NewRetryOptions().SetMultiplier(0.5).Build(), true},
+		{"JitterAboveOne", NewRetryOptions().SetJitter(1.5).Build(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRetry(tt.opts, notifierFunc(nil))
+			if tt.expectError && err == nil {
+				t.Errorf("expected error got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("expected no error got %v", err)
+			}
+		})
+	}
+}
+
+func TestRetrySend(t *testing.T) {
+	opts := NewRetryOptions().
+		SetMaxAttempts(4).
+		SetInitialBackoff(100 * time.Millisecond).
+		SetMultiplier(2).
+		SetJitter(0).
+		Build()
+
+	t.Run("RetriesServerErrors", func(t *testing.T) {
+		calls := 0
+		retry, waits := newTestRetry(t, opts, failingNotifier(&calls, 503, 502))
+		result, err := retry.Send(context.Background(), models.Message{})
+		if err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		if calls != 3 || len(result.Attempts) != 3 {
+			t.Fatalf("expected 3 attempts got %d", len(result.Attempts))
+		}
+		if result.Attempts[0].StatusCode != 503 || result.Attempts[0].Error == nil {
+			t.Errorf("expected first attempt to fail with 503 got %+v", result.Attempts[0])
+		}
+		if result.Attempts[2].StatusCode != 200 || result.Attempts[2].Error != nil {
+			t.Errorf("expected last attempt to succeed got %+v", result.Attempts[2])
+		}
+		expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}
+		if fmt.Sprint(*waits) != fmt.Sprint(expected) {
+			t.Errorf("expected backoff %v got %v", expected, *waits)
+		}
+		if result.Attempts[0].Backoff != expected[0] {
+			t.Errorf("expected backoff in attempt got %s", result.Attempts[0].Backoff)
+		}
+	})
+
+	t.Run("StopsOnClientError", func(t *testing.T) {
+		calls := 0
+		retry, _ := newTestRetry(t, opts, failingNotifier(&calls, 400))
+		result, err := retry.Send(context.Background(), models.Message{})
+		if err == nil || calls != 1 || len(result.Attempts) != 1 {
+			t.Errorf("expected a single failed attempt got %d attempts, err %v", calls, err)
+		}
+		var deliveryErr *DeliveryError
+		if !errors.As(err, &deliveryErr) || deliveryErr.StatusCode != 400 {
+			t.Errorf("expected a DeliveryError with status 400 got %v", err)
+		}
+	})
+
+	t.Run("ExhaustsAttempts", func(t *testing.T) {
+		calls := 0
+		retry, waits := newTestRetry(t, opts, failingNotifier(&calls, 500, 500, 500, 500, 500))
+		result, err := retry.Send(context.Background(), models.Message{})
+		if err == nil || calls != 4 || len(result.Attempts) != 4 {
+			t.Errorf("expected 4 failed attempts got %d, err %v", calls, err)
+		}
+		if len(*waits) != 3 {
+			t.Errorf("expected 3 waits got %d", len(*waits))
+		}
+	})
+
+	t.Run("StopsWhenContextCancelled", func(t *testing.T) {
+		calls := 0
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		retry, _ := newTestRetry(t, opts, failingNotifier(&calls, 500, 500))
+		_, err := retry.Send(ctx, models.Message{})
+		if err == nil || calls != 1 {
+			t.Errorf("expected a single attempt got %d, err %v", calls, err)
+		}
+	})
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	rateLimited := func(retryAfter time.Duration) Notifier {
+		calls := 0
+		return notifierFunc(func(ctx context.Context, message models.Message) (DeliveryResult, error) {
+			start := time.Now()
+			result := DeliveryResult{Integration: IntegrationSlack}
+			calls++
+			if calls == 1 {
+				result.StatusCode = http.StatusTooManyRequests
+				result.RetryAfter = retryAfter
+				return result.done(start, errors.New("slack rate limit exceeded"))
+			}
+			return result.done(start, nil)
+		})
+	}
+	opts := NewRetryOptions().
+		SetInitialBackoff(100 * time.Millisecond).
+		SetJitter(0).
+		SetMaxRetryAfter(10 * time.Second).
+		Build()
+
+	retry, waits := newTestRetry(t, opts, rateLimited(3*time.Second))
+	if _, err := retry.Send(context.Background(), models.Message{}); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if len(*waits) != 1 || (*waits)[0] != 3*time.Second {
+		t.Errorf("expected to wait for Retry-After of 3s got %v", *waits)
+	}
+
+	retry, waits = newTestRetry(t, opts, rateLimited(time.Minute))
+	result, err := retry.Send(context.Background(), models.Message{})
+	if err == nil || len(result.Attempts) != 1 || len(*waits) != 0 {
+		t.Errorf("expected to give up on a Retry-After above the maximum got %d attempts", len(result.Attempts))
+	}
+}
+
+func TestRetryJitter(t *testing.T) {
+	retry, err := NewRetry(NewRetryOptions().
+		SetInitialBackoff(time.Second).
+		SetMaxBackoff(3*time.Second).
+		SetJitter(0.5).
+		Build(), notifierFunc(nil))
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	for attempt := 1; attempt <= 5; attempt++ {
+		backoff, ok := retry.backoff(attempt, 0)
+		if !ok {
+			t.Fatalf("expected a backoff for attempt %d", attempt)
+		}
+		if backoff > 3*time.Second {
+			t.Errorf("expected backoff capped at 3s got %s", backoff)
+		}
+		if attempt == 1 && (backoff < 500*time.Millisecond || backoff > 1500*time.Millisecond) {
+			t.Errorf("expected backoff within 50%% of 1s got %s", backoff)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   DeliveryResult
+		err      error
+		expected bool
+	}{
+		{"NoError", DeliveryResult{StatusCode: 200}, nil, false},
+		{"TooManyRequests", DeliveryResult{StatusCode: 429}, errors.New("rate limited"), true},
+		{"ServiceUnavailable", DeliveryResult{StatusCode: 503}, errors.New("unavailable"), true},
+		{"BadRequest", DeliveryResult{StatusCode: 400}, errors.New("bad request"), false},
+		{"StatusInDeliveryError", DeliveryResult{}, &DeliveryError{StatusCode: 502, Err: errors.New("bad gateway")}, true},
+		{"DeadlineExceeded", DeliveryResult{}, context.DeadlineExceeded, true},
+		{"Canceled", DeliveryResult{}, context.Canceled, false},
+		{"DialError", DeliveryResult{}, &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"UnexpectedEOF", DeliveryResult{}, io.ErrUnexpectedEOF, true},
+		{"SMTPTransient", DeliveryResult{}, &textproto.Error{Code: 421, Msg: "try again later"}, true},
+		{"SMTPPermanent", DeliveryResult{}, &textproto.Error{Code: 550, Msg: "mailbox unavailable"}, false},
+		{"Unknown", DeliveryResult{}, errors.New("message body is empty"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.result, tt.err); got != tt.expected {
+				t.Errorf("expected %v got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("120"); d != 2*time.Minute {
+		t.Errorf("expected 2m got %s", d)
+	}
+	if d := parseRetryAfter(""); d != 0 {
+		t.Errorf("expected 0 got %s", d)
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(date); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expected about an hour got %s", d)
+	}
+}
+
+func TestWebhookRetryAfter(t *testing.T) {
+	mockClient := &MockWebhookHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Status:     "429 Too Many Requests",
+				Header:     http.Header{"Retry-After": []string{"30"}},
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		},
+	}
+	webhook, err := NewWebhook(NewWebhookOptions().SetUrl("https://example.com/hook").Build(), mockClient)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	result, err := webhook.Send(context.Background(), models.Message{Title: "Motion"})
+	if err == nil {
+		t.Fatalf("expected error got nil")
+	}
+	if result.StatusCode != 429 || result.RetryAfter != 30*time.Second {
+		t.Errorf("expected 429 with Retry-After 30s got %d %s", result.StatusCode, result.RetryAfter)
+	}
+	if !IsRetryable(result, err) {
+		t.Errorf("expected a rate limited webhook to be retryable")
+	}
+}
@@ -1,20 +1,32 @@
 package integrations
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	sg "github.com/sendgrid/sendgrid-go"
 	mail "github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/uug-ai/integrations/pkg/templates"
 	"github.com/uug-ai/models/pkg/models"
 )
 
 type Sendgrid struct {
-	ApiKey           string `json:"api_key,omitempty"`
-	EmailFrom        string `json:"email_from,omitempty"`
+	ApiKey           string `json:"api_key,omitempty" validate:"required"`
+	EmailFrom        string `json:"email_from,omitempty" validate:"required,email"`
 	EmailFromDisplay string `json:"email_from_display,omitempty"`
-	EmailTo          string `json:"email_to,omitempty"`
+	EmailTo          string `json:"email_to,omitempty" validate:"omitempty,email"`
 	TemplateId       string `json:"templateId,omitempty"`
 }
 
-func (sendg Sendgrid) SendNotification(message models.Message) bool {
+func init() {
+	MustRegister(IntegrationSendgrid, DecodeJSON[Sendgrid], validated[Sendgrid])
+}
+
+func (sendg Sendgrid) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationSendgrid}
 
 	from := mail.NewEmail(sendg.EmailFromDisplay, sendg.EmailFrom)
 	to := mail.NewEmail(message.User, message.Email)
@@ -34,7 +46,7 @@ func (sendg Sendgrid) SendNotification(message models.Message) bool {
 	m.Personalizations[0].SetSubstitution("{{text}}", message.Body)
 
 	if len(message.Media) > 0 {
-		longUrl := message.Media[0].AtRuntimeMetadata.VideoUrl
+		longUrl := templates.VideoUrl(message)
 		//provider := "tinyurl"
 		url := longUrl
 		/*provider := "tinyurl"
@@ -51,7 +63,23 @@ func (sendg Sendgrid) SendNotification(message models.Message) bool {
 	request := sg.GetRequest(sendg.ApiKey, "/v3/mail/send", "https://api.sendgrid.com")
 	request.Method = "POST"
 	request.Body = mail.GetRequestBody(m)
-	sg.API(request)
+	response, err := sg.MakeRequestWithContext(ctx, request)
+	if err != nil {
+		return result.done(start, err)
+	}
 
-	return true
+	result.StatusCode = response.StatusCode
+	if values := response.Headers["Retry-After"]; len(values) > 0 {
+		result.RetryAfter = parseRetryAfter(values[0])
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return result.done(start, fmt.Errorf("sendgrid request failed with status %d: %s", response.StatusCode, response.Body))
+	}
+
+	// SendGrid returns the identifier of the message in the X-Message-Id header
+	if ids := response.Headers["X-Message-Id"]; len(ids) > 0 {
+		result.MessageId = ids[0]
+	}
+	result.Recipients = []string{to.Address}
+	return result.done(start, nil)
 }
@@ -19,5 +19,5 @@ package integrations
 		EmailFrom:  "xxx@xxx.io",
 		EmailTo:    "xxx@xxx.io",
 	}
-	sendgrid.SendNotification(m)
+	sendgrid.Send(context.Background(), m)
 }*/
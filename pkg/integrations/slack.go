@@ -1,23 +1,31 @@
 package integrations
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/slack-go/slack"
+	"github.com/uug-ai/integrations/pkg/format"
+	"github.com/uug-ai/integrations/pkg/templates"
+	"github.com/uug-ai/models/pkg/models"
 )
 
 // SlackWebhookClient is an interface for posting messages to Slack
 type SlackWebhookClient interface {
-	PostWebhook(url string, msg *slack.WebhookMessage) error
+	PostWebhook(ctx context.Context, url string, msg *slack.WebhookMessage) error
 }
 
 // SlackWebhookClientImpl is the default implementation using slack library
 type SlackWebhookClientImpl struct{}
 
 // PostWebhook implements SlackWebhookClient interface
-func (s *SlackWebhookClientImpl) PostWebhook(url string, msg *slack.WebhookMessage) error {
-	return slack.PostWebhook(url, msg)
+func (s *SlackWebhookClientImpl) PostWebhook(ctx context.Context, url string, msg *slack.WebhookMessage) error {
+	return slack.PostWebhookContext(ctx, url, msg)
 }
 
 // NewSlackWebhookClient creates a new default Slack webhook client
@@ -27,8 +35,15 @@ func NewSlackWebhookClient() SlackWebhookClient {
 
 // SlackOptions holds the configuration for Slack
 type SlackOptions struct {
-	Hook     string `validate:"required,url"`
-	Username string `validate:"required"`
+	Hook     string `json:"hook,omitempty" validate:"required,url"`
+	Username string `json:"username,omitempty" validate:"required"`
+	// BodyTemplate renders the text of the message, see the templates package for the variables
+	BodyTemplate string `json:"body_template,omitempty"`
+	// TemplateId is the named template the text is rendered with, from its slack (mrkdwn) variant.
+	// It takes precedence over the body template.
+	TemplateId string `json:"template_id,omitempty"`
+	// Templates is the store of the named template, defaults to TemplateStore
+	Templates templates.Store `json:"-"`
 }
 
 // SlackOptionsBuilder provides a fluent interface for building Slack options
@@ -55,15 +70,40 @@ func (b *SlackOptionsBuilder) SetUsername(username string) *SlackOptionsBuilder
 	return b
 }
 
+// SetBodyTemplate sets the template the text of the message is rendered with
+func (b *SlackOptionsBuilder) SetBodyTemplate(template string) *SlackOptionsBuilder {
+	b.options.BodyTemplate = template
+	return b
+}
+
+// SetTemplateId sets the named template the text of the message is rendered with
+func (b *SlackOptionsBuilder) SetTemplateId(templateId string) *SlackOptionsBuilder {
+	b.options.TemplateId = templateId
+	return b
+}
+
+// SetTemplateStore sets the store the named template is loaded from
+func (b *SlackOptionsBuilder) SetTemplateStore(store templates.Store) *SlackOptionsBuilder {
+	b.options.Templates = store
+	return b
+}
+
 // Build returns the configured SlackOptions
 func (b *SlackOptionsBuilder) Build() *SlackOptions {
 	return b.options
 }
 
+func init() {
+	MustRegister(IntegrationSlack, DecodeJSON[*SlackOptions], func(opts *SlackOptions) (Notifier, error) {
+		return NewSlack(opts)
+	})
+}
+
 // Slack represents a Slack client instance
 type Slack struct {
-	options *SlackOptions
-	client  SlackWebhookClient
+	options  *SlackOptions
+	client   SlackWebhookClient
+	template messageTemplate
 }
 
 // NewSlack creates a new Slack client with the provided options
@@ -76,6 +116,11 @@ func NewSlack(opts *SlackOptions, client ...SlackWebhookClient) (*Slack, error)
 		return nil, err
 	}
 
+	tmpl, err := newMessageTemplate("", opts.BodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
 	// If no client provided, create default production client
 	var c SlackWebhookClient
 	if len(client) == 0 {
@@ -85,33 +130,79 @@ func NewSlack(opts *SlackOptions, client ...SlackWebhookClient) (*Slack, error)
 	}
 
 	return &Slack{
-		options: opts,
-		client:  c,
+		options:  opts,
+		client:   c,
+		template: tmpl,
 	}, nil
 }
 
-// Send sends a message to Slack using the configured webhook
+// Destination implements Destination, it returns the Slack webhook URL
+func (s *Slack) Destination() string {
+	return s.options.Hook
+}
+
+// Send implements Notifier. It posts the body of the message to Slack, together with
+// the thumbnail of the first media (if any) as image attachment. When a body template is
+// configured, the text is rendered from the message instead.
+// The body is written in the neutral markup of the format package and converted to mrkdwn,
+// the slack variant of a named template is sent as is. A body longer than a section of
+// Slack is split in multiple sections.
+func (s *Slack) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationSlack}
+	rendered, err := s.template.render(message)
+	var tmpl *templates.Template
+	if s.options.TemplateId != "" {
+		rendered, tmpl, err = renderNamed(ctx, s.options.Templates, s.options.TemplateId, templates.VariantSlack, message)
+	}
+	if err != nil {
+		return result.done(start, err)
+	}
+
+	var sections []string
+	if tmpl != nil && tmpl.Variant() == templates.VariantSlack {
+		sections = format.SplitText(rendered.Body, format.SlackBlockMaxLength)
+	} else {
+		sections = format.Split(format.Parse(rendered.Body), format.SlackMrkdwn, format.SlackBlockMaxLength)
+	}
+	if err := s.post(ctx, sections, templates.ThumbnailUrl(message)); err != nil {
+		var statusErr slack.StatusCodeError
+		var rateLimitErr *slack.RateLimitedError
+		if errors.As(err, &statusErr) {
+			result.StatusCode = statusErr.Code
+		} else if errors.As(err, &rateLimitErr) {
+			result.StatusCode = http.StatusTooManyRequests
+			result.RetryAfter = rateLimitErr.RetryAfter
+		}
+		return result.done(start, err)
+	}
+	// Slack only accepts a webhook with 200 OK
+	result.StatusCode = http.StatusOK
+	return result.done(start, nil)
+}
+
+// SendText sends a message to Slack using the configured webhook
 // Parameters:
-//   - body: The message text to send
+//   - ctx: The context of the request, used for cancellation and deadlines
+//   - body: The message text to send, formatted as mrkdwn
 //   - url: An optional URL to append to the message and include as an image attachment
 //
 // Returns:
 //   - error: An error if body is empty or if posting to Slack fails
-func (s *Slack) Send(body string, url string) error {
-	if body == "" {
-		return errors.New("message body is empty")
-	}
+func (s *Slack) SendText(ctx context.Context, body string, url string) error {
+	return s.post(ctx, format.SplitText(body, format.SlackBlockMaxLength), url)
+}
 
-	// Append URL to the message body if provided
-	text := body
-	if url != "" {
-		text = text + "\r\n" + url
+// post posts the sections of a message to Slack. A single section is sent as the text of the
+// message, multiple sections as section blocks, with the first section as the notification text.
+func (s *Slack) post(ctx context.Context, sections []string, url string) error {
+	if len(sections) == 0 || sections[0] == "" {
+		return errors.New("message body is empty")
 	}
 
 	// Create Slack webhook message
 	msg := &slack.WebhookMessage{
 		Username: s.options.Username,
-		Text:     text,
 		Attachments: []slack.Attachment{
 			{
 				Color:    "good",
@@ -120,5 +211,37 @@ func (s *Slack) Send(body string, url string) error {
 		},
 	}
 
-	return s.client.PostWebhook(s.options.Hook, msg)
+	if len(sections) == 1 {
+		// Append URL to the message body if provided
+		msg.Text = sections[0]
+		if url != "" {
+			msg.Text = msg.Text + "\r\n" + url
+		}
+		return s.client.PostWebhook(ctx, s.options.Hook, msg)
+	}
+
+	// Slack accepts a limited number of blocks, the URL takes the last one
+	limit := format.SlackMaxBlocks
+	if url != "" {
+		limit--
+	}
+	if len(sections) > limit {
+		// The last section which is kept ends with the Ellipsis, to show the message is truncated
+		sections = sections[:limit]
+		last := sections[limit-1]
+		if format.Length(last)+format.Length(format.Ellipsis) > format.SlackBlockMaxLength {
+			last = format.SplitText(last, format.SlackBlockMaxLength-format.Length(format.Ellipsis))[0]
+		}
+		sections[limit-1] = strings.TrimRightFunc(last, unicode.IsSpace) + format.Ellipsis
+	}
+	if url != "" {
+		sections = append(sections, url)
+	}
+	blocks := make([]slack.Block, 0, len(sections))
+	for _, section := range sections {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, section, false, false), nil, nil))
+	}
+	msg.Text = sections[0]
+	msg.Blocks = &slack.Blocks{BlockSet: blocks}
+	return s.client.PostWebhook(ctx, s.options.Hook, msg)
 }
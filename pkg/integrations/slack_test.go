@@ -1,27 +1,32 @@
 package integrations
 
 import (
+	"context"
 	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/slack-go/slack"
+	"github.com/uug-ai/integrations/pkg/format"
+	"github.com/uug-ai/integrations/pkg/templates"
+	"github.com/uug-ai/models/pkg/models"
 )
 
 // MockSlackWebhookClient is a mock implementation of SlackWebhookClient for testing
 type MockSlackWebhookClient struct {
-	PostWebhookFunc func(url string, msg *slack.WebhookMessage) error
+	PostWebhookFunc func(ctx context.Context, url string, msg *slack.WebhookMessage) error
 	PostCalled      bool
 	LastURL         string
 	LastMessage     *slack.WebhookMessage
 }
 
-func (m *MockSlackWebhookClient) PostWebhook(url string, msg *slack.WebhookMessage) error {
+func (m *MockSlackWebhookClient) PostWebhook(ctx context.Context, url string, msg *slack.WebhookMessage) error {
 	m.PostCalled = true
 	m.LastURL = url
 	m.LastMessage = msg
 	if m.PostWebhookFunc != nil {
-		return m.PostWebhookFunc(url, msg)
+		return m.PostWebhookFunc(ctx, url, msg)
 	}
 	return nil
 }
@@ -125,7 +130,7 @@ func TestSlackFieldEmpty(t *testing.T) {
 
 	for _, tt := range tests {
 		mockClient.PostCalled = false // Reset for each test
-		err := slackIntegration.Send(tt.body, tt.url)
+		err := slackIntegration.SendText(context.Background(), tt.body, tt.url)
 		if tt.expectError && err == nil {
 			t.Errorf("expected error got nil for body: '%s', url: '%s'", tt.body, tt.url)
 		}
@@ -160,7 +165,7 @@ func TestSlackChannel(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create mock client with specific error behavior
 			mockClient := &MockSlackWebhookClient{
-				PostWebhookFunc: func(url string, msg *slack.WebhookMessage) error {
+				PostWebhookFunc: func(ctx context.Context, url string, msg *slack.WebhookMessage) error {
 					return tt.mockPostError
 				},
 			}
@@ -176,7 +181,7 @@ func TestSlackChannel(t *testing.T) {
 			}
 
 			// Send message to Slack channel.
-			err = slackIntegration.Send("Test message from UUG AI", "https://uug.ai")
+			err = slackIntegration.SendText(context.Background(), "Test message from UUG AI", "https://uug.ai")
 			if tt.expectError && err == nil {
 				t.Errorf("expected error got nil")
 			}
@@ -258,7 +263,7 @@ func TestIntegrationSlackWebhook(t *testing.T) {
 
 			// For runtime errors (like wrong hook), try to send
 			if slackClient != nil {
-				err = slackClient.Send("Test message from integration test", "https://example.com")
+				err = slackClient.SendText(context.Background(), "Test message from integration test", "https://example.com")
 				if tt.expectError && err == nil {
 					t.Errorf("expected error got nil")
 				}
@@ -269,3 +274,176 @@ func TestIntegrationSlackWebhook(t *testing.T) {
 		})
 	}
 }
+
+func TestSlackNotifier(t *testing.T) {
+	mockClient := &MockSlackWebhookClient{}
+
+	opts := NewSlackOptions().
+		SetHook("https://hooks.slack.com/services/T000/B000/XXXX").
+		SetUsername("bot").
+		Build()
+
+	var notifier Notifier
+	notifier, err := NewSlack(opts, mockClient)
+	if err != nil {
+		t.Fatalf("failed to setup Slack: %v", err)
+	}
+
+	message := models.Message{
+		Body: "Motion detected",
+		Media: []models.Media{{
+			AtRuntimeMetadata: &models.MediaAtRuntimeMetadata{ThumbnailUrl: "https://example.com/thumbnail.png"},
+		}},
+	}
+	result, err := notifier.Send(context.Background(), message)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if result.Integration != IntegrationSlack {
+		t.Errorf("expected integration %q, got %q", IntegrationSlack, result.Integration)
+	}
+	if mockClient.LastMessage == nil || mockClient.LastMessage.Attachments[0].ImageURL != "https://example.com/thumbnail.png" {
+		t.Errorf("expected thumbnail to be attached to the Slack message")
+	}
+	if result.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d", result.StatusCode)
+	}
+
+	// Errors returned by Slack are reported with their status code
+	mockClient.PostWebhookFunc = func(ctx context.Context, url string, msg *slack.WebhookMessage) error {
+		return slack.StatusCodeError{Code: 404, Status: "404 Not Found"}
+	}
+	result, err = notifier.Send(context.Background(), message)
+	var deliveryErr *DeliveryError
+	if !errors.As(err, &deliveryErr) {
+		t.Fatalf("expected a DeliveryError got %v", err)
+	}
+	if result.StatusCode != 404 || deliveryErr.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", result.StatusCode)
+	}
+}
+
+func TestSlackTemplate(t *testing.T) {
+	mockClient := &MockSlackWebhookClient{}
+
+	opts := NewSlackOptions().
+		SetHook("https://hooks.slack.com/services/T000/B000/XXXX").
+		SetUsername("bot").
+		SetBodyTemplate("{{devicename}}: {{text}} ({{sites}})").
+		Build()
+
+	slack, err := NewSlack(opts, mockClient)
+	if err != nil {
+		t.Fatalf("failed to setup Slack: %v", err)
+	}
+
+	_, err = slack.Send(context.Background(), models.Message{
+		Body:       "Motion detected",
+		DeviceName: "Front door",
+		Sites:      []models.Site{{Name: "Home"}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if mockClient.LastMessage.Text != "Front door: Motion detected (Home)" {
+		t.Errorf("expected rendered text, got %q", mockClient.LastMessage.Text)
+	}
+}
+
+func TestSlackNamedTemplate(t *testing.T) {
+	mockClient := &MockSlackWebhookClient{}
+
+	store := templates.NewMemoryStore(nil)
+	store.Add(templates.Definition{Id: "motion", Variants: map[string]string{
+		templates.VariantText:  "{{devicename}} detected motion",
+		templates.VariantSlack: "<!here> *{{devicename}}* detected motion",
+	}})
+	// The text variant is written in the neutral markup, and converted to mrkdwn
+	store.Add(templates.Definition{Id: "offline", Variants: map[string]string{
+		templates.VariantText: "**{{devicename}}** is offline <now>",
+	}})
+
+	// Templates are loaded from the default store when the options have no store
+	defaultStore := TemplateStore
+	TemplateStore = store
+	defer func() { TemplateStore = defaultStore }()
+
+	for templateId, expected := range map[string]string{
+		"motion":  "<!here> *Front door* detected motion",
+		"offline": "*Front door* is offline &lt;now&gt;",
+	} {
+		opts := NewSlackOptions().
+			SetHook("https://hooks.slack.com/services/T000/B000/XXXX").
+			SetUsername("bot").
+			SetTemplateId(templateId).
+			Build()
+
+		slack, err := NewSlack(opts, mockClient)
+		if err != nil {
+			t.Fatalf("failed to setup Slack: %v", err)
+		}
+		if _, err := slack.Send(context.Background(), models.Message{DeviceName: "Front door"}); err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		if mockClient.LastMessage.Text != expected {
+			t.Errorf("expected %q, got %q", expected, mockClient.LastMessage.Text)
+		}
+	}
+}
+
+func TestSlackSections(t *testing.T) {
+	mockClient := &MockSlackWebhookClient{}
+
+	opts := NewSlackOptions().
+		SetHook("https://hooks.slack.com/services/T000/B000/XXXX").
+		SetUsername("bot").
+		Build()
+
+	slack, err := NewSlack(opts, mockClient)
+	if err != nil {
+		t.Fatalf("failed to setup Slack: %v", err)
+	}
+
+	// A body longer than a section is split in section blocks
+	paragraph := strings.Repeat("Motion detected. ", 100)
+	message := models.Message{Body: "**Events**\n\n" + paragraph + "\n\n" + paragraph}
+	if _, err := slack.Send(context.Background(), message); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if mockClient.LastMessage.Blocks == nil || len(mockClient.LastMessage.Blocks.BlockSet) != 2 {
+		t.Fatalf("expected 2 section blocks got %+v", mockClient.LastMessage.Blocks)
+	}
+	if !strings.HasPrefix(mockClient.LastMessage.Text, "*Events*") {
+		t.Errorf("expected the first section as text, got %q", mockClient.LastMessage.Text)
+	}
+
+	// Sections beyond the maximum number of blocks are dropped, the last block is truncated
+	message = models.Message{Body: strings.Repeat(paragraph+"\n\n", format.SlackMaxBlocks+10)}
+	if _, err := slack.Send(context.Background(), message); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	blocks := mockClient.LastMessage.Blocks.BlockSet
+	if len(blocks) != format.SlackMaxBlocks {
+		t.Fatalf("expected %d section blocks got %d", format.SlackMaxBlocks, len(blocks))
+	}
+	last := sectionText(blocks[len(blocks)-1])
+	if !strings.HasSuffix(last, format.Ellipsis) || format.Length(last) > format.SlackBlockMaxLength {
+		t.Errorf("expected the last block to end with the ellipsis got %q", last)
+	}
+
+	// A short body is sent as text
+	if err := slack.SendText(context.Background(), "short", "https://uug.ai"); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if mockClient.LastMessage.Blocks != nil || mockClient.LastMessage.Text != "short\r\nhttps://uug.ai" {
+		t.Errorf("expected the text, got %q", mockClient.LastMessage.Text)
+	}
+}
+
+// sectionText returns the text of a section block
+func sectionText(block slack.Block) string {
+	if section, ok := block.(*slack.SectionBlock); ok && section.Text != nil {
+		return section.Text.Text
+	}
+	return ""
+}
@@ -1,18 +1,39 @@
 package integrations
 
 import (
+	"context"
+	"time"
+
 	"github.com/sfreiberg/gotwilio"
+	"github.com/uug-ai/integrations/pkg/format"
+	"github.com/uug-ai/integrations/pkg/templates"
 	"github.com/uug-ai/models/pkg/models"
 )
 
 type Sms struct {
-	AccountSID string `json:"accountsid,omitempty"`
-	AuthToken  string `json:"authtoken,omitempty"`
-	From       string `json:"from,omitempty"`
-	To         string `json:"to,omitempty"`
+	AccountSID string `json:"accountsid,omitempty" validate:"required"`
+	AuthToken  string `json:"authtoken,omitempty" validate:"required"`
+	From       string `json:"from,omitempty" validate:"required"`
+	To         string `json:"to,omitempty" validate:"required"`
+	// TemplateId is the named template the text is rendered with, from its short variant
+	TemplateId string `json:"template_id,omitempty"`
+	// Templates is the store of the named template, defaults to TemplateStore
+	Templates templates.Store `json:"-"`
+}
+
+func init() {
+	MustRegister(IntegrationSms, DecodeJSON[Sms], validated[Sms])
 }
 
-func (sms Sms) Send(m models.Message) bool {
+// Destination implements Destination, it returns the phone number the messages are sent to
+func (sms Sms) Destination() string {
+	return sms.To
+}
+
+func (sms Sms) Send(ctx context.Context, m models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationSms}
 
 	accountSid := sms.AccountSID
 	authToken := sms.AuthToken
@@ -20,8 +41,28 @@ func (sms Sms) Send(m models.Message) bool {
 
 	from := sms.From
 	to := sms.To
-	message := "This is a test message"
-	twilio.SendSMS(from, to, message, "", "")
+	message := m.Title + " " + m.Body
+	if sms.TemplateId != "" {
+		rendered, _, err := renderNamed(ctx, sms.Templates, sms.TemplateId, templates.VariantShort, m)
+		if err != nil {
+			return result.done(start, err)
+		}
+		message = rendered.Body
+	}
+	// The text is converted to plain text, and truncated to the longest SMS Twilio accepts
+	message = format.SMS.Render(message)[0]
+	response, exception, err := twilio.SendSMSWithContext(ctx, from, to, message, "", "")
+	if err != nil {
+		return result.done(start, err)
+	}
+	if exception != nil {
+		result.StatusCode = exception.Status
+		return result.done(start, exception)
+	}
 
-	return true
+	if response != nil {
+		result.MessageId = response.Sid
+	}
+	result.Recipients = []string{to}
+	return result.done(start, nil)
 }
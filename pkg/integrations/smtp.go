@@ -1,49 +1,389 @@
 package integrations
 
 import (
+	"bytes"
+	"cmp"
+	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/uug-ai/integrations/pkg/templates"
+	"github.com/uug-ai/models/pkg/models"
 	"gopkg.in/gomail.v2"
 )
 
 // MailClient is an interface for sending emails
 type MailClient interface {
-	DialAndSend(m ...*gomail.Message) error
-	Dial() (gomail.SendCloser, error)
+	DialAndSend(ctx context.Context, m ...*gomail.Message) error
+	Dial(ctx context.Context) (gomail.SendCloser, error)
 }
 
-// GomailClient wraps gomail.Dialer to implement MailClient interface
+// The TLS modes of the connection to the SMTP server
+const (
+	// TLSModeImplicit connects with TLS from the start, e.g. SMTPS on port 465
+	TLSModeImplicit = "implicit"
+	// TLSModeStartTLS upgrades the connection with STARTTLS, and fails when the server doesn't support it
+	TLSModeStartTLS = "starttls"
+	// TLSModeOpportunistic upgrades the connection with STARTTLS when the server supports it
+	TLSModeOpportunistic = "opportunistic"
+	// TLSModeNone never encrypts the connection
+	TLSModeNone = "none"
+)
+
+// GomailClient uses the settings of a gomail.Dialer to implement MailClient interface.
+// Contrary to gomail.Dialer, the connection honors the cancellation and deadline of a context.
 type GomailClient struct {
-	dialer *gomail.Dialer
+	dialer  *gomail.Dialer
+	tlsMode string
+	dkim    *DKIMSigner
+	auth    string
+	tokens  TokenSource
 }
 
-// NewGomailClient creates a new GomailClient with the provided SMTP settings
-func NewGomailClient(host string, port int, username, password string) MailClient {
+// NewGomailClient creates a new GomailClient with the provided SMTP settings. By default the
+// connection uses implicit TLS on port 465 and opportunistic STARTTLS on other ports, and the
+// certificate of the server is verified against the system roots.
+func NewGomailClient(host string, port int, username, password string, opts ...Option[GomailClient]) MailClient {
 	d := gomail.NewDialer(host, port, username, password)
-	d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-	return &GomailClient{dialer: d}
+	d.TLSConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	g := &GomailClient{dialer: d}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// WithTLS sets the TLS mode of the connection and the configuration it is encrypted with,
+// a nil configuration keeps the default configuration
+func WithTLS(mode string, config *tls.Config) Option[GomailClient] {
+	return func(g *GomailClient) {
+		g.tlsMode = mode
+		if config != nil {
+			g.dialer.TLSConfig = config
+		}
+	}
+}
+
+// WithAuth sets the authentication mechanism, see SMTPAuthPlain and the other mechanisms. Without
+// mechanism, the client authenticates with a mechanism the server supports when a username is set.
+// The token source provides the access tokens of SMTPAuthXOAuth2.
+func WithAuth(mechanism string, tokens TokenSource) Option[GomailClient] {
+	return func(g *GomailClient) {
+		g.auth = mechanism
+		g.tokens = tokens
+	}
+}
+
+// WithDKIM signs the emails with the DKIM signer
+func WithDKIM(signer *DKIMSigner) Option[GomailClient] {
+	return func(g *GomailClient) {
+		g.dkim = signer
+	}
+}
+
+// mode returns the TLS mode of the connection, the mode of gomail when none is set
+func (g *GomailClient) mode() string {
+	switch {
+	case g.tlsMode != "":
+		return g.tlsMode
+	case g.dialer.SSL:
+		return TLSModeImplicit
+	default:
+		return TLSModeOpportunistic
+	}
 }
 
 // DialAndSend implements MailClient interface
-func (g *GomailClient) DialAndSend(m ...*gomail.Message) error {
-	return g.dialer.DialAndSend(m...)
+func (g *GomailClient) DialAndSend(ctx context.Context, m ...*gomail.Message) error {
+	s, err := g.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return gomail.Send(s, m...)
+}
+
+// Dial implements MailClient interface. It connects and authenticates to the SMTP server,
+// the returned SendCloser should be closed when done using it.
+func (g *GomailClient) Dial(ctx context.Context) (gomail.SendCloser, error) {
+	d := g.dialer
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(d.Host, strconv.Itoa(d.Port)))
+	if err != nil {
+		return nil, err
+	}
+
+	// Abort any pending read or write on the connection when the context is done
+	sender := &smtpSender{conn: conn, dkim: g.dkim}
+	sender.bind(ctx)
+
+	c, err := g.handshake(ctx, conn)
+	if err != nil {
+		sender.bind(nil)
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	sender.client = c
+	return sender, nil
+}
+
+// handshake greets the SMTP server, upgrades the connection to TLS and authenticates
+func (g *GomailClient) handshake(ctx context.Context, conn net.Conn) (*smtp.Client, error) {
+	d := g.dialer
+	mode := g.mode()
+	tlsConfig := d.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: d.Host}
+	}
+
+	if mode == TLSModeImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, d.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.LocalName != "" {
+		if err := c.Hello(d.LocalName); err != nil {
+			return nil, err
+		}
+	}
+
+	if mode == TLSModeStartTLS || mode == TLSModeOpportunistic {
+		ok, _ := c.Extension("STARTTLS")
+		if ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return nil, err
+			}
+		} else if mode == TLSModeStartTLS {
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+	}
+
+	auth, err := g.authentication(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			// The next connection requests a new access token, instead of the rejected one
+			if invalidator, ok := g.tokens.(interface{ Invalidate() }); ok && g.auth == SMTPAuthXOAuth2 {
+				invalidator.Invalidate()
+			}
+			return nil, err
+		}
+	}
+
+	return c, nil
 }
 
-// Dial implements MailClient interface
-func (g *GomailClient) Dial() (gomail.SendCloser, error) {
-	return g.dialer.Dial()
+// authentication returns the authentication of the selected mechanism. Without mechanism, it
+// returns the strongest mechanism the server supports, or none when no username is set.
+func (g *GomailClient) authentication(ctx context.Context, c *smtp.Client) (smtp.Auth, error) {
+	d := g.dialer
+	switch g.auth {
+	case SMTPAuthNone:
+		return nil, nil
+	case SMTPAuthPlain:
+		return smtp.PlainAuth("", d.Username, d.Password, d.Host), nil
+	case SMTPAuthLogin:
+		return &loginAuth{username: d.Username, password: d.Password, host: d.Host}, nil
+	case SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(d.Username, d.Password), nil
+	case SMTPAuthXOAuth2:
+		if g.tokens == nil {
+			return nil, errors.New("xoauth2 authentication requires a token source")
+		}
+		token, err := g.tokens.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &xoauth2Auth{username: d.Username, token: token, host: d.Host}, nil
+	}
+
+	if d.Auth != nil || d.Username == "" {
+		return d.Auth, nil
+	}
+	ok, auths := c.Extension("AUTH")
+	switch {
+	case !ok:
+		return nil, nil
+	case strings.Contains(auths, "CRAM-MD5"):
+		return smtp.CRAMMD5Auth(d.Username, d.Password), nil
+	case strings.Contains(auths, "LOGIN") && !strings.Contains(auths, "PLAIN"):
+		return &loginAuth{username: d.Username, password: d.Password, host: d.Host}, nil
+	default:
+		return smtp.PlainAuth("", d.Username, d.Password, d.Host), nil
+	}
+}
+
+// smtpSender implements gomail.SendCloser on top of an authenticated SMTP connection
+type smtpSender struct {
+	client *smtp.Client
+	conn   net.Conn
+	dkim   *DKIMSigner
+
+	mu   sync.Mutex
+	ctx  context.Context
+	stop func() bool
+}
+
+// bind aborts any pending read or write on the connection when ctx is done, instead of when
+// the context it was bound to before is done. A nil context unbinds the connection.
+func (s *smtpSender) bind(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		s.stop()
+		s.stop = nil
+	}
+	s.ctx = ctx
+	s.conn.SetDeadline(time.Time{})
+	if ctx == nil {
+		return
+	}
+	s.stop = context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// The connection could have been bound to another context in the meantime
+		if s.ctx == ctx {
+			s.conn.SetDeadline(time.Now())
+		}
+	})
+}
+
+// Reset aborts the current mail transaction, and checks that the connection is still alive
+func (s *smtpSender) Reset() error {
+	return s.client.Reset()
+}
+
+// Send implements gomail.Sender interface
+func (s *smtpSender) Send(from string, to []string, msg io.WriterTo) error {
+	// The email is signed before the transaction starts, a failing signature doesn't leave it open
+	if s.dkim != nil {
+		var buf bytes.Buffer
+		if _, err := msg.WriteTo(&buf); err != nil {
+			return err
+		}
+		signed, err := s.dkim.Sign(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		msg = bytes.NewReader(signed)
+	}
+
+	if err := s.client.Mail(from); err != nil {
+		return &beforeDataError{err}
+	}
+	for _, addr := range to {
+		if err := s.client.Rcpt(addr); err != nil {
+			return &beforeDataError{err}
+		}
+	}
+	w, err := s.client.Data()
+	if err != nil {
+		return &beforeDataError{err}
+	}
+	if _, err := msg.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// beforeDataError is an error of the transaction before the email is transferred with DATA,
+// so the server can't have accepted the email
+type beforeDataError struct {
+	err error
+}
+
+func (e *beforeDataError) Error() string {
+	return e.err.Error()
+}
+
+func (e *beforeDataError) Unwrap() error {
+	return e.err
+}
+
+// Close implements gomail.SendCloser interface
+func (s *smtpSender) Close() error {
+	err := s.client.Quit()
+	s.bind(nil)
+	s.conn.Close()
+	return err
 }
 
 // SMTPOptions holds the configuration for SMTP
 type SMTPOptions struct {
-	Server    string `validate:"required"`
-	Port      int    `validate:"required,gt=0"`
-	Username  string `validate:"required"`
-	Password  string `validate:"required"`
-	EmailFrom string `validate:"required,email"`
-	EmailTo   string `validate:"required,email"`
+	Server    string `json:"server,omitempty" validate:"required"`
+	Port      int    `json:"port,omitempty" validate:"required,gt=0"`
+	Username  string `json:"username,omitempty" validate:"required_unless=Auth none"`
+	Password  string `json:"password,omitempty"`
+	EmailFrom string `json:"email_from,omitempty" validate:"required,email"`
+	EmailTo   string `json:"email_to,omitempty" validate:"required_without=EmailToList,omitempty,email"`
+	// EmailFromDisplay is the display name of the sender, e.g. "UUG AI Alerts"
+	EmailFromDisplay string `json:"email_from_display,omitempty"`
+	// EmailToList, EmailCc and EmailBcc are the (additional) To, Cc and Bcc recipients
+	EmailToList []string `json:"email_to_list,omitempty" validate:"dive,email"`
+	EmailCc     []string `json:"email_cc,omitempty" validate:"dive,email"`
+	EmailBcc    []string `json:"email_bcc,omitempty" validate:"dive,email"`
+	// EmailReplyTo is the address replies are sent to, instead of the sender
+	EmailReplyTo string `json:"email_reply_to,omitempty" validate:"omitempty,email"`
+	// Headers are added to every email, e.g. List-Unsubscribe or X-Entity-Ref-ID
+	Headers map[string]string `json:"headers,omitempty"`
+	// TitleTemplate, BodyTemplate and HTMLTemplate render the subject, the plain text and the
+	// HTML body of the email from the message, see the templates package for the variables
+	TitleTemplate string `json:"title_template,omitempty"`
+	BodyTemplate  string `json:"body_template,omitempty"`
+	HTMLTemplate  string `json:"html_template,omitempty"`
+	// TemplateId is the named template the email is rendered with, from its subject, html and text
+	// variants. It takes precedence over the title, body and HTML templates.
+	TemplateId string `json:"template_id,omitempty"`
+	// Templates is the store of the named template, defaults to TemplateStore
+	Templates templates.Store `json:"-"`
+	// TLSMode is the TLS mode of the connection: "implicit", "starttls", "opportunistic" or "none".
+	// It defaults to implicit TLS on port 465 and opportunistic STARTTLS on other ports.
+	TLSMode string `json:"tls_mode,omitempty" validate:"omitempty,oneof=implicit starttls opportunistic none"`
+	// TLS holds the CA bundle, client certificate, server name and minimum version of the connection
+	TLS TLSOptions `json:"tls,omitempty"`
+	// Auth is the authentication mechanism: "none", "plain", "login", "cram-md5" or "xoauth2".
+	// It defaults to the strongest mechanism the server supports. The username and password
+	// aren't required without authentication, and XOAUTH2 uses an access token instead of the password.
+	Auth string `json:"auth,omitempty" validate:"omitempty,oneof=none plain login cram-md5 xoauth2"`
+	// OAuth2 holds the token endpoint the access tokens of XOAUTH2 are requested at
+	OAuth2 OAuth2Options `json:"oauth2,omitempty"`
+	// TokenSource provides the access tokens of XOAUTH2, instead of the OAuth2 token endpoint
+	TokenSource TokenSource `json:"-"`
+	// DKIM holds the domain, selector and private key the emails are signed with, see DKIMOptions
+	DKIM DKIMOptions `json:"dkim,omitempty"`
+	// InlineThumbnail embeds the thumbnail of the message in the HTML body, see ThumbnailCID
+	InlineThumbnail bool `json:"inline_thumbnail,omitempty"`
+	// ThumbnailMaxSize is the largest thumbnail which is inlined in bytes, defaults to DefaultThumbnailMaxSize
+	ThumbnailMaxSize int64 `json:"thumbnail_max_size,omitempty" validate:"gte=0"`
+	// AttachmentMaxSize is the largest attachment read from a reader or url in bytes, defaults to DefaultAttachmentMaxSize
+	AttachmentMaxSize int64 `json:"attachment_max_size,omitempty" validate:"gte=0"`
+	// PoolSize is the number of connections kept open and reused for the next emails, see SMTPPool.
+	// Without pool, a connection is opened for every email.
+	PoolSize int `json:"pool_size,omitempty" validate:"gte=0"`
+	// PoolIdleTimeout is the time an unused connection is kept open, defaults to DefaultPoolIdleTimeout
+	PoolIdleTimeout time.Duration `json:"pool_idle_timeout,omitempty" validate:"gte=0"`
 }
 
 // SMTPOptionsBuilder provides a fluent interface for building SMTP options
@@ -94,15 +434,237 @@ func (b *SMTPOptionsBuilder) SetTo(emailTo string) *SMTPOptionsBuilder {
 	return b
 }
 
+// SetFromDisplay sets the display name of the sender
+func (b *SMTPOptionsBuilder) SetFromDisplay(name string) *SMTPOptionsBuilder {
+	b.options.EmailFromDisplay = name
+	return b
+}
+
+// AddTo adds recipient email addresses, next to the address set with SetTo
+func (b *SMTPOptionsBuilder) AddTo(emails ...string) *SMTPOptionsBuilder {
+	b.options.EmailToList = append(b.options.EmailToList, emails...)
+	return b
+}
+
+// AddCc adds Cc recipient email addresses
+func (b *SMTPOptionsBuilder) AddCc(emails ...string) *SMTPOptionsBuilder {
+	b.options.EmailCc = append(b.options.EmailCc, emails...)
+	return b
+}
+
+// AddBcc adds Bcc recipient email addresses, they are not visible to the other recipients
+func (b *SMTPOptionsBuilder) AddBcc(emails ...string) *SMTPOptionsBuilder {
+	b.options.EmailBcc = append(b.options.EmailBcc, emails...)
+	return b
+}
+
+// SetReplyTo sets the address replies are sent to
+func (b *SMTPOptionsBuilder) SetReplyTo(email string) *SMTPOptionsBuilder {
+	b.options.EmailReplyTo = email
+	return b
+}
+
+// SetHeader sets a header which is added to every email, e.g. List-Unsubscribe
+func (b *SMTPOptionsBuilder) SetHeader(name string, value string) *SMTPOptionsBuilder {
+	if b.options.Headers == nil {
+		b.options.Headers = map[string]string{}
+	}
+	b.options.Headers[name] = value
+	return b
+}
+
+// SetInlineThumbnail embeds the thumbnail of the message in the HTML body of the email
+func (b *SMTPOptionsBuilder) SetInlineThumbnail(inline bool) *SMTPOptionsBuilder {
+	b.options.InlineThumbnail = inline
+	return b
+}
+
+// SetThumbnailMaxSize sets the largest thumbnail which is inlined, in bytes
+func (b *SMTPOptionsBuilder) SetThumbnailMaxSize(size int64) *SMTPOptionsBuilder {
+	b.options.ThumbnailMaxSize = size
+	return b
+}
+
+// SetAttachmentMaxSize sets the largest attachment read from a reader or url, in bytes
+func (b *SMTPOptionsBuilder) SetAttachmentMaxSize(size int64) *SMTPOptionsBuilder {
+	b.options.AttachmentMaxSize = size
+	return b
+}
+
+// SetTitleTemplate sets the template the subject of the email is rendered with
+func (b *SMTPOptionsBuilder) SetTitleTemplate(template string) *SMTPOptionsBuilder {
+	b.options.TitleTemplate = template
+	return b
+}
+
+// SetBodyTemplate sets the template the plain text body of the email is rendered with
+func (b *SMTPOptionsBuilder) SetBodyTemplate(template string) *SMTPOptionsBuilder {
+	b.options.BodyTemplate = template
+	return b
+}
+
+// SetHTMLTemplate sets the template the HTML body of the email is rendered with, the values
+// of the message are escaped
+func (b *SMTPOptionsBuilder) SetHTMLTemplate(template string) *SMTPOptionsBuilder {
+	b.options.HTMLTemplate = template
+	return b
+}
+
+// SetTemplateId sets the named template the email is rendered with
+func (b *SMTPOptionsBuilder) SetTemplateId(templateId string) *SMTPOptionsBuilder {
+	b.options.TemplateId = templateId
+	return b
+}
+
+// SetTemplateStore sets the store the named template is loaded from
+func (b *SMTPOptionsBuilder) SetTemplateStore(store templates.Store) *SMTPOptionsBuilder {
+	b.options.Templates = store
+	return b
+}
+
+// SetTLSMode sets the TLS mode of the connection, see TLSModeImplicit, TLSModeStartTLS,
+// TLSModeOpportunistic and TLSModeNone
+func (b *SMTPOptionsBuilder) SetTLSMode(mode string) *SMTPOptionsBuilder {
+	b.options.TLSMode = mode
+	return b
+}
+
+// SetTLSCACertificates sets the PEM bundle of the certificate authorities the certificate of the
+// server is verified with, instead of the system roots
+func (b *SMTPOptionsBuilder) SetTLSCACertificates(bundle string) *SMTPOptionsBuilder {
+	b.options.TLS.CACertificates = bundle
+	return b
+}
+
+// SetTLSClientCertificate sets the PEM encoded client certificate and private key
+func (b *SMTPOptionsBuilder) SetTLSClientCertificate(certificate string, key string) *SMTPOptionsBuilder {
+	b.options.TLS.Certificate = certificate
+	b.options.TLS.Key = key
+	return b
+}
+
+// SetTLSServerName sets the name the certificate of the server is verified for, defaults to the server
+func (b *SMTPOptionsBuilder) SetTLSServerName(serverName string) *SMTPOptionsBuilder {
+	b.options.TLS.ServerName = serverName
+	return b
+}
+
+// SetTLSMinVersion sets the minimum TLS version: "1.0", "1.1", "1.2" or "1.3"
+func (b *SMTPOptionsBuilder) SetTLSMinVersion(version string) *SMTPOptionsBuilder {
+	b.options.TLS.MinVersion = version
+	return b
+}
+
+// SetTLSInsecureSkipVerify disables the verification of the certificate of the server, for testing only
+func (b *SMTPOptionsBuilder) SetTLSInsecureSkipVerify(insecure bool) *SMTPOptionsBuilder {
+	b.options.TLS.InsecureSkipVerify = insecure
+	return b
+}
+
+// SetAuth sets the authentication mechanism: "none", "plain", "login", "cram-md5" or "xoauth2"
+func (b *SMTPOptionsBuilder) SetAuth(mechanism string) *SMTPOptionsBuilder {
+	b.options.Auth = mechanism
+	return b
+}
+
+// SetOAuth2 sets the token endpoint the XOAUTH2 access tokens are requested at with the refresh token
+func (b *SMTPOptionsBuilder) SetOAuth2(tokenURL string, clientID string, clientSecret string, refreshToken string) *SMTPOptionsBuilder {
+	b.options.OAuth2.TokenURL = tokenURL
+	b.options.OAuth2.ClientID = clientID
+	b.options.OAuth2.ClientSecret = clientSecret
+	b.options.OAuth2.RefreshToken = refreshToken
+	return b
+}
+
+// SetOAuth2Scopes sets the scopes of the XOAUTH2 access tokens, e.g. "https://mail.google.com/"
+func (b *SMTPOptionsBuilder) SetOAuth2Scopes(scopes ...string) *SMTPOptionsBuilder {
+	b.options.OAuth2.Scopes = scopes
+	return b
+}
+
+// SetTokenSource sets the source of the XOAUTH2 access tokens
+func (b *SMTPOptionsBuilder) SetTokenSource(tokens TokenSource) *SMTPOptionsBuilder {
+	b.options.TokenSource = tokens
+	return b
+}
+
+// SetDKIM signs the emails for the domain with the selector and the PEM encoded RSA or Ed25519 private key
+func (b *SMTPOptionsBuilder) SetDKIM(domain string, selector string, privateKey string) *SMTPOptionsBuilder {
+	b.options.DKIM.Domain = domain
+	b.options.DKIM.Selector = selector
+	b.options.DKIM.PrivateKey = privateKey
+	return b
+}
+
+// SetDKIMHeaders sets the headers which are signed, defaults to DefaultDKIMHeaders
+func (b *SMTPOptionsBuilder) SetDKIMHeaders(headers ...string) *SMTPOptionsBuilder {
+	b.options.DKIM.Headers = headers
+	return b
+}
+
+// SetDKIMCanonicalization sets the header and body canonicalization, e.g. "relaxed/simple"
+func (b *SMTPOptionsBuilder) SetDKIMCanonicalization(canonicalization string) *SMTPOptionsBuilder {
+	b.options.DKIM.Canonicalization = canonicalization
+	return b
+}
+
+// SetPoolSize sets the number of connections kept open and reused for the next emails
+func (b *SMTPOptionsBuilder) SetPoolSize(size int) *SMTPOptionsBuilder {
+	b.options.PoolSize = size
+	return b
+}
+
+// SetPoolIdleTimeout sets the time an unused connection of the pool is kept open
+func (b *SMTPOptionsBuilder) SetPoolIdleTimeout(timeout time.Duration) *SMTPOptionsBuilder {
+	b.options.PoolIdleTimeout = timeout
+	return b
+}
+
 // Build returns the configured SMTPOptions
 func (b *SMTPOptionsBuilder) Build() *SMTPOptions {
 	return b.options
 }
 
+// The fields in the Data of a message which override the recipients of the email,
+// each holding a comma separated list of addresses
+const (
+	EmailToField  = "email_to"
+	EmailCcField  = "email_cc"
+	EmailBccField = "email_bcc"
+)
+
+// Recipients are the addresses an email is sent to
+type Recipients struct {
+	To  []string
+	Cc  []string
+	Bcc []string
+}
+
+// All returns the To, Cc and Bcc recipients
+func (r Recipients) All() []string {
+	all := make([]string, 0, len(r.To)+len(r.Cc)+len(r.Bcc))
+	all = append(all, r.To...)
+	all = append(all, r.Cc...)
+	return append(all, r.Bcc...)
+}
+
+// reservedHeaders are the headers set from the options, they can't be set as custom header
+var reservedHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Reply-To": true, "Subject": true,
+}
+
+func init() {
+	MustRegister(IntegrationSMTP, DecodeJSON[*SMTPOptions], func(opts *SMTPOptions) (Notifier, error) {
+		return NewSMTP(opts)
+	})
+}
+
 // SMTP represents an SMTP client instance
 type SMTP struct {
-	options *SMTPOptions
-	client  MailClient
+	options  *SMTPOptions
+	client   MailClient
+	template messageTemplate
+	html     *templates.Template
 }
 
 // NewSMTP creates a new SMTP client with the provided options
@@ -115,209 +677,320 @@ func NewSMTP(opts *SMTPOptions, client ...MailClient) (*SMTP, error) {
 		return nil, err
 	}
 
+	for name := range opts.Headers {
+		if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+			return nil, errors.New("header " + name + " is set from the options")
+		}
+	}
+
+	tmpl, err := newMessageTemplate(opts.TitleTemplate, opts.BodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var htmlTemplate *templates.Template
+	if opts.HTMLTemplate != "" {
+		htmlTemplate, err = templates.NewHTML("html", opts.HTMLTemplate, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig, err := opts.TLS.Config(opts.Server)
+	if err != nil {
+		return nil, err
+	}
+	tokens := opts.TokenSource
+	if tokens == nil && opts.OAuth2.TokenURL != "" {
+		tokens = NewOAuth2TokenSource(opts.OAuth2)
+	}
+	switch opts.Auth {
+	case SMTPAuthNone:
+	case SMTPAuthXOAuth2:
+		if tokens == nil {
+			return nil, errors.New("xoauth2 authentication requires a token source or an OAuth2 token endpoint")
+		}
+	default:
+		if opts.Password == "" {
+			return nil, errors.New("password is required")
+		}
+	}
+
+	clientOpts := []Option[GomailClient]{WithTLS(opts.TLSMode, tlsConfig), WithAuth(opts.Auth, tokens)}
+	if opts.DKIM.PrivateKey != "" {
+		signer, err := NewDKIMSigner(opts.DKIM)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, WithDKIM(signer))
+	}
+
 	// If no client provided, create default production client
 	var c MailClient
 	if len(client) == 0 {
-		c = NewGomailClient(opts.Server, opts.Port, opts.Username, opts.Password)
+		c = NewGomailClient(opts.Server, opts.Port, opts.Username, opts.Password, clientOpts...)
 	} else {
 		c = client[0]
 	}
+	if opts.PoolSize > 0 {
+		c = NewSMTPPool(c, opts.PoolSize, cmp.Or(opts.PoolIdleTimeout, DefaultPoolIdleTimeout))
+	}
 
 	return &SMTP{
-		options: opts,
-		client:  c,
+		options:  opts,
+		client:   c,
+		template: tmpl,
+		html:     htmlTemplate,
 	}, nil
 }
 
-// Send sends an email with the specified title, body (plain text), and textBody (HTML).
-// It validates that all parameters are non-empty, verifies connectivity to the SMTP server,
-// constructs an email message with the configured sender and recipient addresses, and sends it.
-//
-// Parameters:
-//   - title: The subject line of the email
-//   - body: The plain text content of the email
-//   - textBody: The HTML content of the email (added as an alternative format)
-//
-// Returns:
-//   - error: An error if title, body, or textBody is empty, if the SMTP server is unreachable,
-//     or if sending the email fails
-//
-// Note: The body parameter is set as plain text and textBody as HTML, which appears to be
-// reversed from the parameter names. Consider reviewing this implementation.
-func (s *SMTP) Send(title string, body string, textBody string) (err error) {
+// Destination implements Destination, it returns the To addresses the emails are sent to
+func (s *SMTP) Destination() string {
+	recipients, _ := s.Recipients(models.Message{})
+	return strings.Join(recipients.To, ", ")
+}
 
-	// Check if title and body are not empty
-	if title == "" {
-		return errors.New("empty title")
-	}
-	if body == "" {
-		return errors.New("empty body")
+// Recipients returns the recipients of the email for the message: the recipients of the options,
+// or the recipients in the Data of the message (see EmailToField, EmailCcField and EmailBccField)
+func (s *SMTP) Recipients(message models.Message) (Recipients, error) {
+	recipients := Recipients{Cc: s.options.EmailCc, Bcc: s.options.EmailBcc}
+	if s.options.EmailTo != "" {
+		recipients.To = append(recipients.To, s.options.EmailTo)
 	}
-	if textBody == "" {
-		return errors.New("empty text body")
+	recipients.To = append(recipients.To, s.options.EmailToList...)
+
+	var err error
+	for field, list := range map[string]*[]string{EmailToField: &recipients.To, EmailCcField: &recipients.Cc, EmailBccField: &recipients.Bcc} {
+		if value, ok := message.Data[field]; ok {
+			if *list, err = parseAddressList(value); err != nil {
+				return recipients, fmt.Errorf("invalid %s: %w", field, err)
+			}
+		}
 	}
+	return recipients, nil
+}
 
-	// Check if we can dial to the server
-	_, err = s.client.Dial()
+// parseAddressList parses a comma separated list of addresses, e.g. "Jane <jane@example.com>, john@example.com"
+func parseAddressList(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	addresses, err := mail.ParseAddressList(list)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// Create the message
-	m := gomail.NewMessage()
-	m.SetHeader("From", s.options.EmailFrom)
-	m.SetHeader("To", s.options.EmailTo)
-	m.SetHeader("Subject", title)
-
-	// Replace needs to be moved outside and placed in the hub-pipeline-notification
-	//body := templates.GetTemplate(smtp.TemplateId)
-	//textBody := templates.GetTextTemplate(smtp.TemplateId)
-	// Replace variables in the template
-	//body = ReplaceValues(body, models.Message{})
-	//textBody = ReplaceValues(textBody, models.Message{})
-
-	m.SetBody("text/plain", body)
-	m.AddAlternative("text/html", textBody)
-
-	// Send the email
-	err = s.client.DialAndSend(m)
-	return err
+	parsed := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if address.Name == "" {
+			parsed = append(parsed, address.Address)
+		} else {
+			parsed = append(parsed, address.String())
+		}
+	}
+	return parsed, nil
 }
 
-// This function will replace the variables in the email template. We have following variables available:
-// - {{user}}: user that triggered the message
-// - {{text}}: text of the message
-// - {{link}}: link to the media (recording)
-//
-// - {{thumbnail}}: image (either a base64 or a url).
-// - {{classifications}}: list of classifications detected in the recording.
-//
-// - {{timezone}}: timezone of the account generating the event
-//
-// - {{date}}: date of the media
-// - {{time}}: time of the media
-// - {{datetime}}: datetime of the media
-//
-// - {{eventdate}}: date of the notification
-// - {{eventtime}}: time of the notification
-// - {{eventdatetime}}: datetime of the notification
-//
-// - {{devicename}}: device generating the event
-// - {{deviceid}}: device generating the event
-// - {{sites}}: the list of sites the device is part of
-// - {{groups}}: the list of groups the device is part of
-// - {{numberOfMedia}}: number of media attached to the message
-// - {{dataUsage}}: data usage of the message
-
-/*func ReplaceValues(body string, message models.Message) string {
-
-	body = strings.ReplaceAll(body, "{{tab1_title}}", "")
-	body = strings.ReplaceAll(body, "{{tab2_title}}", "")
-
-	if message.NumberOfMedia != "" {
-		body = strings.ReplaceAll(body, "{{numberOfMedia}}", message.NumberOfMedia)
+// Send implements Notifier. It sends the title of the message as subject, and the body
+// both as plain text and as (escaped) HTML alternative. When templates are configured,
+// the subject and bodies are rendered from the message instead. The recipients can be
+// overridden by the Data of the message, see Recipients.
+func (s *SMTP) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationSMTP}
+	recipients, err := s.Recipients(message)
+	if err != nil {
+		return result.done(start, err)
 	}
-	if message.DataUsage != "" {
-		body = strings.ReplaceAll(body, "{{dataUsage}}", message.DataUsage)
+	if s.options.TemplateId != "" {
+		if err := s.sendTemplate(ctx, recipients, s.options.TemplateId, message); err != nil {
+			return result.done(start, err)
+		}
+		result.Recipients = recipients.All()
+		return result.done(start, nil)
 	}
 
-	// Add the variables to be used by the template
-	//body = strings.ReplaceAll(body, "{{user}}", "")
-	if message.User != "" {
-		body = strings.ReplaceAll(body, "{{user}}", message.User)
-	} else {
-		body = strings.ReplaceAll(body, "{{user}}", message.Data["user"])
+	rendered, err := s.template.render(message)
+	if err != nil {
+		return result.done(start, err)
 	}
+	htmlBody := strings.ReplaceAll(html.EscapeString(rendered.Body), "\n", "<br>")
+	if s.html != nil {
+		if htmlBody, err = s.html.Render(message); err != nil {
+			return result.done(start, err)
+		}
+	}
+	htmlBody, attachments := s.inlineThumbnail(ctx, message, htmlBody)
+	if err := s.SendEmailTo(ctx, recipients, rendered.Title, rendered.Body, htmlBody, attachments...); err != nil {
+		return result.done(start, err)
+	}
+	result.Recipients = recipients.All()
+	return result.done(start, nil)
+}
 
-	body = strings.ReplaceAll(body, "{{text}}", message.Body)
-
-	// {{link}} this will inject a link to the media (recording)
-	if len(message.Media) > 0 {
-		longUrl := message.Media[0].AtRuntimeMetadata.VideoUrl
-		body = strings.ReplaceAll(body, "{{link}}", longUrl)
+// SendBatch sends every message as email, e.g. a digest to many users, and returns the results
+// in the order of the messages. With a pool, the emails are sent concurrently on at most PoolSize
+// connections, otherwise one by one. A failing email doesn't stop the other emails.
+func (s *SMTP) SendBatch(ctx context.Context, messages []models.Message) []DeliveryResult {
+	results := make([]DeliveryResult, len(messages))
+	slots := make(chan struct{}, max(s.options.PoolSize, 1))
+
+	var wg sync.WaitGroup
+	for i, message := range messages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				results[i], _ = s.Send(ctx, message)
+			case <-ctx.Done():
+				results[i] = DeliveryResult{
+					Integration: IntegrationSMTP,
+					Error:       &DeliveryError{Integration: IntegrationSMTP, Err: ctx.Err()},
+				}
+			}
+		}()
 	}
-	if message.Data["link"] != "" {
-		body = strings.ReplaceAll(body, "{{link}}", message.Data["link"])
+	wg.Wait()
+	return results
+}
+
+// Close closes the connections kept open by the pool
+func (s *SMTP) Close() error {
+	if pool, ok := s.client.(*SMTPPool); ok {
+		return pool.Close()
 	}
+	return nil
+}
 
-	// {{thumbnail}} this will inject an image (either a base64 or a url).
-	if message.Thumbnail != "" {
-		body = strings.ReplaceAll(body, "{{thumbnail}}", "<img src='base64:"+message.Thumbnail+"' width='400px' height='auto' />")
-	} else if len(message.Media) > 0 && message.Media[0].AtRuntimeMetadata.ThumbnailUrl != "" {
-		body = strings.ReplaceAll(body, "{{thumbnail}}", "<img src='"+message.Media[0].AtRuntimeMetadata.ThumbnailUrl+"' width='400px' height='auto' />")
+// SendTemplate renders the named template for the message and sends it as email. The subject
+// is rendered from the subject variant (or is the title of the message), the bodies from the
+// text and html variants. A template needs at least one of both bodies.
+func (s *SMTP) SendTemplate(ctx context.Context, templateId string, message models.Message) error {
+	recipients, err := s.Recipients(message)
+	if err != nil {
+		return err
 	}
+	return s.sendTemplate(ctx, recipients, templateId, message)
+}
 
-	// {{classifications}} this will inject a list of classifications detected in the recording.
-	if len(message.Classifications) > 0 {
-		body = strings.ReplaceAll(body, "{{classifications}}", strings.Join(message.Classifications, ", "))
+// sendTemplate renders the named template for the message and sends it to the recipients
+func (s *SMTP) sendTemplate(ctx context.Context, recipients Recipients, templateId string, message models.Message) error {
+	set, err := namedTemplate(ctx, s.options.Templates, templateId)
+	if err != nil {
+		return err
 	}
 
-	// {{date}} {{time}} {{datetime}} of the start.
-	if len(message.Media) > 0 && message.Media[0].StartTimestamp > 0 {
-		t := time.Unix(message.Media[0].StartTimestamp, 0)
-		// Get time with timezone
-		if message.Timezone != "" {
-			loc, _ := time.LoadLocation(message.Timezone)
-			t = t.In(loc)
+	title := message.Title
+	var body, htmlBody string
+	if t := set.Select(templates.VariantSubject, message); t != nil {
+		if title, err = t.Render(message); err != nil {
+			return err
 		}
-		body = strings.ReplaceAll(body, "{{date}}", t.Format("2006-01-02"))
-		body = strings.ReplaceAll(body, "{{time}}", t.Format("15:04:05"))
-		body = strings.ReplaceAll(body, "{{datetime}}", t.Format("2006-01-02 15:04:05"))
-	}
-
-	// {{eventtime}} of the notification
-	if message.Timestamp > 0 {
-		t := time.Unix(message.Timestamp, 0)
-		// Get time with timezone
-		if message.Timezone != "" {
-			loc, _ := time.LoadLocation(message.Timezone)
-			t = t.In(loc)
+	}
+	if t := set.Select(templates.VariantText, message); t != nil {
+		if body, err = t.Render(message); err != nil {
+			return err
 		}
-		body = strings.ReplaceAll(body, "{{eventdate}}", t.Format("2006-01-02"))
-		body = strings.ReplaceAll(body, "{{eventtime}}", t.Format("15:04:05"))
-		body = strings.ReplaceAll(body, "{{eventdatetime}}", t.Format("2006-01-02 15:04:05"))
 	}
-
-	// {{timezone}} of the account generating the event
-	if message.Timezone != "" {
-		body = strings.ReplaceAll(body, "{{timezone}}", message.Timezone)
+	if t := set.Select(templates.VariantHTML, message); t != nil {
+		if htmlBody, err = t.Render(message); err != nil {
+			return err
+		}
 	}
+	htmlBody, attachments := s.inlineThumbnail(ctx, message, htmlBody)
+	return s.SendEmailTo(ctx, recipients, title, body, htmlBody, attachments...)
+}
 
-	// {{devicename}} {{deviceid}} device generating the event
-	if message.DeviceId != "" {
-		body = strings.ReplaceAll(body, "{{deviceid}}", message.DeviceId)
+// inlineThumbnail returns the HTML body showing the thumbnail of the message, and the thumbnail as
+// inline attachment, when the options inline thumbnails. The email is sent without thumbnail when the
+// message has none, or when it is too large or can't be downloaded.
+func (s *SMTP) inlineThumbnail(ctx context.Context, message models.Message, htmlBody string) (string, []Attachment) {
+	if !s.options.InlineThumbnail || htmlBody == "" {
+		return htmlBody, nil
 	}
-	if message.DeviceName != "" {
-		body = strings.ReplaceAll(body, "{{devicename}}", message.DeviceName)
+	attachment, ok := thumbnail(ctx, message, cmp.Or(s.options.ThumbnailMaxSize, DefaultThumbnailMaxSize))
+	if !ok {
+		return htmlBody, nil
 	}
+	return withThumbnail(htmlBody), []Attachment{attachment}
+}
 
-	// {{sites}} the list of sites the device is part of
-	if len(message.Sites) > 0 {
-		// get names of sites slice (extract name)
-		sitesName := []string{}
-		for _, site := range message.Sites {
-			sitesName = append(sitesName, site.Name)
-		}
-		body = strings.ReplaceAll(body, "{{sites}}", strings.Join(sitesName, ", "))
+// SendEmail sends an email with the specified title, body (plain text), textBody (HTML) and
+// attachments to the recipients of the options, see SendEmailTo.
+func (s *SMTP) SendEmail(ctx context.Context, title string, body string, textBody string, attachments ...Attachment) error {
+	recipients, _ := s.Recipients(models.Message{})
+	return s.SendEmailTo(ctx, recipients, title, body, textBody, attachments...)
+}
+
+// SendEmailTo sends an email with the specified title, body (plain text), and textBody (HTML)
+// to the recipients. It validates the parameters, constructs an email message with the configured
+// sender, reply-to address and headers, and sends it over a new connection to the SMTP server, or
+// over a connection of the pool when PoolSize is set.
+//
+// Parameters:
+//   - ctx: The context of the request, used for cancellation and deadlines
+//   - recipients: The To, Cc and Bcc addresses of the email, Bcc addresses are not visible to the others
+//   - title: The subject line of the email
+//   - body: The plain text content of the email, may be empty when textBody is set
+//   - textBody: The HTML content of the email (added as an alternative format), may be empty
+//   - attachments: Files attached to the email, or embedded in the HTML body when inline
+//
+// Returns:
+//   - error: An error if there are no recipients, if title is empty, if both body and textBody
+//     are empty, if an attachment can't be loaded, if the SMTP server is unreachable, or if
+//     sending the email fails
+func (s *SMTP) SendEmailTo(ctx context.Context, recipients Recipients, title string, body string, textBody string, attachments ...Attachment) (err error) {
+
+	// Check if there are recipients, and title and body are not empty
+	if len(recipients.All()) == 0 {
+		return errors.New("no recipients")
+	}
+	if title == "" {
+		return errors.New("empty title")
+	}
+	if body == "" && textBody == "" {
+		return errors.New("empty body")
 	}
 
-	// {{groups}} the list of groups the device is part of
-	if len(message.Groups) > 0 {
-		// get names of groups slice (extract name)
-		groupsName := []string{}
-		for _, group := range message.Groups {
-			groupsName = append(groupsName, group.Name)
-		}
-		body = strings.ReplaceAll(body, "{{groups}}", strings.Join(groupsName, ", "))
+	// Create the message
+	m := gomail.NewMessage()
+	if s.options.EmailFromDisplay != "" {
+		m.SetAddressHeader("From", s.options.EmailFrom, s.options.EmailFromDisplay)
+	} else {
+		m.SetHeader("From", s.options.EmailFrom)
+	}
+	if len(recipients.To) > 0 {
+		m.SetHeader("To", recipients.To...)
 	}
+	if len(recipients.Cc) > 0 {
+		m.SetHeader("Cc", recipients.Cc...)
+	}
+	if len(recipients.Bcc) > 0 {
+		m.SetHeader("Bcc", recipients.Bcc...)
+	}
+	if s.options.EmailReplyTo != "" {
+		m.SetHeader("Reply-To", s.options.EmailReplyTo)
+	}
+	for name, value := range s.options.Headers {
+		m.SetHeader(name, value)
+	}
+	m.SetHeader("Subject", title)
 
-	// Whipe out all variables with the {{variable}} syntax (regex: {{.*}})
-	body = strings.ReplaceAll(body, "{{.*}}", "")
+	switch {
+	case textBody == "":
+		m.SetBody("text/plain", body)
+	case body == "":
+		m.SetBody("text/html", textBody)
+	default:
+		m.SetBody("text/plain", body)
+		m.AddAlternative("text/html", textBody)
+	}
 
-	// Iterate over data object and modify
-	for key, element := range message.Data {
-		body = strings.ReplaceAll(body, "{{"+key+"}}", element)
+	// Attachments are loaded before connecting, so a missing attachment doesn't hold a connection
+	if err := attach(ctx, m, attachments, cmp.Or(s.options.AttachmentMaxSize, DefaultAttachmentMaxSize)); err != nil {
+		return err
 	}
 
-	return body
-}*/
+	// Send the email
+	return s.client.DialAndSend(ctx, m)
+}
@@ -0,0 +1,179 @@
+package integrations
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/uug-ai/models/pkg/models"
+	"gopkg.in/gomail.v2"
+)
+
+// The default size limits of attachments, in bytes
+const (
+	// DefaultAttachmentMaxSize is the largest attachment read from a reader or downloaded from a URL
+	DefaultAttachmentMaxSize = 10 << 20
+	// DefaultThumbnailMaxSize is the largest thumbnail which is inlined in an email
+	DefaultThumbnailMaxSize = 1 << 20
+)
+
+// ThumbnailCID is the content ID of the inlined thumbnail of the message, an HTML template shows it with
+// <img src="cid:thumbnail.jpg">. Without reference in the HTML body, it is shown at the end of the body.
+const ThumbnailCID = "thumbnail.jpg"
+
+// ErrAttachmentTooLarge is returned when an attachment exceeds the maximum size
+var ErrAttachmentTooLarge = errors.New("attachment exceeds the maximum size")
+
+// Attachment is a file attached to an email. An inline attachment is embedded in the HTML body,
+// and referenced by its name as content ID, e.g. <img src="cid:snapshot.jpg">.
+// The content is read from Data, Reader or Url, in that order.
+type Attachment struct {
+	// Name is the file name of the attachment, the content type is derived from its extension
+	Name string
+	// ContentType overrides the content type derived from the name, e.g. "image/jpeg"
+	ContentType string
+	Inline      bool
+	Data        []byte
+	Reader      io.Reader
+	Url         string
+}
+
+// AttachmentFromBytes creates an attachment with the content of data
+func AttachmentFromBytes(name string, data []byte) Attachment {
+	return Attachment{Name: name, Data: data}
+}
+
+// AttachmentFromReader creates an attachment with the content of the reader, it is read when the email is sent
+func AttachmentFromReader(name string, reader io.Reader) Attachment {
+	return Attachment{Name: name, Reader: reader}
+}
+
+// AttachmentFromURL creates an attachment with the content downloaded from the url when the email is sent
+func AttachmentFromURL(name string, url string) Attachment {
+	return Attachment{Name: name, Url: url}
+}
+
+// AsInline returns the attachment embedded in the HTML body, instead of attached to the email
+func (a Attachment) AsInline() Attachment {
+	a.Inline = true
+	return a
+}
+
+// load reads the content of the attachment, which should not exceed max bytes
+func (a Attachment) load(ctx context.Context, max int64) ([]byte, error) {
+	if a.Name == "" {
+		return nil, errors.New("attachment name is required")
+	}
+	switch {
+	case a.Data != nil:
+		return a.Data, nil
+	case a.Reader != nil:
+		return readLimited(a.Reader, max)
+	case a.Url != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.Url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("attachment %s: download failed with status: %s", a.Name, resp.Status)
+		}
+		if resp.ContentLength > max {
+			return nil, fmt.Errorf("attachment %s: %w", a.Name, ErrAttachmentTooLarge)
+		}
+		return readLimited(resp.Body, max)
+	default:
+		return nil, fmt.Errorf("attachment %s has no content", a.Name)
+	}
+}
+
+// readLimited reads the reader, and fails when it holds more than max bytes
+func readLimited(reader io.Reader, max int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, ErrAttachmentTooLarge
+	}
+	return data, nil
+}
+
+// attach loads the attachments and adds them to the email
+func attach(ctx context.Context, m *gomail.Message, attachments []Attachment, max int64) error {
+	for _, attachment := range attachments {
+		data, err := attachment.load(ctx, max)
+		if err != nil {
+			return err
+		}
+		settings := []gomail.FileSetting{
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			}),
+		}
+		if attachment.ContentType != "" {
+			settings = append(settings, gomail.SetHeader(map[string][]string{"Content-Type": {attachment.ContentType}}))
+		}
+		if attachment.Inline {
+			m.Embed(attachment.Name, settings...)
+		} else {
+			m.Attach(attachment.Name, settings...)
+		}
+	}
+	return nil
+}
+
+// thumbnail returns the thumbnail of the message as inline attachment: the base64 encoded thumbnail,
+// or the thumbnail downloaded from the url of the first media which has one. It returns false when
+// the message has no thumbnail, or when it can't be loaded within max bytes.
+func thumbnail(ctx context.Context, message models.Message, max int64) (Attachment, bool) {
+	attachment := Attachment{Name: ThumbnailCID, ContentType: "image/jpeg", Inline: true}
+	if message.Thumbnail != "" {
+		encoded := message.Thumbnail
+		if i := strings.Index(encoded, ";base64,"); strings.HasPrefix(encoded, "data:") && i > 0 {
+			attachment.ContentType = encoded[len("data:"):i]
+			encoded = encoded[i+len(";base64,"):]
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || int64(len(data)) > max {
+			return attachment, false
+		}
+		attachment.Data = data
+		return attachment, true
+	}
+
+	for _, media := range message.Media {
+		if media.AtRuntimeMetadata == nil || media.AtRuntimeMetadata.ThumbnailUrl == "" {
+			continue
+		}
+		attachment.Url = media.AtRuntimeMetadata.ThumbnailUrl
+		data, err := attachment.load(ctx, max)
+		if err != nil {
+			return attachment, false
+		}
+		attachment.Data = data
+		return attachment, true
+	}
+	return attachment, false
+}
+
+// withThumbnail returns the HTML body showing the inlined thumbnail, unless the body already references it
+func withThumbnail(htmlBody string) string {
+	if strings.Contains(htmlBody, "cid:"+ThumbnailCID) {
+		return htmlBody
+	}
+	img := `<p><img src="cid:` + ThumbnailCID + `" alt="thumbnail" style="max-width: 100%"></p>`
+	if i := strings.LastIndex(strings.ToLower(htmlBody), "</body>"); i >= 0 {
+		return htmlBody[:i] + img + htmlBody[i:]
+	}
+	return htmlBody + img
+}
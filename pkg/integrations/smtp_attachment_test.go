@@ -0,0 +1,151 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/uug-ai/models/pkg/models"
+	"gopkg.in/gomail.v2"
+)
+
+// newAttachmentSMTP creates an SMTP integration which writes the sent emails to the buffer
+func newAttachmentSMTP(t *testing.T, builder *SMTPOptionsBuilder, sent *bytes.Buffer) *SMTP {
+	mockClient := &MockMailClient{
+		DialAndSendFunc: func(ctx context.Context, msgs ...*gomail.Message) error {
+			sent.Reset()
+			_, err := msgs[0].WriteTo(sent)
+			return err
+		},
+	}
+	opts := builder.
+		SetServer("smtp.test.com").
+		SetPort(587).
+		SetUsername("user").
+		SetPassword("password").
+		SetFrom("from@test.com").
+		SetTo("to@test.com").
+		Build()
+	smtp, err := NewSMTP(opts, mockClient)
+	if err != nil {
+		t.Fatalf("failed to setup SMTP: %v", err)
+	}
+	return smtp
+}
+
+func TestSMTPAttachments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/report.csv" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("device,events\nfrontdoor,3\n"))
+	}))
+	defer server.Close()
+
+	var sent bytes.Buffer
+	smtp := newAttachmentSMTP(t, NewSMTPOptions().SetAttachmentMaxSize(64), &sent)
+
+	err := smtp.SendEmail(context.Background(), "Daily digest", "", `<p>Snapshot <img src="cid:snapshot.png"></p>`,
+		AttachmentFromBytes("notes.txt", []byte("Motion detected")),
+		AttachmentFromReader("events.json", strings.NewReader(`{"events": 3}`)),
+		AttachmentFromURL("report.csv", server.URL+"/report.csv"),
+		Attachment{Name: "snapshot.png", ContentType: "image/png", Data: []byte("png")}.AsInline(),
+	)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	for _, expected := range []string{
+		`Content-Disposition: attachment; filename="notes.txt"`,
+		`Content-Disposition: attachment; filename="events.json"`,
+		`Content-Disposition: attachment; filename="report.csv"`,
+		`Content-Disposition: inline; filename="snapshot.png"`,
+		"Content-ID: <snapshot.png>",
+		"Content-Type: image/png",
+		base64.StdEncoding.EncodeToString([]byte("device,events\nfrontdoor,3\n")),
+	} {
+		if !strings.Contains(sent.String(), expected) {
+			t.Errorf("expected %q in the email", expected)
+		}
+	}
+
+	tests := map[string]Attachment{
+		"TooLarge":    AttachmentFromReader("large.bin", bytes.NewReader(make([]byte, 65))),
+		"NotFound":    AttachmentFromURL("missing.csv", server.URL+"/missing.csv"),
+		"MissingName": AttachmentFromBytes("", []byte("data")),
+		"NoContent":   {Name: "empty.txt"},
+	}
+	for name, attachment := range tests {
+		if err := smtp.SendEmail(context.Background(), "Daily digest", "body", "", attachment); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	err = smtp.SendEmail(context.Background(), "Daily digest", "body", "", AttachmentFromReader("large.bin", bytes.NewReader(make([]byte, 65))))
+	if !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Errorf("expected ErrAttachmentTooLarge got %v", err)
+	}
+}
+
+func TestSMTPInlineThumbnail(t *testing.T) {
+	image := []byte("jpeg thumbnail")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large.jpg" {
+			w.Write(make([]byte, 2048))
+			return
+		}
+		w.Write(image)
+	}))
+	defer server.Close()
+
+	encoded := base64.StdEncoding.EncodeToString(image)
+	tests := []struct {
+		name    string
+		message models.Message
+		inlined bool
+	}{
+		{"Base64", models.Message{Thumbnail: encoded}, true},
+		{"DataURI", models.Message{Thumbnail: "data:image/jpeg;base64," + encoded}, true},
+		{"ThumbnailUrl", models.Message{Media: []models.Media{{}, {AtRuntimeMetadata: &models.MediaAtRuntimeMetadata{ThumbnailUrl: server.URL + "/thumbnail.jpg"}}}}, true},
+		// Thumbnails which exceed the size cap are left out
+		{"TooLarge", models.Message{Media: []models.Media{{AtRuntimeMetadata: &models.MediaAtRuntimeMetadata{ThumbnailUrl: server.URL + "/large.jpg"}}}}, false},
+		{"InvalidBase64", models.Message{Thumbnail: "not base64!"}, false},
+		{"NoThumbnail", models.Message{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent bytes.Buffer
+			smtp := newAttachmentSMTP(t, NewSMTPOptions().SetInlineThumbnail(true).SetThumbnailMaxSize(1024), &sent)
+
+			tt.message.Title = "Motion detected"
+			tt.message.Body = "Motion detected at the frontdoor"
+			if _, err := smtp.Send(context.Background(), tt.message); err != nil {
+				t.Fatalf("expected no error got %v", err)
+			}
+			email := sent.String()
+			if inlined := strings.Contains(email, "Content-ID: <"+ThumbnailCID+">"); inlined != tt.inlined {
+				t.Errorf("expected inlined thumbnail %v got %v", tt.inlined, inlined)
+			}
+			if tt.inlined && (!strings.Contains(email, "cid:"+ThumbnailCID) || !strings.Contains(email, encoded)) {
+				t.Errorf("expected the HTML body to show the thumbnail, got %s", email)
+			}
+		})
+	}
+}
+
+func TestWithThumbnail(t *testing.T) {
+	tests := map[string]string{
+		"<p>Motion</p>":                    `<p>Motion</p><p><img src="cid:thumbnail.jpg" alt="thumbnail" style="max-width: 100%"></p>`,
+		"<html><body>Motion</body></html>": `<html><body>Motion<p><img src="cid:thumbnail.jpg" alt="thumbnail" style="max-width: 100%"></p></body></html>`,
+		`<img src="cid:thumbnail.jpg">`:    `<img src="cid:thumbnail.jpg">`,
+	}
+	for body, expected := range tests {
+		if html := withThumbnail(body); html != expected {
+			t.Errorf("expected %q got %q", expected, html)
+		}
+	}
+}
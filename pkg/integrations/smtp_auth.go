@@ -0,0 +1,99 @@
+package integrations
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/smtp"
+)
+
+// The authentication mechanisms of the connection to the SMTP server
+const (
+	// SMTPAuthNone doesn't authenticate, e.g. for an internal relay
+	SMTPAuthNone = "none"
+	// SMTPAuthPlain sends the username and password, only over an encrypted connection
+	SMTPAuthPlain = "plain"
+	// SMTPAuthLogin sends the username and password when the server asks for them
+	SMTPAuthLogin = "login"
+	// SMTPAuthCRAMMD5 proves the password with a challenge-response, without sending it
+	SMTPAuthCRAMMD5 = "cram-md5"
+	// SMTPAuthXOAuth2 sends an OAuth2 access token, e.g. for Gmail and Microsoft 365
+	SMTPAuthXOAuth2 = "xoauth2"
+)
+
+// loginAuth is a smtp.Auth that implements the LOGIN authentication mechanism
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// Start implements smtp.Auth interface
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Credentials should only be sent over an encrypted connection,
+	// unless the server explicitly advertises LOGIN
+	if !server.TLS {
+		advertised := false
+		for _, mechanism := range server.Auth {
+			if mechanism == "LOGIN" {
+				advertised = true
+				break
+			}
+		}
+		if !advertised {
+			return "", nil, errors.New("unencrypted connection")
+		}
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next implements smtp.Auth interface
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch {
+	case bytes.Equal(fromServer, []byte("Username:")):
+		return []byte(a.username), nil
+	case bytes.Equal(fromServer, []byte("Password:")):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+	}
+}
+
+// xoauth2Auth is a smtp.Auth that implements the XOAUTH2 authentication mechanism
+type xoauth2Auth struct {
+	username string
+	token    string
+	host     string
+}
+
+// Start implements smtp.Auth interface
+func (a *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// The access token should only be sent over an encrypted connection, or to localhost
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "XOAUTH2", []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+// Next implements smtp.Auth interface
+func (a *xoauth2Auth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		// A rejected token is reported in a challenge, which is answered with an empty response
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+// isLocalhost reports whether the host is the local machine
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
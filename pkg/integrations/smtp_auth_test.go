@@ -0,0 +1,133 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// countingTokenSource returns the token, and records whether it was invalidated
+type countingTokenSource struct {
+	token       string
+	invalidated bool
+}
+
+func (s *countingTokenSource) Token(ctx context.Context) (string, error) {
+	return s.token, nil
+}
+
+func (s *countingTokenSource) Invalidate() {
+	s.invalidated = true
+}
+
+func TestGomailClientAuth(t *testing.T) {
+	tests := []struct {
+		name      string
+		mechanism string
+		auth      string
+		password  string
+		tokens    TokenSource
+		expected  []string
+		expectErr bool
+	}{
+		{name: "NegotiatedCRAMMD5", auth: "AUTH PLAIN LOGIN CRAM-MD5", expected: []string{"CRAM-MD5"}},
+		{name: "NegotiatedLogin", auth: "AUTH LOGIN", expected: []string{"LOGIN"}},
+		{name: "NegotiatedPlain", auth: "AUTH PLAIN LOGIN", expected: []string{"PLAIN"}},
+		{name: "Plain", mechanism: SMTPAuthPlain, auth: "AUTH PLAIN LOGIN CRAM-MD5", expected: []string{"PLAIN"}},
+		{name: "Login", mechanism: SMTPAuthLogin, auth: "AUTH PLAIN LOGIN CRAM-MD5", expected: []string{"LOGIN"}},
+		{name: "CRAMMD5", mechanism: SMTPAuthCRAMMD5, auth: "AUTH PLAIN CRAM-MD5", expected: []string{"CRAM-MD5"}},
+		{name: "XOAuth2", mechanism: SMTPAuthXOAuth2, auth: "AUTH XOAUTH2", tokens: &countingTokenSource{token: "ya29.token"}, expected: []string{"XOAUTH2"}},
+		{name: "None", mechanism: SMTPAuthNone, auth: "AUTH PLAIN", expected: []string{}},
+		{name: "WrongPassword", mechanism: SMTPAuthCRAMMD5, auth: "AUTH CRAM-MD5", password: "wrong", expectErr: true},
+		{name: "WrongToken", mechanism: SMTPAuthXOAuth2, auth: "AUTH XOAUTH2", tokens: &countingTokenSource{token: "expired"}, expectErr: true},
+		{name: "MissingTokenSource", mechanism: SMTPAuthXOAuth2, auth: "AUTH XOAUTH2", expectErr: true},
+		{name: "TokenSourceError", mechanism: SMTPAuthXOAuth2, auth: "AUTH XOAUTH2", expectErr: true,
+			tokens: TokenSourceFunc(func(ctx context.Context) (string, error) { return "", errors.New("refresh failed") })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestSMTPServer(t, tt.auth)
+			server.username, server.password, server.token = "user@test.com", "password", "ya29.token"
+
+			password := tt.password
+			if password == "" {
+				password = "password"
+			}
+			client := NewGomailClient("127.0.0.1", server.port(), "user@test.com", password, WithAuth(tt.mechanism, tt.tokens))
+			err := client.DialAndSend(context.Background(), newPoolMessage("to@test.com"))
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				if tokens, ok := tt.tokens.(*countingTokenSource); ok && !tokens.invalidated {
+					t.Errorf("expected the rejected token to be invalidated")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error got %v", err)
+			}
+			if authenticated := server.authenticated(); !reflect.DeepEqual(authenticated, tt.expected) {
+				t.Errorf("expected mechanisms %v got %v", tt.expected, authenticated)
+			}
+		})
+	}
+}
+
+func TestSMTPAuthOptions(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "ya29.token", "expires_in": 3599, "token_type": "Bearer"}`))
+	}))
+	defer tokenServer.Close()
+	server := newTestSMTPServer(t, "AUTH PLAIN XOAUTH2")
+	server.username, server.token = "alerts@example.com", "ya29.token"
+
+	opts := NewSMTPOptions().
+		SetServer("127.0.0.1").
+		SetPort(server.port()).
+		SetUsername("alerts@example.com").
+		SetAuth(SMTPAuthXOAuth2).
+		SetOAuth2(tokenServer.URL, "client", "secret", "refresh").
+		SetOAuth2Scopes("https://mail.google.com/").
+		SetFrom("alerts@example.com").
+		SetTo("to@test.com").
+		Build()
+	smtp, err := NewSMTP(opts)
+	if err != nil {
+		t.Fatalf("failed to setup SMTP: %v", err)
+	}
+	if err := smtp.SendEmail(context.Background(), "Motion detected", "Motion detected at the frontdoor", ""); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if authenticated := server.authenticated(); !reflect.DeepEqual(authenticated, []string{"XOAUTH2"}) {
+		t.Errorf("expected XOAUTH2 authentication got %v", authenticated)
+	}
+
+	tests := map[string]struct {
+		builder   *SMTPOptionsBuilder
+		expectErr bool
+	}{
+		"NoneWithoutCredentials":    {NewSMTPOptions().SetAuth(SMTPAuthNone), false},
+		"XOAuth2WithTokenSource":    {NewSMTPOptions().SetAuth(SMTPAuthXOAuth2).SetUsername("user").SetTokenSource(&countingTokenSource{}), false},
+		"XOAuth2WithoutTokens":      {NewSMTPOptions().SetAuth(SMTPAuthXOAuth2).SetUsername("user"), true},
+		"XOAuth2WithoutUsername":    {NewSMTPOptions().SetAuth(SMTPAuthXOAuth2).SetTokenSource(&countingTokenSource{}), true},
+		"PlainWithoutPassword":      {NewSMTPOptions().SetAuth(SMTPAuthPlain).SetUsername("user"), true},
+		"NegotiatedWithoutPassword": {NewSMTPOptions().SetUsername("user"), true},
+		"UnknownMechanism":          {NewSMTPOptions().SetAuth("ntlm").SetUsername("user").SetPassword("password"), true},
+		"InvalidTokenURL":           {NewSMTPOptions().SetAuth(SMTPAuthXOAuth2).SetUsername("user").SetOAuth2("not a url", "client", "", ""), true},
+	}
+	for name, tt := range tests {
+		opts := tt.builder.SetServer("127.0.0.1").SetPort(25).SetFrom("alerts@example.com").SetTo("to@test.com").Build()
+		_, err := NewSMTP(opts)
+		if tt.expectErr && err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if !tt.expectErr && err != nil {
+			t.Errorf("%s: expected no error got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package integrations
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The DKIM canonicalization algorithms of the header and the body
+const (
+	DKIMCanonicalizationSimple  = "simple"
+	DKIMCanonicalizationRelaxed = "relaxed"
+)
+
+// DefaultDKIMHeaders are the headers which are signed when present in the email
+var DefaultDKIMHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// DKIMOptions holds the DKIM signing configuration of the emails. The public key is published
+// in DNS as TXT record of <selector>._domainkey.<domain>.
+type DKIMOptions struct {
+	// Domain is the signing domain, usually the domain of the sender
+	Domain   string `json:"domain,omitempty" validate:"required_with=PrivateKey,omitempty,fqdn"`
+	Selector string `json:"selector,omitempty" validate:"required_with=PrivateKey"`
+	// PrivateKey is the PEM encoded RSA (PKCS #1 or PKCS #8) or Ed25519 (PKCS #8) private key
+	PrivateKey string `json:"private_key,omitempty" validate:"required_with=Domain Selector"`
+	// Headers are the headers which are signed when present, defaults to DefaultDKIMHeaders.
+	// The From header is always signed.
+	Headers []string `json:"headers,omitempty"`
+	// Canonicalization is the header and body canonicalization, e.g. "relaxed/simple",
+	// defaults to "relaxed/relaxed"
+	Canonicalization string `json:"canonicalization,omitempty" validate:"omitempty,oneof=simple relaxed simple/simple simple/relaxed relaxed/simple relaxed/relaxed"`
+}
+
+// DKIMSigner signs emails with a DKIM-Signature header (RFC 6376, RFC 8463 for Ed25519 keys)
+type DKIMSigner struct {
+	domain          string
+	selector        string
+	signer          crypto.Signer
+	algorithm       string
+	headers         []string
+	headerCanonical string
+	bodyCanonical   string
+	now             func() time.Time
+}
+
+// NewDKIMSigner creates a signer from the options
+func NewDKIMSigner(opts DKIMOptions) (*DKIMSigner, error) {
+	if opts.Domain == "" || opts.Selector == "" {
+		return nil, errors.New("dkim domain and selector are required")
+	}
+	s := &DKIMSigner{
+		domain:          opts.Domain,
+		selector:        opts.Selector,
+		headers:         opts.Headers,
+		headerCanonical: DKIMCanonicalizationRelaxed,
+		bodyCanonical:   DKIMCanonicalizationRelaxed,
+		now:             time.Now,
+	}
+
+	block, _ := pem.Decode([]byte(opts.PrivateKey))
+	if block == nil {
+		return nil, errors.New("dkim private key is not PEM encoded")
+	}
+	var key any
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim private key: %w", err)
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		s.signer, s.algorithm = key, "rsa-sha256"
+	case ed25519.PrivateKey:
+		s.signer, s.algorithm = key, "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("dkim private key: unsupported key type %T", key)
+	}
+
+	if len(s.headers) == 0 {
+		s.headers = DefaultDKIMHeaders
+	}
+	if !slices.ContainsFunc(s.headers, func(name string) bool { return strings.EqualFold(name, "From") }) {
+		s.headers = append([]string{"From"}, s.headers...)
+	}
+
+	if opts.Canonicalization != "" {
+		header, body, _ := strings.Cut(opts.Canonicalization, "/")
+		s.headerCanonical, s.bodyCanonical = header, DKIMCanonicalizationSimple
+		if body != "" {
+			s.bodyCanonical = body
+		}
+		for _, c := range []string{s.headerCanonical, s.bodyCanonical} {
+			if c != DKIMCanonicalizationSimple && c != DKIMCanonicalizationRelaxed {
+				return nil, errors.New("unsupported dkim canonicalization " + opts.Canonicalization)
+			}
+		}
+	}
+	return s, nil
+}
+
+// Sign returns the email with its line endings normalized to CRLF, and prefixed with the DKIM-Signature header
+func (s *DKIMSigner) Sign(message []byte) ([]byte, error) {
+	message = normalizeCRLF(message)
+	header, body, ok := bytes.Cut(message, []byte("\r\n\r\n"))
+	if !ok {
+		header, body = bytes.TrimSuffix(message, []byte("\r\n")), nil
+	}
+	fields := splitHeaderFields(string(header) + "\r\n")
+
+	bodyHash := sha256.Sum256(canonicalBody(body, s.bodyCanonical))
+
+	// Every signed header is taken from the bottom, a header which occurs more than once is
+	// signed once for every time it's listed
+	var signed []string
+	var names []string
+	used := map[int]bool{}
+	for _, name := range s.headers {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(headerFieldName(fields[i]), name) {
+				used[i] = true
+				signed = append(signed, canonicalHeader(fields[i], s.headerCanonical))
+				names = append(names, strings.ToLower(name))
+				break
+			}
+		}
+	}
+
+	tags := []string{
+		"v=1",
+		"a=" + s.algorithm,
+		"c=" + s.headerCanonical + "/" + s.bodyCanonical,
+		"d=" + s.domain,
+		"s=" + s.selector,
+		"t=" + strconv.FormatInt(s.now().Unix(), 10),
+		"h=" + strings.Join(names, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}
+	signature := foldDKIMTags("DKIM-Signature: ", tags)
+
+	// The signature header itself is hashed with an empty signature and without the final CRLF
+	hash := sha256.New()
+	for _, field := range signed {
+		hash.Write([]byte(field))
+	}
+	hash.Write([]byte(strings.TrimSuffix(canonicalHeader(signature+"\r\n", s.headerCanonical), "\r\n")))
+	digest := hash.Sum(nil)
+
+	var sig []byte
+	var err error
+	if s.algorithm == "ed25519-sha256" {
+		sig, err = s.signer.Sign(rand.Reader, digest, crypto.Hash(0))
+	} else {
+		sig, err = s.signer.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: %w", err)
+	}
+
+	var signedMessage bytes.Buffer
+	signedMessage.WriteString(signature)
+	encoded := base64.StdEncoding.EncodeToString(sig)
+	for len(encoded) > 0 {
+		n := min(len(encoded), 72)
+		signedMessage.WriteString("\r\n " + encoded[:n])
+		encoded = encoded[n:]
+	}
+	signedMessage.WriteString("\r\n")
+	signedMessage.Write(message)
+	return signedMessage.Bytes(), nil
+}
+
+// foldDKIMTags joins the tags of the header field, folding lines longer than 78 characters
+func foldDKIMTags(name string, tags []string) string {
+	var b strings.Builder
+	b.WriteString(name)
+	line := len(name)
+	for i, tag := range tags {
+		if i < len(tags)-1 {
+			tag += ";"
+		}
+		if i > 0 {
+			if line+1+len(tag) > 78 {
+				b.WriteString("\r\n")
+				line = 0
+			}
+			b.WriteString(" ")
+			line++
+		}
+		b.WriteString(tag)
+		line += len(tag)
+	}
+	return b.String()
+}
+
+// normalizeCRLF converts the line endings of the email to CRLF, as it's sent over SMTP
+func normalizeCRLF(message []byte) []byte {
+	message = bytes.ReplaceAll(message, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(message, []byte("\n"), []byte("\r\n"))
+}
+
+// splitHeaderFields splits the header of an email in its fields, including their continuation lines and final CRLF
+func splitHeaderFields(header string) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+// headerFieldName returns the name of the header field
+func headerFieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.TrimRight(name, " \t")
+}
+
+// canonicalHeader returns the header field in the canonical form (RFC 6376 section 3.4.1 and 3.4.2)
+func canonicalHeader(field string, canonicalization string) string {
+	if canonicalization == DKIMCanonicalizationSimple {
+		return field
+	}
+	name, value, _ := strings.Cut(field, ":")
+	value = collapseWSP(strings.ReplaceAll(value, "\r\n", ""))
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + strings.Trim(value, " ") + "\r\n"
+}
+
+// collapseWSP reduces every sequence of spaces and tabs to a single space
+func collapseWSP(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// canonicalBody returns the body in the canonical form (RFC 6376 section 3.4.3 and 3.4.4)
+func canonicalBody(body []byte, canonicalization string) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	if canonicalization == DKIMCanonicalizationRelaxed {
+		for i, line := range lines {
+			lines[i] = collapseWSP(strings.TrimRight(line, " \t"))
+		}
+	}
+	// Empty lines at the end of the body are ignored
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		if canonicalization == DKIMCanonicalizationSimple {
+			return []byte("\r\n")
+		}
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
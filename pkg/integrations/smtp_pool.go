@@ -0,0 +1,213 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// DefaultPoolIdleTimeout is the time an unused connection of an SMTPPool is kept open
+const DefaultPoolIdleTimeout = time.Minute
+
+// ErrPoolClosed is returned when an email is sent through a closed SMTPPool
+var ErrPoolClosed = errors.New("smtp pool is closed")
+
+// SMTPPool is a MailClient which keeps the authenticated connections to the SMTP server open, and
+// reuses them for the next emails. The connections are dialed with the wrapped MailClient, at most
+// size unused connections are kept open for the idle timeout. When a reused connection turns out
+// to be closed by the server, the email is sent again on a new connection.
+type SMTPPool struct {
+	client      MailClient
+	size        int
+	idleTimeout time.Duration
+
+	mu     sync.Mutex
+	idle   []idleConn
+	closed bool
+}
+
+// idleConn is an unused connection of the pool
+type idleConn struct {
+	sender gomail.SendCloser
+	since  time.Time
+}
+
+// resetter is implemented by senders which can abort the current mail transaction
+type resetter interface {
+	Reset() error
+}
+
+// NewSMTPPool creates a pool which keeps at most size connections of the client open
+func NewSMTPPool(client MailClient, size int, idleTimeout time.Duration) *SMTPPool {
+	return &SMTPPool{
+		client:      client,
+		size:        max(size, 1),
+		idleTimeout: idleTimeout,
+	}
+}
+
+// DialAndSend implements MailClient interface, the emails are sent on a pooled connection
+func (p *SMTPPool) DialAndSend(ctx context.Context, m ...*gomail.Message) error {
+	for i, msg := range m {
+		if err := p.send(ctx, msg); err != nil {
+			return fmt.Errorf("could not send email %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Dial implements MailClient interface. It returns an unused connection of the pool or a new
+// connection, which is returned to the pool when it is closed.
+func (p *SMTPPool) Dial(ctx context.Context) (gomail.SendCloser, error) {
+	sender, _, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledSender{pool: p, sender: sender}, nil
+}
+
+// Close closes the unused connections, connections in use are closed when they are returned
+func (p *SMTPPool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	var errs []error
+	for _, conn := range idle {
+		if err := conn.sender.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send sends the email on a pooled connection, a reused connection which fails
+// is replaced by a new connection
+func (p *SMTPPool) send(ctx context.Context, m *gomail.Message) error {
+	sender, reused, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	err = sendMessage(sender, m)
+	var beforeData *beforeDataError
+	if err != nil && reused && !isSMTPReply(err) && errors.As(err, &beforeData) && ctx.Err() == nil {
+		// The server closed the connection while it was unused. The email is only sent again when
+		// the connection failed before DATA, afterwards the server may have accepted it already.
+		sender.Close()
+		if sender, err = p.client.Dial(ctx); err != nil {
+			return err
+		}
+		err = sendMessage(sender, m)
+	}
+	p.put(sender, err)
+	return err
+}
+
+// get returns an unused connection of the pool, or dials a new connection. It reports
+// whether the connection was reused.
+func (p *SMTPPool) get(ctx context.Context) (gomail.SendCloser, bool, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, false, ErrPoolClosed
+		}
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			sender, err := p.client.Dial(ctx)
+			return sender, false, err
+		}
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		if time.Since(conn.since) > p.idleTimeout {
+			conn.sender.Close()
+			continue
+		}
+		if sender, ok := conn.sender.(*smtpSender); ok {
+			sender.bind(ctx)
+		}
+		return conn.sender, true, nil
+	}
+}
+
+// put returns the connection to the pool after sending an email. A connection is only kept when
+// it's still usable: the email was sent, or the server rejected it and the transaction was reset.
+func (p *SMTPPool) put(sender gomail.SendCloser, err error) {
+	if err != nil {
+		r, ok := sender.(resetter)
+		if !ok || !isSMTPReply(err) || r.Reset() != nil {
+			sender.Close()
+			return
+		}
+	}
+	// The connection is no longer aborted when the context of the email is done
+	if s, ok := sender.(*smtpSender); ok {
+		s.bind(nil)
+	}
+
+	p.mu.Lock()
+	if p.closed || len(p.idle) >= p.size {
+		p.mu.Unlock()
+		sender.Close()
+		return
+	}
+	p.idle = append(p.idle, idleConn{sender: sender, since: time.Now()})
+	p.mu.Unlock()
+}
+
+// sendMessage sends the email with the sender, returning the error of the sender as is,
+// gomail.Send flattens it to a string
+func sendMessage(sender gomail.Sender, m *gomail.Message) error {
+	var cause error
+	err := gomail.Send(gomail.SendFunc(func(from string, to []string, msg io.WriterTo) error {
+		cause = sender.Send(from, to, msg)
+		return cause
+	}), m)
+	if cause != nil {
+		return cause
+	}
+	return err
+}
+
+// isSMTPReply reports whether the error is a reply of the SMTP server, which leaves the connection usable
+func isSMTPReply(err error) bool {
+	var reply *textproto.Error
+	return errors.As(err, &reply)
+}
+
+// pooledSender is a connection of the pool, which is returned to the pool when it is closed
+type pooledSender struct {
+	pool   *SMTPPool
+	sender gomail.SendCloser
+	// err is the error which decides whether the connection is still usable
+	err error
+}
+
+// Send implements gomail.Sender interface
+func (s *pooledSender) Send(from string, to []string, msg io.WriterTo) error {
+	err := s.sender.Send(from, to, msg)
+	if err != nil && (s.err == nil || isSMTPReply(s.err)) {
+		s.err = err
+	}
+	return err
+}
+
+// Close implements gomail.SendCloser interface, it returns the connection to the pool
+func (s *pooledSender) Close() error {
+	if s.sender == nil {
+		return nil
+	}
+	s.pool.put(s.sender, s.err)
+	s.sender = nil
+	return nil
+}
@@ -0,0 +1,201 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+	"gopkg.in/gomail.v2"
+)
+
+// newPoolMessage creates an email to the recipient
+func newPoolMessage(to string) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetHeader("From", "from@test.com")
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "Daily digest")
+	m.SetBody("text/plain", "3 events at the frontdoor")
+	return m
+}
+
+func TestSMTPPool(t *testing.T) {
+	server := newTestSMTPServer(t)
+	server.reject = "unknown@test.com"
+	pool := NewSMTPPool(NewGomailClient("127.0.0.1", server.port(), "", ""), 2, time.Minute)
+
+	// The connection is reused, also when the context of the previous email is done
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		err := pool.DialAndSend(ctx, newPoolMessage("to@test.com"))
+		cancel()
+		if err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+	}
+	if connections := server.connections(); connections != 1 {
+		t.Errorf("expected 1 connection got %d", connections)
+	}
+
+	// A rejected email leaves the connection usable
+	err := pool.DialAndSend(context.Background(), newPoolMessage("unknown@test.com"))
+	var reply *textproto.Error
+	if !errors.As(err, &reply) || reply.Code != 550 {
+		t.Errorf("expected the reply of the server got %v", err)
+	}
+	if err := pool.DialAndSend(context.Background(), newPoolMessage("to@test.com")); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if connections := server.connections(); connections != 1 {
+		t.Errorf("expected 1 connection got %d", connections)
+	}
+
+	// A connection closed by the server is replaced
+	server.disconnect()
+	if err := pool.DialAndSend(context.Background(), newPoolMessage("to@test.com")); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if connections := server.connections(); connections != 2 {
+		t.Errorf("expected 2 connections got %d", connections)
+	}
+	if received := server.received(); len(received) != 5 {
+		t.Errorf("expected 5 emails got %d", len(received))
+	}
+
+	// Connections dialed through the pool are returned to it when closed
+	sender, err := pool.Dial(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if err := gomail.Send(sender, newPoolMessage("to@test.com")); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	sender.Close()
+	if connections := server.connections(); connections != 2 {
+		t.Errorf("expected 2 connections got %d", connections)
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+	if err := pool.DialAndSend(context.Background(), newPoolMessage("to@test.com")); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("expected ErrPoolClosed got %v", err)
+	}
+}
+
+func TestSMTPPoolNoResendAfterData(t *testing.T) {
+	server := newTestSMTPServer(t)
+	pool := NewSMTPPool(NewGomailClient("127.0.0.1", server.port(), "", ""), 1, time.Minute)
+	defer pool.Close()
+
+	if err := pool.DialAndSend(context.Background(), newPoolMessage("to@test.com")); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	// The connection is lost after the email is transferred, the server may have accepted it,
+	// so it isn't sent again on a new connection
+	server.mu.Lock()
+	server.dropAfterData = true
+	server.mu.Unlock()
+	if err := pool.DialAndSend(context.Background(), newPoolMessage("to@test.com")); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if received := server.received(); len(received) != 2 {
+		t.Errorf("expected 2 emails got %d", len(received))
+	}
+	if connections := server.connections(); connections != 1 {
+		t.Errorf("expected 1 connection got %d", connections)
+	}
+
+	// The broken connection is replaced by the next email
+	server.mu.Lock()
+	server.dropAfterData = false
+	server.mu.Unlock()
+	if err := pool.DialAndSend(context.Background(), newPoolMessage("to@test.com")); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if connections := server.connections(); connections != 2 {
+		t.Errorf("expected 2 connections got %d", connections)
+	}
+}
+
+func TestSMTPPoolIdleTimeout(t *testing.T) {
+	server := newTestSMTPServer(t)
+	pool := NewSMTPPool(NewGomailClient("127.0.0.1", server.port(), "", ""), 1, time.Millisecond)
+	defer pool.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := pool.DialAndSend(context.Background(), newPoolMessage("to@test.com")); err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if connections := server.connections(); connections != 2 {
+		t.Errorf("expected the idle connection to be replaced, got %d connections", connections)
+	}
+}
+
+func TestSMTPSendBatch(t *testing.T) {
+	server := newTestSMTPServer(t)
+	server.reject = "unknown@test.com"
+	opts := NewSMTPOptions().
+		SetServer("127.0.0.1").
+		SetPort(server.port()).
+		SetUsername("user").
+		SetPassword("password").
+		SetFrom("from@test.com").
+		SetTo("to@test.com").
+		SetPoolSize(2).
+		Build()
+	smtp, err := NewSMTP(opts)
+	if err != nil {
+		t.Fatalf("failed to setup SMTP: %v", err)
+	}
+	defer smtp.Close()
+
+	messages := make([]models.Message, 10)
+	for i := range messages {
+		messages[i] = models.Message{
+			Title: "Daily digest",
+			Body:  "3 events at the frontdoor",
+			Data:  map[string]string{EmailToField: fmt.Sprintf("user%d@test.com", i)},
+		}
+	}
+	messages[3].Data = map[string]string{EmailToField: "unknown@test.com"}
+
+	results := smtp.SendBatch(context.Background(), messages)
+	if len(results) != len(messages) {
+		t.Fatalf("expected %d results got %d", len(messages), len(results))
+	}
+	for i, result := range results {
+		if i == 3 {
+			if result.Error == nil {
+				t.Errorf("expected the rejected email to fail")
+			}
+			continue
+		}
+		if result.Error != nil {
+			t.Errorf("email %d: expected no error got %v", i, result.Error)
+		}
+		if expected := fmt.Sprintf("user%d@test.com", i); len(result.Recipients) != 1 || result.Recipients[0] != expected {
+			t.Errorf("email %d: expected recipient %s got %v", i, expected, result.Recipients)
+		}
+	}
+	if received := server.received(); len(received) != 9 {
+		t.Errorf("expected 9 emails got %d", len(received))
+	}
+	if connections := server.connections(); connections > 2 {
+		t.Errorf("expected at most 2 connections got %d", connections)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range smtp.SendBatch(ctx, messages[:2]) {
+		if result.Error == nil {
+			t.Errorf("expected an error for a cancelled batch")
+		}
+	}
+}
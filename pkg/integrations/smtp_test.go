@@ -1,34 +1,49 @@
 package integrations
 
 import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"net"
 	"os"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/uug-ai/integrations/pkg/templates"
+	"github.com/uug-ai/models/pkg/models"
 	"gopkg.in/gomail.v2"
 )
 
 // MockMailClient is a mock implementation of MailClient for testing
 type MockMailClient struct {
-	DialAndSendFunc func(m ...*gomail.Message) error
-	DialFunc        func() (gomail.SendCloser, error)
+	DialAndSendFunc func(ctx context.Context, m ...*gomail.Message) error
+	DialFunc        func(ctx context.Context) (gomail.SendCloser, error)
 	DialCalled      bool
 	SendCalled      bool
 }
 
-func (m *MockMailClient) DialAndSend(msgs ...*gomail.Message) error {
+func (m *MockMailClient) DialAndSend(ctx context.Context, msgs ...*gomail.Message) error {
 	m.SendCalled = true
 	if m.DialAndSendFunc != nil {
-		return m.DialAndSendFunc(msgs...)
+		return m.DialAndSendFunc(ctx, msgs...)
 	}
 	return nil
 }
 
-func (m *MockMailClient) Dial() (gomail.SendCloser, error) {
+func (m *MockMailClient) Dial(ctx context.Context) (gomail.SendCloser, error) {
 	m.DialCalled = true
 	if m.DialFunc != nil {
-		return m.DialFunc()
+		return m.DialFunc(ctx)
 	}
 	return nil, nil
 }
@@ -99,6 +114,36 @@ func TestSMTPValidation(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "EmailToList",
+			buildOpts: func() *SMTPOptions {
+				return NewSMTPOptions().
+					SetServer("127.0.0.1").
+					SetPort(2525).
+					SetUsername("user").
+					SetPassword("password").
+					SetFrom("alerts@test.com").
+					AddTo("security@test.com", "guard@test.com").
+					Build()
+			},
+			expectError: false,
+		},
+		{
+			name: "WrongEmailCc",
+			buildOpts: func() *SMTPOptions {
+				port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+				return NewSMTPOptions().
+					SetServer(os.Getenv("SMTP_SERVER")).
+					SetPort(port).
+					SetUsername(os.Getenv("SMTP_USERNAME")).
+					SetPassword(os.Getenv("SMTP_PASSWORD")).
+					SetFrom(os.Getenv("EMAIL_FROM")).
+					SetTo(os.Getenv("EMAIL_TO")).
+					AddCc("invalid-email-address").
+					Build()
+			},
+			expectError: true,
+		},
 		{
 			name: "WrongEmailFrom",
 			buildOpts: func() *SMTPOptions {
@@ -192,10 +237,8 @@ func TestSMTPSendWithMock(t *testing.T) {
 		title       string
 		body        string
 		textBody    string
-		dialError   error
 		sendError   error
 		expectError bool
-		expectDial  bool
 		expectSend  bool
 	}{
 		{
@@ -204,36 +247,31 @@ func TestSMTPSendWithMock(t *testing.T) {
 			body:        "Body",
 			textBody:    "<p>Body</p>",
 			expectError: true,
-			expectDial:  false,
 			expectSend:  false,
 		},
 		{
-			name:        "EmptyBody",
+			name:        "EmptyBodies",
 			title:       "Title",
 			body:        "",
-			textBody:    "<p>Body</p>",
+			textBody:    "",
 			expectError: true,
-			expectDial:  false,
 			expectSend:  false,
 		},
 		{
-			name:        "EmptyTextBody",
+			name:        "EmptyBody",
 			title:       "Title",
-			body:        "Body",
-			textBody:    "",
-			expectError: true,
-			expectDial:  false,
-			expectSend:  false,
+			body:        "",
+			textBody:    "<p>Body</p>",
+			expectError: false,
+			expectSend:  true,
 		},
 		{
-			name:        "DialError",
+			name:        "EmptyTextBody",
 			title:       "Title",
 			body:        "Body",
-			textBody:    "<p>Body</p>",
-			dialError:   errors.New("dial failed"),
-			expectError: true,
-			expectDial:  true,
-			expectSend:  false,
+			textBody:    "",
+			expectError: false,
+			expectSend:  true,
 		},
 		{
 			name:        "SendError",
@@ -242,7 +280,6 @@ func TestSMTPSendWithMock(t *testing.T) {
 			textBody:    "<p>Body</p>",
 			sendError:   errors.New("send failed"),
 			expectError: true,
-			expectDial:  true,
 			expectSend:  true,
 		},
 		{
@@ -251,7 +288,6 @@ func TestSMTPSendWithMock(t *testing.T) {
 			body:        "Body",
 			textBody:    "<p>Body</p>",
 			expectError: false,
-			expectDial:  true,
 			expectSend:  true,
 		},
 	}
@@ -261,10 +297,7 @@ func TestSMTPSendWithMock(t *testing.T) {
 
 			// Create mock client
 			mockClient := &MockMailClient{
-				DialFunc: func() (gomail.SendCloser, error) {
-					return nil, tt.dialError
-				},
-				DialAndSendFunc: func(m ...*gomail.Message) error {
+				DialAndSendFunc: func(ctx context.Context, m ...*gomail.Message) error {
 					return tt.sendError
 				},
 			}
@@ -285,7 +318,7 @@ func TestSMTPSendWithMock(t *testing.T) {
 			}
 
 			// Test Send
-			err = smtp.Send(tt.title, tt.body, tt.textBody)
+			err = smtp.SendEmail(context.Background(), tt.title, tt.body, tt.textBody)
 
 			if tt.expectError && err == nil {
 				t.Errorf("expected error got nil")
@@ -294,8 +327,9 @@ func TestSMTPSendWithMock(t *testing.T) {
 				t.Errorf("expected no error got %v", err)
 			}
 
-			if mockClient.DialCalled != tt.expectDial {
-				t.Errorf("expected Dial called=%v, got=%v", tt.expectDial, mockClient.DialCalled)
+			// The email is sent on a single connection, without dialing to check the server first
+			if mockClient.DialCalled {
+				t.Errorf("expected Dial not to be called")
 			}
 
 			if mockClient.SendCalled != tt.expectSend {
@@ -329,23 +363,24 @@ func TestSMTPFieldEmpty(t *testing.T) {
 		expectError bool
 	}{
 		{title: "", body: "Body", textBody: "<p>Body</p>", expectError: true},
-		{title: "Title", body: "", textBody: "<p>Body</p>", expectError: true},
-		{title: "Title", body: "Body", textBody: "", expectError: true},
+		{title: "Title", body: "", textBody: "", expectError: true},
+		{title: "Title", body: "", textBody: "<p>Body</p>", expectError: false},
+		{title: "Title", body: "Body", textBody: "", expectError: false},
 		{title: "Title", body: "Body", textBody: "<p>Body</p>", expectError: false},
 	}
 
 	for _, tt := range tests {
 		mockClient.DialCalled = false
 		mockClient.SendCalled = false
-		err := smtpClient.Send(tt.title, tt.body, tt.textBody)
+		err := smtpClient.SendEmail(context.Background(), tt.title, tt.body, tt.textBody)
 		if tt.expectError && err == nil {
 			t.Errorf("expected error got nil for title: '%s', body: '%s', textBody: '%s'", tt.title, tt.body, tt.textBody)
 		}
 		if !tt.expectError && err != nil {
 			t.Errorf("expected no error got %v for title: '%s', body: '%s', textBody: '%s'", err, tt.title, tt.body, tt.textBody)
 		}
-		if !tt.expectError && !mockClient.DialCalled {
-			t.Errorf("expected Dial to be called but it wasn't")
+		if !tt.expectError && !mockClient.SendCalled {
+			t.Errorf("expected DialAndSend to be called but it wasn't")
 		}
 	}
 }
@@ -437,7 +472,7 @@ func TestIntegrationSMTPServer(t *testing.T) {
 
 			// For runtime errors (like wrong server), try to send
 			if smtpClient != nil {
-				err = smtpClient.Send("Test Subject", "This is the body of the email.", "<p>This is the body of the email.</p>")
+				err = smtpClient.SendEmail(context.Background(), "Test Subject", "This is the body of the email.", "<p>This is the body of the email.</p>")
 				if tt.expectError && err == nil {
 					t.Errorf("expected error got nil")
 				}
@@ -448,3 +483,654 @@ func TestIntegrationSMTPServer(t *testing.T) {
 		})
 	}
 }
+
+func TestSMTPNotifier(t *testing.T) {
+	var sent *gomail.Message
+	mockClient := &MockMailClient{
+		DialAndSendFunc: func(ctx context.Context, m ...*gomail.Message) error {
+			sent = m[0]
+			return nil
+		},
+	}
+
+	opts := NewSMTPOptions().
+		SetServer("smtp.test.com").
+		SetPort(587).
+		SetUsername("user").
+		SetPassword("pass").
+		SetFrom("from@test.com").
+		SetTo("to@test.com").
+		Build()
+
+	var notifier Notifier
+	notifier, err := NewSMTP(opts, mockClient)
+	if err != nil {
+		t.Fatalf("failed to create SMTP client: %v", err)
+	}
+
+	result, err := notifier.Send(context.Background(), models.Message{
+		Title: "Motion detected",
+		Body:  "Motion detected at <frontdoor>",
+	})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if result.Integration != IntegrationSMTP {
+		t.Errorf("expected integration %q, got %q", IntegrationSMTP, result.Integration)
+	}
+	if len(result.Recipients) != 1 || result.Recipients[0] != "to@test.com" {
+		t.Errorf("expected recipients [to@test.com], got %v", result.Recipients)
+	}
+	if sent == nil {
+		t.Fatalf("expected message to be sent")
+	}
+	if subject := sent.GetHeader("Subject"); len(subject) != 1 || subject[0] != "Motion detected" {
+		t.Errorf("expected subject 'Motion detected', got %v", subject)
+	}
+
+	// An empty message should not reach the mail server
+	mockClient.SendCalled = false
+	result, err = notifier.Send(context.Background(), models.Message{})
+	if err == nil {
+		t.Errorf("expected error got nil")
+	}
+	if result.Delivered() {
+		t.Errorf("expected message not to be delivered")
+	}
+	if mockClient.SendCalled {
+		t.Errorf("expected DialAndSend not to be called")
+	}
+}
+
+func TestSMTPTemplates(t *testing.T) {
+	var sent *gomail.Message
+	mockClient := &MockMailClient{
+		DialAndSendFunc: func(ctx context.Context, m ...*gomail.Message) error {
+			sent = m[0]
+			return nil
+		},
+	}
+
+	opts := NewSMTPOptions().
+		SetServer("smtp.test.com").
+		SetPort(587).
+		SetUsername("user").
+		SetPassword("pass").
+		SetFrom("from@test.com").
+		SetTo("to@test.com").
+		SetTitleTemplate("{{devicename}} detected {{classifications}}").
+		SetBodyTemplate("Hi {{user}}, watch {{link}}").
+		SetHTMLTemplate(`<p>Hi {{user}}</p><a href="{{link}}">{{devicename}}</a>`).
+		Build()
+
+	smtp, err := NewSMTP(opts, mockClient)
+	if err != nil {
+		t.Fatalf("failed to create SMTP client: %v", err)
+	}
+
+	_, err = smtp.Send(context.Background(), models.Message{
+		User:            "cedric",
+		DeviceName:      "<frontdoor>",
+		Classifications: []string{"person"},
+		Data:            map[string]string{"link": "https://example.com/recording"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if subject := sent.GetHeader("Subject"); len(subject) != 1 || subject[0] != "<frontdoor> detected person" {
+		t.Errorf("expected rendered subject, got %v", subject)
+	}
+
+	var out strings.Builder
+	sent.WriteTo(&out)
+	email := out.String()
+	if !strings.Contains(email, "Hi cedric, watch https://example.com/recording") {
+		t.Errorf("expected rendered text body, got %s", email)
+	}
+	if !strings.Contains(email, "&lt;frontdoor&gt;") {
+		t.Errorf("expected escaped HTML body, got %s", email)
+	}
+
+	opts.HTMLTemplate = "{{if}}"
+	if _, err := NewSMTP(opts, mockClient); err == nil {
+		t.Errorf("expected an error for an invalid template")
+	}
+}
+
+func TestSMTPNamedTemplate(t *testing.T) {
+	var sent *gomail.Message
+	mockClient := &MockMailClient{
+		DialAndSendFunc: func(ctx context.Context, m ...*gomail.Message) error {
+			sent = m[0]
+			return nil
+		},
+	}
+
+	store := templates.NewMemoryStore(nil)
+	store.Add(templates.Definition{Id: "motion", Variants: map[string]string{
+		templates.VariantSubject: "{{devicename}} detected motion",
+		templates.VariantHTML:    "<p>Hi {{user}}, {{devicename}} detected motion</p>",
+		templates.VariantText:    "Hi {{user}}, {{devicename}} detected motion",
+	}})
+	store.Add(templates.Definition{Id: "html-only", Variants: map[string]string{
+		templates.VariantHTML: "<p>{{devicename}}</p>",
+	}})
+
+	opts := NewSMTPOptions().
+		SetServer("smtp.test.com").
+		SetPort(587).
+		SetUsername("user").
+		SetPassword("pass").
+		SetFrom("from@test.com").
+		SetTo("to@test.com").
+		SetTemplateId("motion").
+		SetTemplateStore(store).
+		Build()
+
+	smtp, err := NewSMTP(opts, mockClient)
+	if err != nil {
+		t.Fatalf("failed to create SMTP client: %v", err)
+	}
+
+	message := models.Message{Title: "Motion", User: "cedric", DeviceName: "<frontdoor>"}
+	if _, err := smtp.Send(context.Background(), message); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if subject := sent.GetHeader("Subject"); len(subject) != 1 || subject[0] != "<frontdoor> detected motion" {
+		t.Errorf("expected rendered subject, got %v", subject)
+	}
+	var out strings.Builder
+	sent.WriteTo(&out)
+	if !strings.Contains(out.String(), "Hi cedric, <frontdoor> detected motion") {
+		t.Errorf("expected rendered text body, got %s", out.String())
+	}
+	if !strings.Contains(out.String(), "&lt;frontdoor&gt;") {
+		t.Errorf("expected rendered HTML body, got %s", out.String())
+	}
+
+	// Without subject the title of the message is kept, and the email only has an HTML body
+	if err := smtp.SendTemplate(context.Background(), "html-only", message); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if subject := sent.GetHeader("Subject"); len(subject) != 1 || subject[0] != "Motion" {
+		t.Errorf("expected the title of the message, got %v", subject)
+	}
+	out.Reset()
+	sent.WriteTo(&out)
+	if !strings.Contains(out.String(), "Content-Type: text/html") || strings.Contains(out.String(), "text/plain") {
+		t.Errorf("expected only an HTML body, got %s", out.String())
+	}
+
+	if err := smtp.SendTemplate(context.Background(), "unknown", message); !errors.Is(err, templates.ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound got %v", err)
+	}
+}
+
+// testSMTPServer is a minimal SMTP server used to test the SMTP client without network access
+type testSMTPServer struct {
+	listener   net.Listener
+	extensions []string
+	// tlsConfig encrypts the connections, from the start when implicit is set or with STARTTLS otherwise
+	tlsConfig *tls.Config
+	implicit  bool
+	// reject is a recipient address the server rejects
+	reject string
+	// dropAfterData closes the connection after an email is received, before it is acknowledged
+	dropAfterData bool
+	// username, password and token are the credentials the server accepts with AUTH
+	username string
+	password string
+	token    string
+	mu       sync.Mutex
+	messages []testSMTPMessage
+	conns    []net.Conn
+	dialed   int
+	// mechanisms are the authentication mechanisms the clients authenticated with
+	mechanisms []string
+}
+
+// testSMTPMessage is a message received by the testSMTPServer
+type testSMTPMessage struct {
+	From string
+	To   []string
+	Data string
+	TLS  bool
+}
+
+// newTestSMTPServer starts a testSMTPServer on a random local port, advertising the given extensions
+func newTestSMTPServer(t *testing.T, extensions ...string) *testSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start SMTP server: %v", err)
+	}
+	server := &testSMTPServer{listener: listener, extensions: extensions}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+// newTestSMTPTLSServer starts a testSMTPServer which encrypts the connections with the TLS configuration,
+// from the start when implicit is set, or after STARTTLS otherwise
+func newTestSMTPTLSServer(t *testing.T, config *tls.Config, implicit bool, extensions ...string) *testSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start SMTP server: %v", err)
+	}
+	if !implicit {
+		extensions = append([]string{"STARTTLS"}, extensions...)
+	}
+	server := &testSMTPServer{listener: listener, extensions: extensions, tlsConfig: config, implicit: implicit}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (s *testSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *testSMTPServer) received() []testSMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]testSMTPMessage{}, s.messages...)
+}
+
+// connections returns the number of connections the server accepted
+func (s *testSMTPServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dialed
+}
+
+// disconnect closes the open connections, as a server does with idle connections
+func (s *testSMTPServer) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.dialed++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *testSMTPServer) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+	encrypted := false
+	if s.tlsConfig != nil && s.implicit {
+		conn = tls.Server(conn, s.tlsConfig)
+		encrypted = true
+	}
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ESMTP")
+	message := testSMTPMessage{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case command == "STARTTLS" && s.tlsConfig != nil && !encrypted:
+			reply("220 Ready to start TLS")
+			conn = tls.Server(conn, s.tlsConfig)
+			reader = bufio.NewReader(conn)
+			encrypted = true
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			extensions := s.extensions
+			if encrypted && !s.implicit {
+				extensions = extensions[1:]
+			}
+			lines := append([]string{"localhost"}, extensions...)
+			for i, l := range lines {
+				if i == len(lines)-1 {
+					reply("250 " + l)
+				} else {
+					reply("250-" + l)
+				}
+			}
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			message = testSMTPMessage{From: strings.Trim(line[len("MAIL FROM:"):], "<>"), TLS: encrypted}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:") && s.reject != "" && strings.Contains(line, "<"+s.reject+">"):
+			reply("550 No such user")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.To = append(message.To, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 Start mail input")
+			var data strings.Builder
+			for {
+				l, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			message.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			drop := s.dropAfterData
+			s.mu.Unlock()
+			if drop {
+				return
+			}
+			reply("250 OK")
+		case strings.HasPrefix(command, "AUTH "):
+			if s.authenticate(line[len("AUTH "):], reader, reply) {
+				reply("235 Authentication successful")
+			} else {
+				reply("535 Authentication failed")
+			}
+		case command == "RSET", command == "NOOP":
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// authenticate runs the AUTH command with the mechanism and initial response, and reports whether
+// the credentials are valid
+func (s *testSMTPServer) authenticate(command string, reader *bufio.Reader, reply func(string)) bool {
+	mechanism, initial, _ := strings.Cut(command, " ")
+	mechanism = strings.ToUpper(mechanism)
+	challenge := func(text string) string {
+		reply("334 " + base64.StdEncoding.EncodeToString([]byte(text)))
+		line, _ := reader.ReadString('\n')
+		response, _ := base64.StdEncoding.DecodeString(strings.TrimRight(line, "\r\n"))
+		return string(response)
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(initial)
+
+	valid := false
+	switch mechanism {
+	case "PLAIN":
+		valid = string(decoded) == "\x00"+s.username+"\x00"+s.password
+	case "LOGIN":
+		valid = challenge("Username:") == s.username && challenge("Password:") == s.password
+	case "CRAM-MD5":
+		nonce := "<1896.697170952@localhost>"
+		mac := hmac.New(md5.New, []byte(s.password))
+		mac.Write([]byte(nonce))
+		valid = challenge(nonce) == s.username+" "+hex.EncodeToString(mac.Sum(nil))
+	case "XOAUTH2":
+		valid = string(decoded) == "user="+s.username+"\x01auth=Bearer "+s.token+"\x01\x01"
+		if !valid {
+			challenge(`{"status":"401","schemes":"Bearer","scope":"https://mail.google.com/"}`)
+		}
+	}
+	if valid {
+		s.mu.Lock()
+		s.mechanisms = append(s.mechanisms, mechanism)
+		s.mu.Unlock()
+	}
+	return valid
+}
+
+// authenticated returns the authentication mechanisms the clients authenticated with
+func (s *testSMTPServer) authenticated() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.mechanisms...)
+}
+
+func TestGomailClientSend(t *testing.T) {
+	server := newTestSMTPServer(t)
+	client := NewGomailClient("127.0.0.1", server.port(), "", "")
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", "from@test.com")
+	m.SetHeader("To", "to@test.com")
+	m.SetHeader("Subject", "Motion detected")
+	m.SetBody("text/plain", "Motion detected at the frontdoor")
+
+	if err := client.DialAndSend(context.Background(), m); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	received := server.received()
+	if len(received) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(received))
+	}
+	if received[0].From != "from@test.com" || len(received[0].To) != 1 || received[0].To[0] != "to@test.com" {
+		t.Errorf("unexpected envelope %+v", received[0])
+	}
+	if !strings.Contains(received[0].Data, "Subject: Motion detected") {
+		t.Errorf("expected subject in message data, got %q", received[0].Data)
+	}
+}
+
+func TestGomailClientContext(t *testing.T) {
+	// The server accepts connections but never greets the client
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client := NewGomailClient("127.0.0.1", listener.Addr().(*net.TCPAddr).Port, "", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = client.Dial(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("expected dial to be aborted by the context, took %s", time.Since(start))
+	}
+}
+
+func TestGomailClientTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	trusted, _ := TLSOptions{CACertificates: pki.CA}.Config("127.0.0.1")
+	mutual, _ := TLSOptions{CACertificates: pki.CA, Certificate: pki.ClientCert, Key: pki.ClientKey}.Config("127.0.0.1")
+	untrusted, _ := TLSOptions{}.Config("127.0.0.1")
+	otherName, _ := TLSOptions{CACertificates: pki.CA, ServerName: "smtp.example.com"}.Config("127.0.0.1")
+
+	tests := []struct {
+		name        string
+		server      func(t *testing.T) *testSMTPServer
+		mode        string
+		config      *tls.Config
+		expectError bool
+		expectTLS   bool
+	}{
+		{"Implicit", func(t *testing.T) *testSMTPServer { return newTestSMTPTLSServer(t, pki.serverConfig(false), true) }, TLSModeImplicit, trusted, false, true},
+		{"StartTLS", func(t *testing.T) *testSMTPServer { return newTestSMTPTLSServer(t, pki.serverConfig(false), false) }, TLSModeStartTLS, trusted, false, true},
+		{"StartTLSNotSupported", func(t *testing.T) *testSMTPServer { return newTestSMTPServer(t) }, TLSModeStartTLS, trusted, true, false},
+		{"Opportunistic", func(t *testing.T) *testSMTPServer { return newTestSMTPTLSServer(t, pki.serverConfig(false), false) }, TLSModeOpportunistic, trusted, false, true},
+		{"OpportunisticPlain", func(t *testing.T) *testSMTPServer { return newTestSMTPServer(t) }, TLSModeOpportunistic, trusted, false, false},
+		{"None", func(t *testing.T) *testSMTPServer { return newTestSMTPTLSServer(t, pki.serverConfig(false), false) }, TLSModeNone, trusted, false, false},
+		// The certificate of the server is verified by default
+		{"UntrustedCertificate", func(t *testing.T) *testSMTPServer { return newTestSMTPTLSServer(t, pki.serverConfig(false), false) }, "", untrusted, true, false},
+		{"WrongServerName", func(t *testing.T) *testSMTPServer { return newTestSMTPTLSServer(t, pki.serverConfig(false), true) }, TLSModeImplicit, otherName, true, false},
+		{"ClientCertificate", func(t *testing.T) *testSMTPServer { return newTestSMTPTLSServer(t, pki.serverConfig(true), false) }, TLSModeStartTLS, mutual, false, true},
+		{"MissingClientCertificate", func(t *testing.T) *testSMTPServer { return newTestSMTPTLSServer(t, pki.serverConfig(true), true) }, TLSModeImplicit, trusted, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := tt.server(t)
+			client := NewGomailClient("127.0.0.1", server.port(), "", "", WithTLS(tt.mode, tt.config))
+
+			m := gomail.NewMessage()
+			m.SetHeader("From", "from@test.com")
+			m.SetHeader("To", "to@test.com")
+			m.SetHeader("Subject", "Motion detected")
+			m.SetBody("text/plain", "Motion detected at the frontdoor")
+
+			err := client.DialAndSend(context.Background(), m)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error got %v", err)
+			}
+			received := server.received()
+			if len(received) != 1 || received[0].TLS != tt.expectTLS {
+				t.Errorf("expected 1 message with TLS %v, got %+v", tt.expectTLS, received)
+			}
+		})
+	}
+}
+
+func TestSMTPTLSOptions(t *testing.T) {
+	pki := newTestPKI(t)
+	server := newTestSMTPTLSServer(t, pki.serverConfig(false), false)
+
+	opts := NewSMTPOptions().
+		SetServer("127.0.0.1").
+		SetPort(server.port()).
+		SetUsername("user").
+		SetPassword("password").
+		SetFrom("from@test.com").
+		SetTo("to@test.com").
+		SetTLSMode(TLSModeStartTLS).
+		SetTLSCACertificates(pki.CA).
+		SetTLSMinVersion("1.2").
+		Build()
+	smtp, err := NewSMTP(opts)
+	if err != nil {
+		t.Fatalf("failed to setup SMTP: %v", err)
+	}
+	if err := smtp.SendEmail(context.Background(), "Motion detected", "Motion detected at the frontdoor", ""); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if received := server.received(); len(received) == 0 || !received[len(received)-1].TLS {
+		t.Errorf("expected the email to be sent over TLS, got %+v", received)
+	}
+
+	invalid := map[string]*SMTPOptions{
+		"TLSMode":    NewSMTPOptions().SetTLSMode("ssl").Build(),
+		"MinVersion": NewSMTPOptions().SetTLSMinVersion("1.4").Build(),
+		"Key":        NewSMTPOptions().SetTLSClientCertificate(pki.ClientCert, "").Build(),
+		"CA":         NewSMTPOptions().SetTLSCACertificates("not a certificate").Build(),
+	}
+	for name, opts := range invalid {
+		opts.Server, opts.Port, opts.Username, opts.Password = "127.0.0.1", 25, "user", "password"
+		opts.EmailFrom, opts.EmailTo = "from@test.com", "to@test.com"
+		if _, err := NewSMTP(opts); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSMTPRecipients(t *testing.T) {
+	server := newTestSMTPServer(t)
+
+	opts := NewSMTPOptions().
+		SetServer("127.0.0.1").
+		SetPort(server.port()).
+		SetUsername("user").
+		SetPassword("password").
+		SetFrom("alerts@test.com").
+		SetFromDisplay("UUG AI Alerts").
+		SetTo("security@test.com").
+		AddTo("guard@test.com").
+		AddCc("manager@test.com").
+		AddBcc("audit@test.com").
+		SetReplyTo("support@test.com").
+		SetHeader("List-Unsubscribe", "<https://uug.ai/unsubscribe>").
+		SetHeader("X-Entity-Ref-ID", "event-1").
+		Build()
+	smtp, err := NewSMTP(opts)
+	if err != nil {
+		t.Fatalf("failed to setup SMTP: %v", err)
+	}
+	if smtp.Destination() != "security@test.com, guard@test.com" {
+		t.Errorf("expected the To addresses as destination, got %q", smtp.Destination())
+	}
+
+	result, err := smtp.Send(context.Background(), models.Message{Title: "Motion detected", Body: "Motion detected at the frontdoor"})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	expected := []string{"security@test.com", "guard@test.com", "manager@test.com", "audit@test.com"}
+	if !reflect.DeepEqual(result.Recipients, expected) {
+		t.Errorf("expected recipients %v, got %v", expected, result.Recipients)
+	}
+
+	received := server.received()
+	if len(received) != 1 || !reflect.DeepEqual(received[0].To, expected) {
+		t.Fatalf("expected an envelope for all recipients, got %+v", received)
+	}
+	for _, header := range []string{
+		`From: "UUG AI Alerts" <alerts@test.com>`,
+		"To: security@test.com, guard@test.com",
+		"Cc: manager@test.com",
+		"Reply-To: support@test.com",
+		"List-Unsubscribe: <https://uug.ai/unsubscribe>",
+		"X-Entity-Ref-ID: event-1",
+	} {
+		if !strings.Contains(received[0].Data, header+"\r\n") {
+			t.Errorf("expected header %q in %q", header, received[0].Data)
+		}
+	}
+	if strings.Contains(received[0].Data, "audit@test.com") {
+		t.Errorf("expected the Bcc recipient to be hidden, got %q", received[0].Data)
+	}
+
+	// The recipients are overridden by the Data of the message
+	message := models.Message{
+		Title: "Motion detected",
+		Body:  "Motion detected at the frontdoor",
+		Data:  map[string]string{EmailToField: "Site team <site@test.com>, night@test.com", EmailBccField: ""},
+	}
+	if result, err = smtp.Send(context.Background(), message); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	expected = []string{`"Site team" <site@test.com>`, "night@test.com", "manager@test.com"}
+	if !reflect.DeepEqual(result.Recipients, expected) {
+		t.Errorf("expected recipients %v, got %v", expected, result.Recipients)
+	}
+
+	message.Data = map[string]string{EmailCcField: "not an address"}
+	if _, err := smtp.Send(context.Background(), message); err == nil {
+		t.Errorf("expected an error for an invalid address")
+	}
+	message.Data = map[string]string{EmailToField: "", EmailCcField: "", EmailBccField: ""}
+	if _, err := smtp.Send(context.Background(), message); err == nil {
+		t.Errorf("expected an error without recipients")
+	}
+
+	opts.Headers["subject"] = "Overridden"
+	if _, err := NewSMTP(opts); err == nil {
+		t.Errorf("expected an error for a reserved header")
+	}
+}
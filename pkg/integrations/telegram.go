@@ -1,27 +1,93 @@
 package integrations
 
 import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/uug-ai/integrations/pkg/format"
+	"github.com/uug-ai/integrations/pkg/templates"
 	"github.com/uug-ai/models/pkg/models"
 	tgbotapi "gopkg.in/telegram-bot-api.v4"
 )
 
 type Telegram struct {
-	Token   string `json:"token,omitempty"`
-	Channel string `json:"channel,omitempty"`
+	Token   string `json:"token,omitempty" validate:"required"`
+	Channel string `json:"channel,omitempty" validate:"required"`
+	// BodyTemplate renders the text of the message, see the templates package for the variables
+	BodyTemplate string `json:"body_template,omitempty"`
+	// TemplateId is the named template the text is rendered with, from its telegram (HTML) variant.
+	// It takes precedence over the body template.
+	TemplateId string `json:"template_id,omitempty"`
+	// Templates is the store of the named template, defaults to TemplateStore
+	Templates templates.Store `json:"-"`
+
+	template *messageTemplate
+}
+
+func init() {
+	MustRegister(IntegrationTelegram, DecodeJSON[Telegram], func(t Telegram) (Notifier, error) {
+		return NewTelegram(t)
+	})
 }
 
-func (t Telegram) Send(message models.Message) bool {
+// NewTelegram validates the configuration of Telegram and parses its body template,
+// so it isn't parsed again for every message
+func NewTelegram(t Telegram) (Telegram, error) {
+	if _, err := validated(t); err != nil {
+		return t, err
+	}
+	tmpl, err := newMessageTemplate("", t.BodyTemplate)
+	if err != nil {
+		return t, err
+	}
+	t.template = &tmpl
+	return t, nil
+}
+
+// Destination implements Destination, it returns the channel the messages are sent to
+func (t Telegram) Destination() string {
+	return t.Channel
+}
+
+func (t Telegram) Send(ctx context.Context, message models.Message) (DeliveryResult, error) {
+
+	start := time.Now()
+	result := DeliveryResult{Integration: IntegrationTelegram}
 
 	channelName := t.Channel //"c1375189391_8694429167782276799"
 	token := t.Token         //"592498002:AAHYGK-EEUXV3oFtf3mVUJEPWxCYfNkXdC0"
 
+	if channelName == "" {
+		return result.done(start, errors.New("telegram channel is empty"))
+	}
+
+	// Shorten url
+	url := ""
+	if len(message.Media) > 0 {
+		longUrl := templates.VideoUrl(message)
+		url = longUrl
+		//provider := "tinyurl"
+		//shortenedUrl, err := shorturl.Shorten(longUrl, provider)
+		//if err == nil {
+		// url = string(shortenedUrl)
+		//}
+	}
+
+	parts, err := t.render(ctx, message, url)
+	if err != nil {
+		return result.done(start, err)
+	}
+
 	// Create a bot with BotFather
 	// /newbot
-	bot, err := tgbotapi.NewBotAPI(token)
+	bot, err := tgbotapi.NewBotAPIWithClient(token, contextHTTPClient(ctx))
 	if err != nil {
-		return false
+		return result.done(start, err)
 	}
 	bot.Debug = false
 
@@ -35,25 +101,63 @@ func (t Telegram) Send(message models.Message) bool {
 		channelName = strings.Replace(channelId, "c", "-100", 1)
 	}
 
-	// Shorten url
-	url := ""
-	if len(message.Media) > 0 {
-		longUrl := message.Media[0].AtRuntimeMetadata.VideoUrl
-		url = longUrl
-		//provider := "tinyurl"
-		//shortenedUrl, err := shorturl.Shorten(longUrl, provider)
-		//if err == nil {
-		// url = string(shortenedUrl)
-		//}
+	// A text longer than the limit of Telegram is sent in multiple messages,
+	// the ID of the first message is returned
+	for i, text := range parts {
+		msg := tgbotapi.NewMessageToChannel(channelName, text)
+		msg.ParseMode = tgbotapi.ModeHTML
+		sent, err := bot.Send(msg)
+		if err != nil {
+			// Telegram tells how long to wait when the bot is flooding the chat
+			var apiErr tgbotapi.Error
+			if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+				result.StatusCode = http.StatusTooManyRequests
+				result.RetryAfter = time.Duration(apiErr.RetryAfter) * time.Second
+			}
+			return result.done(start, err)
+		}
+		if i == 0 {
+			result.MessageId = strconv.Itoa(sent.MessageID)
+		}
 	}
 
-	text := message.Body
-	if url != "" {
-		text = text + "\r\n" + url
-	}
+	result.Recipients = []string{channelName}
+	return result.done(start, nil)
+}
 
-	msg := tgbotapi.NewMessageToChannel(channelName, text)
-	bot.Send(msg)
+// render renders the text of the message, together with the url, in the HTML subset of Telegram and
+// splits it in parts which fit in a message. The telegram variant of a named template is HTML already,
+// the other templates and the body of the message are written in the neutral markup of the format package.
+func (t Telegram) render(ctx context.Context, message models.Message, url string) ([]string, error) {
+	var body string
+	if t.TemplateId != "" {
+		rendered, tmpl, err := renderNamed(ctx, t.Templates, t.TemplateId, templates.VariantTelegram, message)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl.IsHTML() {
+			text := rendered.Body
+			if url != "" {
+				text = text + "\r\n" + html.EscapeString(url)
+			}
+			return format.SplitTextFunc(text, format.TelegramMaxLength, format.UTF16Length), nil
+		}
+		body = rendered.Body
+	} else {
+		tmpl, err := parsedTemplate(t.template, "", t.BodyTemplate)
+		if err != nil {
+			return nil, err
+		}
+		rendered, err := tmpl.render(message)
+		if err != nil {
+			return nil, err
+		}
+		body = rendered.Body
+	}
 
-	return true
+	doc := format.Parse(body)
+	if url != "" {
+		doc.Blocks = append(doc.Blocks, format.Block{Spans: []format.Span{{Text: url, Url: url}}})
+	}
+	return format.SplitFunc(doc, format.TelegramHTML, format.TelegramMaxLength, format.UTF16Length), nil
 }
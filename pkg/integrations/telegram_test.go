@@ -1,5 +1,107 @@
 package integrations
 
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uug-ai/integrations/pkg/format"
+	"github.com/uug-ai/integrations/pkg/templates"
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestTelegramRender(t *testing.T) {
+	store := templates.NewMemoryStore(nil)
+	store.Add(templates.Definition{
+		Id: "motion",
+		Variants: map[string]string{
+			templates.VariantTelegram: "<b>{{devicename}}</b> detected motion",
+		},
+		Locales: map[string]map[string]string{
+			"nl": {templates.VariantTelegram: "<b>{{devicename}}</b> heeft beweging gedetecteerd om {{eventtime}}"},
+		},
+	})
+	store.Add(templates.Definition{Id: "offline", Variants: map[string]string{
+		templates.VariantText: "{{devicename}} is offline",
+	}})
+	parsed, err := NewTelegram(Telegram{Token: "token", Channel: "channel", BodyTemplate: "{{devicename}}: {{text}}"})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if _, err := NewTelegram(Telegram{Token: "token", Channel: "channel", BodyTemplate: "{{end}}"}); err == nil {
+		t.Errorf("expected an error for an invalid template")
+	}
+	tests := []struct {
+		telegram Telegram
+		locale   string
+		url      string
+		expected []string
+	}{
+		{Telegram{}, "", "", []string{"<b>Motion</b> &amp; sound"}},
+		{Telegram{BodyTemplate: "{{devicename}}: {{text}}"}, "", "", []string{"&lt;Front door&gt;: <b>Motion</b> &amp; sound"}},
+		// The template parsed by the constructor
+		{parsed, "", "", []string{"&lt;Front door&gt;: <b>Motion</b> &amp; sound"}},
+		{Telegram{TemplateId: "motion", Templates: store}, "", "", []string{"<b>&lt;Front door&gt;</b> detected motion"}},
+		{Telegram{TemplateId: "offline", Templates: store}, "", "", []string{"&lt;Front door&gt; is offline"}},
+		// A Dutch user receives the Dutch variant
+		{Telegram{TemplateId: "motion", Templates: store}, "nl-BE", "", []string{"<b>&lt;Front door&gt;</b> heeft beweging gedetecteerd om 23:13:20"}},
+		// The url is added as a link
+		{Telegram{}, "", "https://example.com/?a=1&b=2", []string{"<b>Motion</b> &amp; sound\n\n" +
+			`<a href="https://example.com/?a=1&amp;b=2">https://example.com/?a=1&amp;b=2</a>`}},
+		{Telegram{TemplateId: "motion", Templates: store}, "", "https://example.com/?a=1&b=2", []string{"<b>&lt;Front door&gt;</b> detected motion\r\n" +
+			"https://example.com/?a=1&amp;b=2"}},
+	}
+	for _, test := range tests {
+		message := models.Message{
+			Body:       "**Motion** & sound",
+			DeviceName: "<Front door>",
+			Timestamp:  1700000000,
+			Timezone:   "Europe/Amsterdam",
+			Data:       map[string]string{templates.LocaleField: test.locale},
+		}
+		parts, err := test.telegram.render(context.Background(), message, test.url)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(parts, test.expected) {
+			t.Errorf("expected %q got %q", test.expected, parts)
+		}
+	}
+
+	// A text longer than a Telegram message is split
+	message := models.Message{Body: strings.Repeat("Motion detected. ", 500)}
+	parts, err := Telegram{}.render(context.Background(), message, "")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(parts) != 3 {
+		t.Errorf("expected 3 parts got %d", len(parts))
+	}
+	for _, part := range parts {
+		if format.UTF16Length(part) > format.TelegramMaxLength {
+			t.Errorf("expected at most %d code units got %d", format.TelegramMaxLength, format.UTF16Length(part))
+		}
+	}
+
+	// Emoji count as two UTF-16 code units, in the telegram variant of a named template as well
+	store.Add(templates.Definition{Id: "emoji", Variants: map[string]string{
+		templates.VariantTelegram: "<b>{{devicename}}</b> " + strings.Repeat("🎥 ", 3000),
+	}})
+	for _, telegram := range []Telegram{{TemplateId: "emoji", Templates: store}, {}} {
+		message := models.Message{DeviceName: "Front door", Body: strings.Repeat("🎥 ", 3000)}
+		parts, err := telegram.render(context.Background(), message, "")
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		for _, part := range parts {
+			if format.UTF16Length(part) > format.TelegramMaxLength {
+				t.Errorf("expected at most %d code units got %d", format.TelegramMaxLength, format.UTF16Length(part))
+			}
+		}
+	}
+}
+
 /*func TestTelegram(t *testing.T) {
 	m := models.Message{}
 	m.Type = "message"
@@ -19,5 +121,5 @@ package integrations
 		Token:   "xxx",
 		Channel: "xxx",
 	}
-	telegram.Send(m)
+	telegram.Send(context.Background(), m)
 }*/
@@ -0,0 +1,101 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/uug-ai/integrations/pkg/templates"
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// TemplateStore is the store named templates are loaded from, when an integration has
+// a template ID but no store of its own, e.g. when it is built from a configuration
+var TemplateStore templates.Store
+
+// messageTemplate renders the title and body of a message from the templates of an integration
+type messageTemplate struct {
+	title *templates.Template
+	body  *templates.Template
+}
+
+// newMessageTemplate parses the title and body templates of an integration. When a template
+// is empty, the title or body of the message is sent as is.
+func newMessageTemplate(title string, body string) (messageTemplate, error) {
+	t := messageTemplate{}
+	var err error
+	if title != "" {
+		if t.title, err = templates.New("title", title, nil); err != nil {
+			return t, err
+		}
+	}
+	if body != "" {
+		if t.body, err = templates.New("body", body, nil); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// parsedTemplate returns the templates parsed by the constructor of an integration, or parses
+// them when the integration was configured without its constructor
+func parsedTemplate(parsed *messageTemplate, title string, body string) (messageTemplate, error) {
+	if parsed != nil {
+		return *parsed, nil
+	}
+	return newMessageTemplate(title, body)
+}
+
+// render returns the message with its title and body rendered from the templates
+func (t messageTemplate) render(message models.Message) (models.Message, error) {
+	rendered := message
+	var err error
+	if t.title != nil {
+		if rendered.Title, err = t.title.Render(message); err != nil {
+			return message, err
+		}
+	}
+	if t.body != nil {
+		if rendered.Body, err = t.body.Render(message); err != nil {
+			return message, err
+		}
+	}
+	return rendered, nil
+}
+
+// namedTemplate returns the named template from the store, or from TemplateStore when no store is provided
+func namedTemplate(ctx context.Context, store templates.Store, id string) (*templates.Set, error) {
+	if store == nil {
+		store = TemplateStore
+	}
+	if store == nil {
+		return nil, errors.New("no template store for template " + id)
+	}
+	return store.Get(ctx, id)
+}
+
+// renderNamed returns the message with its title rendered from the subject of the named template,
+// and its body from the variant of the channel, both in the locale of the message. The title is
+// kept when the template has no subject.
+// It also returns the template the body was rendered with.
+func renderNamed(ctx context.Context, store templates.Store, id string, variant string, message models.Message) (models.Message, *templates.Template, error) {
+	set, err := namedTemplate(ctx, store, id)
+	if err != nil {
+		return message, nil, err
+	}
+
+	rendered := message
+	if subject := set.Select(templates.VariantSubject, message); subject != nil {
+		if rendered.Title, err = subject.Render(message); err != nil {
+			return message, nil, err
+		}
+	}
+	body := set.Select(variant, message)
+	if body == nil {
+		return message, nil, fmt.Errorf("%w: %s/%s", templates.ErrVariantNotFound, id, variant)
+	}
+	if rendered.Body, err = body.Render(message); err != nil {
+		return message, nil, err
+	}
+	return rendered, body, nil
+}
@@ -0,0 +1,106 @@
+package integrations
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// tlsVersions are the TLS versions by name, as configured in TLSOptions.MinVersion
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSOptions holds the TLS configuration of a connection to a server. By default the certificate
+// of the server is verified against the system roots, and TLS 1.2 is the minimum version.
+type TLSOptions struct {
+	// CACertificates is a PEM bundle of the certificate authorities the certificate of the server
+	// is verified with, instead of the system roots
+	CACertificates string `json:"ca_certificates,omitempty"`
+	// Certificate and Key are the PEM encoded client certificate and its private key,
+	// presented when the server requests a client certificate
+	Certificate string `json:"certificate,omitempty" validate:"required_with=Key"`
+	Key         string `json:"key,omitempty" validate:"required_with=Certificate"`
+	// ServerName is the name the certificate of the server is verified for, defaults to the host
+	ServerName string `json:"server_name,omitempty"`
+	// MinVersion is the minimum TLS version: "1.0", "1.1", "1.2" or "1.3", defaults to "1.2"
+	MinVersion string `json:"min_version,omitempty" validate:"omitempty,oneof=1.0 1.1 1.2 1.3"`
+	// InsecureSkipVerify disables the verification of the certificate of the server.
+	// It should only be used for testing, the connection is open to man-in-the-middle attacks.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+	// PinnedCertificates are the SHA-256 fingerprints of certificates, hex encoded with or without colons,
+	// see CertificateFingerprint. The connection fails unless one of them is the certificate of the server
+	// or of its verified chain. Together with InsecureSkipVerify, only the certificate of the server is
+	// matched, so a self-signed certificate is trusted by its fingerprint only.
+	PinnedCertificates []string `json:"pinned_certificates,omitempty"`
+}
+
+// CertificateFingerprint returns the SHA-256 fingerprint of the certificate, hex encoded, as pinned
+// in TLSOptions.PinnedCertificates
+func CertificateFingerprint(certificate *x509.Certificate) string {
+	fingerprint := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(fingerprint[:])
+}
+
+// Config returns the TLS configuration for a connection to the host
+func (o TLSOptions) Config(host string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         cmp.Or(o.ServerName, host),
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.MinVersion != "" {
+		version, ok := tlsVersions[o.MinVersion]
+		if !ok {
+			return nil, errors.New("unsupported TLS version " + o.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	if o.CACertificates != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(o.CACertificates)) {
+			return nil, errors.New("no valid certificates in the CA bundle")
+		}
+		config.RootCAs = pool
+	}
+	if o.Certificate != "" || o.Key != "" {
+		certificate, err := tls.X509KeyPair([]byte(o.Certificate), []byte(o.Key))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	if len(o.PinnedCertificates) > 0 {
+		pins := make([]string, len(o.PinnedCertificates))
+		for i, pin := range o.PinnedCertificates {
+			pins[i] = strings.ToLower(strings.ReplaceAll(pin, ":", ""))
+			if fingerprint, err := hex.DecodeString(pins[i]); err != nil || len(fingerprint) != sha256.Size {
+				return nil, errors.New("invalid SHA-256 certificate fingerprint " + pin)
+			}
+		}
+		// VerifyConnection runs after the verification of the chain, also when it is skipped. The server can
+		// append any certificate to the chain it presents, so only the verified chains are matched, or
+		// only the certificate of the server when the verification is skipped.
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			certificates := slices.Concat(state.VerifiedChains...)
+			if o.InsecureSkipVerify {
+				certificates = state.PeerCertificates[:min(len(state.PeerCertificates), 1)]
+			}
+			for _, certificate := range certificates {
+				if slices.Contains(pins, CertificateFingerprint(certificate)) {
+					return nil
+				}
+			}
+			return errors.New("tls: the certificate of the server doesn't match a pinned certificate")
+		}
+	}
+	return config, nil
+}
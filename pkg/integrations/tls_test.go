@@ -0,0 +1,123 @@
+package integrations
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testPKI holds a certificate authority with a server and a client certificate it issued
+type testPKI struct {
+	CA         string
+	Server     tls.Certificate
+	ClientCert string
+	ClientKey  string
+	pool       *x509.CertPool
+}
+
+// newTestPKI creates a certificate authority, a certificate for a server on 127.0.0.1 and
+// localhost, and a client certificate
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) (string, string) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("failed to create certificate: %v", err)
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+			string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	}
+
+	pki := &testPKI{CA: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})), pool: x509.NewCertPool()}
+	pki.pool.AddCert(ca)
+	serverCert, serverKey := issue(2, "localhost", x509.ExtKeyUsageServerAuth)
+	if pki.Server, err = tls.X509KeyPair([]byte(serverCert), []byte(serverKey)); err != nil {
+		t.Fatalf("failed to load server certificate: %v", err)
+	}
+	pki.ClientCert, pki.ClientKey = issue(3, "client", x509.ExtKeyUsageClientAuth)
+	return pki
+}
+
+// serverConfig returns the TLS configuration of a server, which requires a client certificate when clientAuth is set
+func (p *testPKI) serverConfig(clientAuth bool) *tls.Config {
+	config := &tls.Config{Certificates: []tls.Certificate{p.Server}}
+	if clientAuth {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = p.pool
+	}
+	return config
+}
+
+func TestTLSOptionsConfig(t *testing.T) {
+	pki := newTestPKI(t)
+
+	config, err := TLSOptions{}.Config("smtp.example.com")
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if config.ServerName != "smtp.example.com" || config.MinVersion != tls.VersionTLS12 || config.InsecureSkipVerify {
+		t.Errorf("expected a verifying TLS 1.2 configuration got %+v", config)
+	}
+
+	config, err = TLSOptions{
+		CACertificates: pki.CA,
+		Certificate:    pki.ClientCert,
+		Key:            pki.ClientKey,
+		ServerName:     "mail.internal",
+		MinVersion:     "1.3",
+	}.Config("10.0.0.1")
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if config.ServerName != "mail.internal" || config.MinVersion != tls.VersionTLS13 || config.RootCAs == nil || len(config.Certificates) != 1 {
+		t.Errorf("expected the configured options got %+v", config)
+	}
+
+	invalid := []TLSOptions{
+		{CACertificates: "not a certificate"},
+		{Certificate: pki.ClientCert, Key: "not a key"},
+		{MinVersion: "2.0"},
+		{PinnedCertificates: []string{"not a fingerprint"}},
+	}
+	for _, opts := range invalid {
+		if _, err := opts.Config("localhost"); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+}
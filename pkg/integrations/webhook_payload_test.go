@@ -0,0 +1,143 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"testing"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestWebhookSendMessage(t *testing.T) {
+	message := models.Message{Title: "Motion detected", DeviceId: "camera-1", DeviceName: `Front "door"`, Classifications: []string{"person", "car"}}
+
+	t.Run("JSON", func(t *testing.T) {
+		mockClient := &MockWebhookHTTPClient{}
+		opts := NewWebhookOptions().
+			SetUrl("https://homeassistant.local/api/webhook/motion").
+			SetTitleTemplate("{{devicename}} detected {{classifications}}").
+			SetPayloadTemplate("json", `{"camera": "{{deviceid}}", "message": "{{title}}"}`).
+			Build()
+		webhook, err := NewWebhook(opts, mockClient)
+		if err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		// Send uses the payload template as well
+		if _, err := webhook.Send(context.Background(), message); err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		var payload map[string]string
+		if err := json.Unmarshal([]byte(mockClient.LastBody), &payload); err != nil {
+			t.Fatalf("expected a JSON payload got %s", mockClient.LastBody)
+		}
+		if payload["camera"] != "camera-1" || payload["message"] != `Front "door" detected person, car` {
+			t.Errorf("expected the rendered payload got %v", payload)
+		}
+		if mockClient.LastBodyType != "application/json" {
+			t.Errorf("expected content type application/json got %s", mockClient.LastBodyType)
+		}
+	})
+
+	t.Run("Form", func(t *testing.T) {
+		mockClient := &MockWebhookHTTPClient{}
+		opts := NewWebhookOptions().
+			SetUrl("https://n8n.example.com/webhook/motion").
+			SetPayloadTemplate("form", "camera={{devicename}}&objects={{classifications}}").
+			Build()
+		webhook, err := NewWebhook(opts, mockClient)
+		if err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		if _, err := webhook.SendMessage(context.Background(), message); err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		form, err := url.ParseQuery(mockClient.LastBody)
+		if err != nil || form.Get("camera") != `Front "door"` || form.Get("objects") != "person, car" {
+			t.Errorf("expected the form payload got %s", mockClient.LastBody)
+		}
+		if mockClient.LastBodyType != "application/x-www-form-urlencoded" {
+			t.Errorf("expected content type application/x-www-form-urlencoded got %s", mockClient.LastBodyType)
+		}
+	})
+
+	t.Run("XML", func(t *testing.T) {
+		mockClient := &MockWebhookHTTPClient{}
+		opts := NewWebhookOptions().
+			SetUrl("https://vms.example.com/events").
+			SetContentType("text/xml").
+			SetPayloadTemplate("xml", `<event camera="{{devicename}}"><title>{{title}}</title></event>`).
+			Build()
+		webhook, err := NewWebhook(opts, mockClient)
+		if err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		if _, err := webhook.SendMessage(context.Background(), message); err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		var event struct {
+			Camera string `xml:"camera,attr"`
+			Title  string `xml:"title"`
+		}
+		if err := xml.Unmarshal([]byte(mockClient.LastBody), &event); err != nil {
+			t.Fatalf("expected an XML payload got %s", mockClient.LastBody)
+		}
+		if event.Camera != `Front "door"` || event.Title != "Motion detected" {
+			t.Errorf("expected the rendered payload got %+v", event)
+		}
+		if mockClient.LastBodyType != "text/xml" {
+			t.Errorf("expected content type text/xml got %s", mockClient.LastBodyType)
+		}
+	})
+
+	t.Run("InvalidJSON", func(t *testing.T) {
+		mockClient := &MockWebhookHTTPClient{}
+		opts := NewWebhookOptions().
+			SetUrl("https://example.com/hook").
+			SetPayloadTemplate("json", `{"camera": {{deviceid}}}`).
+			Build()
+		webhook, err := NewWebhook(opts, mockClient)
+		if err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		if _, err := webhook.SendMessage(context.Background(), message); err == nil {
+			t.Errorf("expected an error for an invalid JSON payload")
+		}
+		if mockClient.DoCalled {
+			t.Errorf("expected no request for an invalid JSON payload")
+		}
+	})
+
+	t.Run("NoPayloadTemplate", func(t *testing.T) {
+		webhook, err := NewWebhook(NewWebhookOptions().SetUrl("https://example.com/hook").Build(), &MockWebhookHTTPClient{})
+		if err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+		if _, err := webhook.SendMessage(context.Background(), message); err == nil {
+			t.Errorf("expected an error without payload template")
+		}
+	})
+}
+
+func TestWebhookPayloadOptions(t *testing.T) {
+	tests := map[string]struct {
+		opts      *WebhookOptions
+		expectErr bool
+	}{
+		"Valid":             {NewWebhookOptions().SetPayloadTemplate("xml", "<event>{{title}}</event>").Build(), false},
+		"UnsupportedFormat": {NewWebhookOptions().SetPayloadTemplate("yaml", "title: {{title}}").Build(), true},
+		"MissingFormat":     {&WebhookOptions{PayloadTemplate: `{"title": "{{title}}"}`}, true},
+		"InvalidTemplate":   {NewWebhookOptions().SetPayloadTemplate("json", `{"title": "{{title"}`).Build(), true},
+	}
+	for name, tt := range tests {
+		tt.opts.Url = "https://example.com/hook"
+		_, err := NewWebhook(tt.opts, &MockWebhookHTTPClient{})
+		if tt.expectErr && err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if !tt.expectErr && err != nil {
+			t.Errorf("%s: expected no error got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package integrations
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestWebhookRequest(t *testing.T) {
+	message := models.Message{Title: "Motion detected", DeviceId: "camera-1", DeviceName: "Front door", Timestamp: 1700000000}
+	tests := []struct {
+		name     string
+		builder  *WebhookOptionsBuilder
+		method   string
+		url      string
+		headers  map[string]string
+		form     map[string]string
+		jsonBody bool
+	}{
+		{
+			name:     "Defaults",
+			builder:  NewWebhookOptions(),
+			method:   http.MethodPost,
+			url:      "https://example.com/hook",
+			headers:  map[string]string{"Content-Type": "application/json", "Authorization": ""},
+			jsonBody: true,
+		},
+		{
+			name:     "MethodHeadersAndQuery",
+			builder:  NewWebhookOptions().SetMethod(http.MethodPut).SetHeader("X-API-Key", "secret").SetHeader("X-Device", "{{devicename}}").SetQueryParam("device", "{{deviceid}}"),
+			method:   http.MethodPut,
+			url:      "https://example.com/hook?device=camera-1",
+			headers:  map[string]string{"X-API-Key": "secret", "X-Device": "Front door"},
+			jsonBody: true,
+		},
+		{
+			name:     "BasicAuth",
+			builder:  NewWebhookOptions().SetBasicAuth("user", "password"),
+			method:   http.MethodPost,
+			url:      "https://example.com/hook",
+			headers:  map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte("user:password"))},
+			jsonBody: true,
+		},
+		{
+			name:     "BearerTokenOverridesHeader",
+			builder:  NewWebhookOptions().SetHeader("Authorization", "ApiKey other").SetBearerToken("token"),
+			method:   http.MethodPost,
+			url:      "https://example.com/hook",
+			headers:  map[string]string{"Authorization": "Bearer token"},
+			jsonBody: true,
+		},
+		{
+			name:     "VendorJSON",
+			builder:  NewWebhookOptions().SetMethod(http.MethodPatch).SetContentType("application/vnd.api+json"),
+			method:   http.MethodPatch,
+			url:      "https://example.com/hook",
+			headers:  map[string]string{"Content-Type": "application/vnd.api+json"},
+			jsonBody: true,
+		},
+		{
+			name:    "Form",
+			builder: NewWebhookOptions().SetContentType("application/x-www-form-urlencoded"),
+			method:  http.MethodPost,
+			url:     "https://example.com/hook",
+			headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			form:    map[string]string{"title": "Motion detected", "device_name": "Front door", "timestamp": "1700000000"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockWebhookHTTPClient{}
+			webhook, err := NewWebhook(tt.builder.SetUrl("https://example.com/hook").Build(), mockClient)
+			if err != nil {
+				t.Fatalf("expected no error got %v", err)
+			}
+			if _, err := webhook.Send(context.Background(), message); err != nil {
+				t.Fatalf("expected no error got %v", err)
+			}
+			if mockClient.LastMethod != tt.method {
+				t.Errorf("expected method %s got %s", tt.method, mockClient.LastMethod)
+			}
+			if mockClient.LastURL != tt.url {
+				t.Errorf("expected URL %s got %s", tt.url, mockClient.LastURL)
+			}
+			for name, value := range tt.headers {
+				if got := mockClient.LastHeader.Get(name); got != value {
+					t.Errorf("expected header %s %q got %q", name, value, got)
+				}
+			}
+			if tt.jsonBody && !strings.Contains(mockClient.LastBody, `"device_name":"Front door"`) {
+				t.Errorf("expected a JSON body got %s", mockClient.LastBody)
+			}
+			if tt.form != nil {
+				form, err := url.ParseQuery(mockClient.LastBody)
+				if err != nil {
+					t.Fatalf("expected a form body got %s", mockClient.LastBody)
+				}
+				for name, value := range tt.form {
+					if got := form.Get(name); got != value {
+						t.Errorf("expected form field %s %q got %q", name, value, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookUnsupportedContentType(t *testing.T) {
+	mockClient := &MockWebhookHTTPClient{}
+	opts := NewWebhookOptions().SetUrl("https://example.com/hook").SetContentType("application/xml").Build()
+	webhook, err := NewWebhook(opts, mockClient)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if _, err := webhook.Send(context.Background(), models.Message{Title: "Motion detected"}); err == nil {
+		t.Errorf("expected an error for an XML message")
+	}
+	if err := webhook.SendPayload(context.Background(), "<event>motion</event>"); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if mockClient.LastBodyType != "application/xml" || mockClient.LastBody != "<event>motion</event>" {
+		t.Errorf("expected the XML payload got %s %s", mockClient.LastBodyType, mockClient.LastBody)
+	}
+}
+
+func TestWebhookOAuth2(t *testing.T) {
+	var tokenRequests atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("client_id") != "client" || r.PostForm.Get("scope") != "events:write" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		tokenRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "access-token", "expires_in": 3600, "token_type": "Bearer"}`))
+	}))
+	defer tokenServer.Close()
+
+	status := http.StatusOK
+	mockClient := &MockWebhookHTTPClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: status, Status: http.StatusText(status), Body: io.NopCloser(strings.NewReader(""))}, nil
+		},
+	}
+	opts := NewWebhookOptions().
+		SetUrl("https://example.com/hook").
+		SetOAuth2ClientCredentials(tokenServer.URL, "client", "secret", "events:write").
+		Build()
+	webhook, err := NewWebhook(opts, mockClient)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	for range 2 {
+		if _, err := webhook.Send(context.Background(), models.Message{Title: "Motion detected"}); err != nil {
+			t.Fatalf("expected no error got %v", err)
+		}
+	}
+	if got := mockClient.LastHeader.Get("Authorization"); got != "Bearer access-token" {
+		t.Errorf("expected the access token got %q", got)
+	}
+	if n := tokenRequests.Load(); n != 1 {
+		t.Errorf("expected the access token to be cached, got %d token requests", n)
+	}
+
+	// A rejected access token is requested again
+	status = http.StatusUnauthorized
+	if _, err := webhook.Send(context.Background(), models.Message{Title: "Motion detected"}); err == nil {
+		t.Fatalf("expected an error")
+	}
+	status = http.StatusOK
+	if _, err := webhook.Send(context.Background(), models.Message{Title: "Motion detected"}); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if n := tokenRequests.Load(); n != 2 {
+		t.Errorf("expected the rejected access token to be requested again, got %d token requests", n)
+	}
+}
+
+func TestWebhookRequestOptions(t *testing.T) {
+	tests := map[string]struct {
+		builder   *WebhookOptionsBuilder
+		expectErr bool
+	}{
+		"Put":                  {NewWebhookOptions().SetMethod(http.MethodPut), false},
+		"UnsupportedMethod":    {NewWebhookOptions().SetMethod(http.MethodGet), true},
+		"BasicWithoutUsername": {NewWebhookOptions().SetBasicAuth("", "password"), true},
+		"BearerWithoutToken":   {NewWebhookOptions().SetBearerToken(""), true},
+		"OAuth2TokenSource":    {NewWebhookOptions().SetTokenSource(&countingTokenSource{token: "token"}), false},
+		"OAuth2WithoutURL":     {NewWebhookOptions().SetOAuth2ClientCredentials("", "client", "secret"), true},
+		"OAuth2InvalidURL":     {NewWebhookOptions().SetOAuth2ClientCredentials("not a url", "client", "secret"), true},
+		"InvalidHeader":        {NewWebhookOptions().SetHeader("X-Device", "{{devicename"), true},
+		"InvalidQuery":         {NewWebhookOptions().SetQueryParam("device", "{{end}}"), true},
+	}
+	for name, tt := range tests {
+		_, err := NewWebhook(tt.builder.SetUrl("https://example.com/hook").Build(), &MockWebhookHTTPClient{})
+		if tt.expectErr && err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if !tt.expectErr && err != nil {
+			t.Errorf("%s: expected no error got %v", name, err)
+		}
+	}
+}
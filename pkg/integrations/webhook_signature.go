@@ -0,0 +1,86 @@
+package integrations
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWebhookSignatureHeader is the header the signature of a webhook request is sent in
+const DefaultWebhookSignatureHeader = "X-Webhook-Signature"
+
+// DefaultSignatureTolerance is the maximum age of a signed webhook request, older requests are rejected as replay
+const DefaultSignatureTolerance = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature is returned when no signature of a webhook request matches one of the secrets
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrSignatureExpired is returned when the timestamp of a webhook request is outside the tolerance
+	ErrSignatureExpired = errors.New("webhook signature timestamp outside the tolerance")
+)
+
+// SignWebhookPayload returns the signature of the body at the timestamp, in the format
+// "t=<unix timestamp>,v1=<hex signature>", with a v1 signature for every secret. A signature
+// is the HMAC-SHA256 of "<unix timestamp>.<body>" with the secret.
+func SignWebhookPayload(body []byte, timestamp time.Time, secrets ...string) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	header := "t=" + t
+	for _, secret := range secrets {
+		header += ",v1=" + hex.EncodeToString(webhookSignature(secret, t, body))
+	}
+	return header
+}
+
+// VerifyWebhookSignature verifies the signature header of a webhook request with the body. The
+// request is valid when a signature matches one of the secrets, and its timestamp is within the
+// tolerance of the current time. A tolerance of 0 uses DefaultSignatureTolerance.
+func VerifyWebhookSignature(header string, body []byte, tolerance time.Duration, secrets ...string) error {
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+
+	var t string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			// Signatures which can't be decoded never match
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	for _, secret := range secrets {
+		expected := webhookSignature(secret, t, body)
+		for _, signature := range signatures {
+			if hmac.Equal(signature, expected) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// webhookSignature returns the HMAC-SHA256 of the timestamp and the body with the secret
+func webhookSignature(secret string, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
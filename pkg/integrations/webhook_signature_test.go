@@ -0,0 +1,99 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestWebhookSigning(t *testing.T) {
+	mockClient := &MockWebhookHTTPClient{}
+	opts := NewWebhookOptions().
+		SetUrl("https://example.com/hook").
+		AddSigningSecret("old-secret").
+		AddSigningSecret("new-secret").
+		Build()
+	webhook, err := NewWebhook(opts, mockClient)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if _, err := webhook.Send(context.Background(), models.Message{Title: "Motion detected"}); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	header := mockClient.LastHeader.Get(DefaultWebhookSignatureHeader)
+	if !strings.HasPrefix(header, "t=") || strings.Count(header, "v1=") != 2 {
+		t.Fatalf("expected a timestamp and a signature per secret got %q", header)
+	}
+	body := []byte(mockClient.LastBody)
+	for _, secret := range []string{"old-secret", "new-secret"} {
+		if err := VerifyWebhookSignature(header, body, 0, secret); err != nil {
+			t.Errorf("expected the signature to verify with %s got %v", secret, err)
+		}
+	}
+	if err := VerifyWebhookSignature(header, body, 0, "other-secret"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature got %v", err)
+	}
+
+	// The signature header is configurable, and requests are only signed with a secret
+	opts = NewWebhookOptions().SetUrl("https://example.com/hook").AddSigningSecret("secret").SetSignatureHeader("X-UUG-Signature").Build()
+	webhook, _ = NewWebhook(opts, mockClient)
+	if err := webhook.SendPayload(context.Background(), `{"title": "Motion detected"}`); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if err := VerifyWebhookSignature(mockClient.LastHeader.Get("X-UUG-Signature"), []byte(`{"title": "Motion detected"}`), 0, "secret"); err != nil {
+		t.Errorf("expected a valid signature got %v", err)
+	}
+	webhook, _ = NewWebhook(NewWebhookOptions().SetUrl("https://example.com/hook").Build(), mockClient)
+	webhook.SendPayload(context.Background(), `{"title": "Motion detected"}`)
+	if header := mockClient.LastHeader.Get(DefaultWebhookSignatureHeader); header != "" {
+		t.Errorf("expected no signature without secret got %q", header)
+	}
+
+	if _, err := NewWebhook(NewWebhookOptions().SetUrl("https://example.com/hook").AddSigningSecret("").Build(), mockClient); err == nil {
+		t.Errorf("expected an error for an empty secret")
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"title": "Motion detected"}`)
+	now := time.Now()
+	tests := []struct {
+		name      string
+		header    string
+		body      []byte
+		tolerance time.Duration
+		expected  error
+	}{
+		{"Valid", SignWebhookPayload(body, now, "secret"), body, 0, nil},
+		{"RotatedSecret", SignWebhookPayload(body, now, "old", "secret"), body, 0, nil},
+		{"WithinTolerance", SignWebhookPayload(body, now.Add(-4*time.Minute), "secret"), body, 0, nil},
+		{"Expired", SignWebhookPayload(body, now.Add(-6*time.Minute), "secret"), body, 0, ErrSignatureExpired},
+		{"Future", SignWebhookPayload(body, now.Add(6*time.Minute), "secret"), body, 0, ErrSignatureExpired},
+		{"CustomTolerance", SignWebhookPayload(body, now.Add(-2*time.Minute), "secret"), body, time.Minute, ErrSignatureExpired},
+		{"TamperedBody", SignWebhookPayload(body, now, "secret"), []byte(`{"title": "All clear"}`), 0, ErrInvalidSignature},
+		{"WrongSecret", SignWebhookPayload(body, now, "other"), body, 0, ErrInvalidSignature},
+		{"NoSignature", "t=" + SignWebhookPayload(body, now)[2:], body, 0, ErrInvalidSignature},
+		{"Malformed", "v1=zz,t=now", body, 0, ErrInvalidSignature},
+		{"Empty", "", body, 0, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyWebhookSignature(tt.header, tt.body, tt.tolerance, "secret"); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v got %v", tt.expected, err)
+			}
+		})
+	}
+
+	// The timestamp is part of the signature
+	_, signature, _ := strings.Cut(SignWebhookPayload(body, now, "secret"), ",")
+	replayed := "t=" + strconv.FormatInt(now.Unix()+1, 10) + "," + signature
+	if err := VerifyWebhookSignature(replayed, body, 0, "secret"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected an error for a changed timestamp")
+	}
+}
@@ -1,34 +1,44 @@
 package integrations
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
 )
 
 // MockWebhookHTTPClient is a mock implementation of WebhookHTTPClient for testing
 type MockWebhookHTTPClient struct {
-	PostFunc     func(url string, contentType string, body io.Reader) (*http.Response, error)
-	PostCalled   bool
+	DoFunc       func(req *http.Request) (*http.Response, error)
+	DoCalled     bool
+	LastMethod   string
 	LastURL      string
 	LastBodyType string
 	LastBody     string
+	LastHeader   http.Header
 }
 
-func (m *MockWebhookHTTPClient) Post(url string, contentType string, body io.Reader) (*http.Response, error) {
-	m.PostCalled = true
-	m.LastURL = url
-	m.LastBodyType = contentType
-	if body != nil {
-		bodyBytes, _ := io.ReadAll(body)
+func (m *MockWebhookHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.DoCalled = true
+	m.LastMethod = req.Method
+	m.LastURL = req.URL.String()
+	m.LastBodyType = req.Header.Get("Content-Type")
+	m.LastHeader = req.Header
+	if req.Body != nil {
+		bodyBytes, _ := io.ReadAll(req.Body)
 		m.LastBody = string(bodyBytes)
 	}
-	if m.PostFunc != nil {
-		return m.PostFunc(url, contentType, body)
+	if m.DoFunc != nil {
+		return m.DoFunc(req)
 	}
 	return &http.Response{
 		StatusCode: 200,
@@ -155,15 +165,15 @@ func TestWebhookFieldEmpty(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		mockClient.PostCalled = false // Reset for each test
-		err := webhookIntegration.Send(tt.body)
+		mockClient.DoCalled = false // Reset for each test
+		err := webhookIntegration.SendPayload(context.Background(), tt.body)
 		if tt.expectError && err == nil {
 			t.Errorf("expected error got nil for body: '%s'", tt.body)
 		}
 		if !tt.expectError && err != nil {
 			t.Errorf("expected no error got %v for body: '%s'", err, tt.body)
 		}
-		if !tt.expectError && !mockClient.PostCalled {
+		if !tt.expectError && !mockClient.DoCalled {
 			t.Errorf("expected Post to be called but it wasn't")
 		}
 	}
@@ -240,7 +250,7 @@ func TestWebhookSendWithMock(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create mock client with specific error behavior
 			mockClient := &MockWebhookHTTPClient{
-				PostFunc: func(url string, contentType string, body io.Reader) (*http.Response, error) {
+				DoFunc: func(req *http.Request) (*http.Response, error) {
 					if tt.mockPostError != nil {
 						return nil, tt.mockPostError
 					}
@@ -263,17 +273,17 @@ func TestWebhookSendWithMock(t *testing.T) {
 			}
 
 			// Send message
-			err = webhookIntegration.Send(tt.body)
+			err = webhookIntegration.SendPayload(context.Background(), tt.body)
 			if tt.expectError && err == nil {
 				t.Errorf("expected error got nil")
 			}
 			if !tt.expectError && err != nil {
 				t.Errorf("expected error to be nil got %v", err)
 			}
-			if tt.expectPost && !mockClient.PostCalled {
+			if tt.expectPost && !mockClient.DoCalled {
 				t.Errorf("expected Post to be called but it wasn't")
 			}
-			if !tt.expectPost && mockClient.PostCalled {
+			if !tt.expectPost && mockClient.DoCalled {
 				t.Errorf("expected Post not to be called but it was")
 			}
 		})
@@ -292,7 +302,7 @@ func TestWebhookContentType(t *testing.T) {
 		t.Fatalf("failed to setup Webhook: %v", err)
 	}
 
-	err = webhookIntegration.Send("Test message")
+	err = webhookIntegration.SendPayload(context.Background(), "Test message")
 	if err != nil {
 		t.Fatalf("failed to send webhook: %v", err)
 	}
@@ -315,7 +325,7 @@ func TestWebhookURL(t *testing.T) {
 		t.Fatalf("failed to setup Webhook: %v", err)
 	}
 
-	err = webhookIntegration.Send("Test message")
+	err = webhookIntegration.SendPayload(context.Background(), "Test message")
 	if err != nil {
 		t.Fatalf("failed to send webhook: %v", err)
 	}
@@ -396,7 +406,7 @@ func TestIntegrationWebhook(t *testing.T) {
 				t.Fatalf("failed to setup Webhook: %v", err)
 			}
 
-			err = webhookIntegration.Send(tt.body)
+			err = webhookIntegration.SendPayload(context.Background(), tt.body)
 			if tt.expectError && err == nil {
 				t.Errorf("expected error got nil")
 			}
@@ -406,3 +416,103 @@ func TestIntegrationWebhook(t *testing.T) {
 		})
 	}
 }
+
+func TestWebhookNotifier(t *testing.T) {
+	mockClient := &MockWebhookHTTPClient{}
+
+	opts := NewWebhookOptions().
+		SetUrl("https://example.com/webhook").
+		Build()
+
+	var notifier Notifier
+	notifier, err := NewWebhook(opts, mockClient)
+	if err != nil {
+		t.Fatalf("failed to setup Webhook: %v", err)
+	}
+
+	result, err := notifier.Send(context.Background(), models.Message{Title: "Motion detected", DeviceId: "camera-1"})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if result.Integration != IntegrationWebhook {
+		t.Errorf("expected integration %q, got %q", IntegrationWebhook, result.Integration)
+	}
+	if result.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d", result.StatusCode)
+	}
+
+	var payload models.Message
+	if err := json.Unmarshal([]byte(mockClient.LastBody), &payload); err != nil {
+		t.Fatalf("expected JSON payload, got %q", mockClient.LastBody)
+	}
+	if payload.Title != "Motion detected" || payload.DeviceId != "camera-1" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestWebhookTemplates(t *testing.T) {
+	mockClient := &MockWebhookHTTPClient{}
+
+	opts := NewWebhookOptions().
+		SetUrl("https://example.com/webhook").
+		SetTitleTemplate("{{devicename}} detected {{classifications}}").
+		SetBodyTemplate("{{eventdatetime}} ({{timezone}})").
+		Build()
+
+	webhook, err := NewWebhook(opts, mockClient)
+	if err != nil {
+		t.Fatalf("failed to setup Webhook: %v", err)
+	}
+
+	_, err = webhook.Send(context.Background(), models.Message{
+		DeviceName:      "Front door",
+		Classifications: []string{"person", "car"},
+		Timestamp:       1700000000,
+		Timezone:        "Europe/Brussels",
+	})
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+
+	var payload models.Message
+	if err := json.Unmarshal([]byte(mockClient.LastBody), &payload); err != nil {
+		t.Fatalf("expected JSON payload, got %q", mockClient.LastBody)
+	}
+	if payload.Title != "Front door detected person, car" {
+		t.Errorf("expected rendered title, got %q", payload.Title)
+	}
+	if payload.Body != "2023-11-14 23:13:20 (Europe/Brussels)" {
+		t.Errorf("expected rendered body, got %q", payload.Body)
+	}
+}
+
+func TestWebhookContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	opts := NewWebhookOptions().
+		SetUrl(server.URL).
+		Build()
+
+	webhookIntegration, err := NewWebhook(opts) // Use real HTTP client
+	if err != nil {
+		t.Fatalf("failed to setup Webhook: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	result, err := webhookIntegration.Send(ctx, models.Message{Title: "Motion detected"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded got %v", err)
+	}
+	if result.Delivered() {
+		t.Errorf("expected message not to be delivered")
+	}
+}
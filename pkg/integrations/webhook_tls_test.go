@@ -0,0 +1,185 @@
+package integrations
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestWebhookTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	var clientCertificates atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientCertificates.Store(int32(len(r.TLS.PeerCertificates)))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = pki.serverConfig(true)
+	server.StartTLS()
+	defer server.Close()
+	serverFingerprint := CertificateFingerprint(server.Certificate())
+	block, _ := pem.Decode([]byte(pki.CA))
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse CA: %v", err)
+	}
+	caFingerprint := CertificateFingerprint(ca)
+
+	tests := []struct {
+		name      string
+		builder   *WebhookOptionsBuilder
+		expectErr bool
+	}{
+		{name: "MutualTLS", builder: NewWebhookOptions().SetTLSCACertificates(pki.CA).SetTLSClientCertificate(pki.ClientCert, pki.ClientKey)},
+		{name: "WithoutClientCertificate", builder: NewWebhookOptions().SetTLSCACertificates(pki.CA), expectErr: true},
+		{name: "UntrustedServer", builder: NewWebhookOptions().SetTLSClientCertificate(pki.ClientCert, pki.ClientKey), expectErr: true},
+		{name: "OtherServerName", builder: NewWebhookOptions().SetTLSCACertificates(pki.CA).SetTLSClientCertificate(pki.ClientCert, pki.ClientKey).SetTLSServerName("webhook.example.com"), expectErr: true},
+		{
+			name:    "PinnedCertificate",
+			builder: NewWebhookOptions().SetTLSCACertificates(pki.CA).SetTLSClientCertificate(pki.ClientCert, pki.ClientKey).AddTLSPinnedCertificate(strings.ToUpper(serverFingerprint)),
+		},
+		{
+			name:    "PinnedCA",
+			builder: NewWebhookOptions().SetTLSCACertificates(pki.CA).SetTLSClientCertificate(pki.ClientCert, pki.ClientKey).AddTLSPinnedCertificate(caFingerprint),
+		},
+		{
+			name:      "OtherPinnedCertificate",
+			builder:   NewWebhookOptions().SetTLSCACertificates(pki.CA).SetTLSClientCertificate(pki.ClientCert, pki.ClientKey).AddTLSPinnedCertificate(strings.Repeat("ab", 32)),
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientCertificates.Store(0)
+			webhook, err := NewWebhook(tt.builder.SetUrl(server.URL).Build())
+			if err != nil {
+				t.Fatalf("expected no error got %v", err)
+			}
+			_, err = webhook.Send(context.Background(), models.Message{Title: "Motion detected"})
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error got %v", err)
+			}
+			if n := clientCertificates.Load(); n != 1 {
+				t.Errorf("expected the client certificate got %d certificates", n)
+			}
+		})
+	}
+}
+
+func TestWebhookPinnedSelfSignedCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// A self-signed certificate is trusted by its fingerprint
+	opts := NewWebhookOptions().
+		SetUrl(server.URL).
+		SetTLSInsecureSkipVerify(true).
+		AddTLSPinnedCertificate(CertificateFingerprint(server.Certificate())).
+		Build()
+	webhook, err := NewWebhook(opts)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if err := webhook.SendPayload(context.Background(), `{"title": "Motion detected"}`); err != nil {
+		t.Errorf("expected no error got %v", err)
+	}
+
+	opts.TLS.PinnedCertificates = []string{strings.Repeat("00:", 31) + "00"}
+	webhook, err = NewWebhook(opts)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if err := webhook.SendPayload(context.Background(), `{"title": "Motion detected"}`); err == nil {
+		t.Errorf("expected an error for an other certificate")
+	}
+}
+
+func TestWebhookPinnedCertificateAppended(t *testing.T) {
+	pki := newTestPKI(t)
+	// The server presents its own certificate, and appends the pinned certificate behind it
+	block, _ := pem.Decode([]byte(pki.ClientCert))
+	pinned, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: append(pki.Server.Certificate, pinned.Raw),
+		PrivateKey:  pki.Server.PrivateKey,
+	}}}
+	server.StartTLS()
+	defer server.Close()
+
+	tests := map[string]*WebhookOptionsBuilder{
+		"InsecureSkipVerify": NewWebhookOptions().SetTLSInsecureSkipVerify(true),
+		"VerifiedChain":      NewWebhookOptions().SetTLSCACertificates(pki.CA),
+	}
+	for name, builder := range tests {
+		t.Run(name, func(t *testing.T) {
+			webhook, err := NewWebhook(builder.SetUrl(server.URL).AddTLSPinnedCertificate(CertificateFingerprint(pinned)).Build())
+			if err != nil {
+				t.Fatalf("expected no error got %v", err)
+			}
+			if err := webhook.SendPayload(context.Background(), `{"title": "Motion detected"}`); err == nil {
+				t.Errorf("expected an error for a pinned certificate which isn't the certificate of the server")
+			}
+		})
+	}
+}
+
+func TestWebhookProxy(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	opts := NewWebhookOptions().
+		SetUrl("http://webhook.internal/hook").
+		SetProxy("http://user:password@" + strings.TrimPrefix(proxy.URL, "http://")).
+		Build()
+	webhook, err := NewWebhook(opts)
+	if err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	if err := webhook.SendPayload(context.Background(), `{"title": "Motion detected"}`); err != nil {
+		t.Fatalf("expected no error got %v", err)
+	}
+	r := <-requests
+	if r.Host != "webhook.internal" || !strings.HasPrefix(r.Header.Get("Proxy-Authorization"), "Basic ") {
+		t.Errorf("expected the request through the proxy got host %q and authorization %q", r.Host, r.Header.Get("Proxy-Authorization"))
+	}
+}
+
+func TestWebhookTLSOptions(t *testing.T) {
+	tests := map[string]*WebhookOptionsBuilder{
+		"InvalidCABundle":       NewWebhookOptions().SetTLSCACertificates("not a certificate"),
+		"CertificateWithoutKey": NewWebhookOptions().SetTLSClientCertificate("certificate", ""),
+		"InvalidFingerprint":    NewWebhookOptions().AddTLSPinnedCertificate("abcd"),
+		"InvalidProxy":          NewWebhookOptions().SetProxy("not a url"),
+		"InvalidMinVersion":     NewWebhookOptions().SetTLSMinVersion("2.0"),
+	}
+	for name, builder := range tests {
+		if _, err := NewWebhook(builder.SetUrl("https://example.com/hook").Build()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
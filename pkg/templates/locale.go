@@ -0,0 +1,299 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// LocaleField is the key in the Data of a message which holds the locale of the recipient, e.g. "nl-BE"
+const LocaleField = "locale"
+
+// DefaultLocale is the locale used when neither the message nor the options have a locale
+const DefaultLocale = "en"
+
+// Locale holds the formatting of dates, times and numbers of a language or region
+type Locale struct {
+	// Tag is the BCP 47 tag of the locale, e.g. "nl" or "nl-BE"
+	Tag string
+	// DateFormat, TimeFormat and DateTimeFormat are the layouts of {{date}}, {{time}} and {{datetime}}
+	DateFormat     string
+	TimeFormat     string
+	DateTimeFormat string
+	// DecimalSeparator and GroupSeparator are used to format numbers, e.g. "," and "." for 1.234,5
+	DecimalSeparator string
+	GroupSeparator   string
+	// Months, ShortMonths, Days and ShortDays replace the English names of a layout, e.g. "January" and "Jan"
+	Months      [12]string
+	ShortMonths [12]string
+	Days        [7]string
+	ShortDays   [7]string
+}
+
+// locales are the registered locales by tag
+var (
+	localesMu sync.RWMutex
+	locales   = map[string]Locale{}
+)
+
+func init() {
+	for _, locale := range []Locale{
+		{
+			Tag: "en", DateFormat: "2006-01-02", TimeFormat: "15:04:05", DateTimeFormat: "2006-01-02 15:04:05",
+			DecimalSeparator: ".", GroupSeparator: ",",
+		},
+		{
+			Tag: "en-US", DateFormat: "01/02/2006", TimeFormat: "3:04:05 PM", DateTimeFormat: "01/02/2006 3:04:05 PM",
+			DecimalSeparator: ".", GroupSeparator: ",",
+		},
+		{
+			Tag: "en-GB", DateFormat: "02/01/2006", TimeFormat: "15:04:05", DateTimeFormat: "02/01/2006 15:04:05",
+			DecimalSeparator: ".", GroupSeparator: ",",
+		},
+		{
+			Tag: "nl", DateFormat: "02-01-2006", TimeFormat: "15:04:05", DateTimeFormat: "02-01-2006 15:04:05",
+			DecimalSeparator: ",", GroupSeparator: ".",
+			Months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+			ShortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+			Days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+			ShortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		},
+		{
+			Tag: "fr", DateFormat: "02/01/2006", TimeFormat: "15:04:05", DateTimeFormat: "02/01/2006 15:04:05",
+			DecimalSeparator: ",", GroupSeparator: " ",
+			Months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+			ShortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+			Days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+			ShortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+		},
+		{
+			Tag: "de", DateFormat: "02.01.2006", TimeFormat: "15:04:05", DateTimeFormat: "02.01.2006 15:04:05",
+			DecimalSeparator: ",", GroupSeparator: ".",
+			Months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+			ShortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+			Days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+			ShortDays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+		},
+		{
+			Tag: "es", DateFormat: "02/01/2006", TimeFormat: "15:04:05", DateTimeFormat: "02/01/2006 15:04:05",
+			DecimalSeparator: ",", GroupSeparator: ".",
+			Months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+			ShortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+			Days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+			ShortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		},
+	} {
+		RegisterLocale(locale)
+	}
+}
+
+// RegisterLocale registers the formatting of a locale, replacing the locale with the same tag
+func RegisterLocale(locale Locale) {
+	localesMu.Lock()
+	defer localesMu.Unlock()
+	locales[normalizeLocale(locale.Tag)] = locale
+}
+
+// LookupLocale returns the first registered locale of the fallback chain of the tag,
+// e.g. "nl" for "nl-BE", or the default locale when none is registered
+func LookupLocale(tag string) Locale {
+	localesMu.RLock()
+	defer localesMu.RUnlock()
+	for _, candidate := range LocaleChain(tag, DefaultLocale) {
+		if locale, ok := locales[candidate]; ok {
+			return locale
+		}
+	}
+	return locales[DefaultLocale]
+}
+
+// LocaleChain returns the fallback chain of a locale, followed by the chain of the fallback
+// locale, e.g. "nl-BE", "nl", "en" for LocaleChain("nl_BE", "en")
+func LocaleChain(locale string, fallback string) []string {
+	chain := []string{}
+	seen := map[string]bool{}
+	for _, tag := range []string{locale, fallback} {
+		tag = normalizeLocale(tag)
+		for tag != "" {
+			if !seen[tag] {
+				seen[tag] = true
+				chain = append(chain, tag)
+			}
+			i := strings.LastIndex(tag, "-")
+			if i < 0 {
+				break
+			}
+			tag = tag[:i]
+		}
+	}
+	return chain
+}
+
+// MessageLocale returns the locale of the message, or the locale of the options when the message has none
+func MessageLocale(message models.Message, opts *Options) string {
+	if locale := message.Data[LocaleField]; locale != "" {
+		return normalizeLocale(locale)
+	}
+	if opts != nil && opts.Locale != "" {
+		return normalizeLocale(opts.Locale)
+	}
+	return DefaultLocale
+}
+
+// normalizeLocale normalizes a locale to the form "nl-BE"
+func normalizeLocale(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	for i, part := range parts {
+		if i == 0 {
+			parts[i] = strings.ToLower(part)
+		} else if len(part) == 2 {
+			parts[i] = strings.ToUpper(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// layoutNames matches the month and day names of a time layout, longest first
+var layoutNames = regexp.MustCompile(`January|Jan|Monday|Mon`)
+
+// FormatTime formats the time with the layout, with the month and day names of the locale
+func (l Locale) FormatTime(t time.Time, layout string) string {
+	if l.Months[0] == "" {
+		return t.Format(layout)
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, match := range layoutNames.FindAllStringIndex(layout, -1) {
+		out.WriteString(t.Format(layout[last:match[0]]))
+		switch layout[match[0]:match[1]] {
+		case "January":
+			out.WriteString(l.Months[t.Month()-1])
+		case "Jan":
+			out.WriteString(l.ShortMonths[t.Month()-1])
+		case "Monday":
+			out.WriteString(l.Days[t.Weekday()])
+		case "Mon":
+			out.WriteString(l.ShortDays[t.Weekday()])
+		}
+		last = match[1]
+	}
+	out.WriteString(t.Format(layout[last:]))
+	return out.String()
+}
+
+// FormatNumber formats the number with the given number of decimals and the separators of the locale
+func (l Locale) FormatNumber(value float64, decimals int) string {
+	formatted := strconv.FormatFloat(math.Abs(value), 'f', decimals, 64)
+	integer, fraction, _ := strings.Cut(formatted, ".")
+
+	var out strings.Builder
+	if value < 0 && strings.Trim(formatted, "0.") != "" {
+		out.WriteString("-")
+	}
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			out.WriteString(l.GroupSeparator)
+		}
+		out.WriteRune(digit)
+	}
+	if fraction != "" {
+		out.WriteString(l.DecimalSeparator)
+		out.WriteString(fraction)
+	}
+	return out.String()
+}
+
+// leadingNumber matches a value which starts with a number, e.g. "1234.5 MB"
+var leadingNumber = regexp.MustCompile(`^(-?\d+)(?:\.(\d+))?(.*)$`)
+
+// formatValue formats the number a value starts with, keeping its decimals and unit,
+// e.g. "1234.5 MB" is "1.234,5 MB" in Dutch. Other values are returned as is.
+func (l Locale) formatValue(value string) string {
+	match := leadingNumber.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return value
+	}
+	digits := match[1]
+	if match[2] != "" {
+		digits += "." + match[2]
+	}
+	number, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		return value
+	}
+	return l.FormatNumber(number, len(match[2])) + match[3]
+}
+
+// Catalog holds the translations of messages by locale
+type Catalog struct {
+	mu           sync.RWMutex
+	translations map[string]map[string]string
+}
+
+// NewCatalog creates an empty message catalog
+func NewCatalog() *Catalog {
+	return &Catalog{translations: map[string]map[string]string{}}
+}
+
+// Add adds the translations of a locale to the catalog, e.g. "motion_detected": "Beweging gedetecteerd door %s"
+func (c *Catalog) Add(locale string, translations map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	locale = normalizeLocale(locale)
+	if c.translations[locale] == nil {
+		c.translations[locale] = map[string]string{}
+	}
+	for key, translation := range translations {
+		c.translations[locale][key] = translation
+	}
+}
+
+// Translate returns the translation of the key for the first locale of the fallback chain which has one,
+// formatted with the arguments. It returns the key when there is no translation.
+func (c *Catalog) Translate(locale string, key string, args ...any) string {
+	translation := key
+	c.mu.RLock()
+	for _, tag := range LocaleChain(locale, DefaultLocale) {
+		if t, ok := c.translations[tag][key]; ok {
+			translation = t
+			break
+		}
+	}
+	c.mu.RUnlock()
+	if len(args) == 0 {
+		return translation
+	}
+	return fmt.Sprintf(translation, args...)
+}
+
+// LoadCatalogFS loads a message catalog from the JSON files of a file system, one file per locale
+// named after the locale, e.g. "nl.json" holding {"motion_detected": "Beweging gedetecteerd"}
+func LoadCatalogFS(fsys fs.FS) (*Catalog, error) {
+	catalog := NewCatalog()
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		translations := map[string]string{}
+		if err := json.Unmarshal(data, &translations); err != nil {
+			return nil, err
+		}
+		catalog.Add(strings.TrimSuffix(path.Base(file), ".json"), translations)
+	}
+	return catalog, nil
+}
@@ -0,0 +1,197 @@
+package templates
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestLocaleChain(t *testing.T) {
+	tests := []struct {
+		locale   string
+		fallback string
+		expected []string
+	}{
+		{"nl_be", "en", []string{"nl-BE", "nl", "en"}},
+		{"nl-BE", "nl", []string{"nl-BE", "nl"}},
+		{"", "en-GB", []string{"en-GB", "en"}},
+		{"zh-Hant-TW", "", []string{"zh-Hant-TW", "zh-Hant", "zh"}},
+	}
+	for _, test := range tests {
+		chain := LocaleChain(test.locale, test.fallback)
+		if !reflect.DeepEqual(chain, test.expected) {
+			t.Errorf("%s: expected %v got %v", test.locale, test.expected, chain)
+		}
+	}
+
+	if LookupLocale("nl-BE").Tag != "nl" {
+		t.Errorf("expected nl for nl-BE got %s", LookupLocale("nl-BE").Tag)
+	}
+	if LookupLocale("xx").Tag != DefaultLocale {
+		t.Errorf("expected the default locale for an unknown locale got %s", LookupLocale("xx").Tag)
+	}
+}
+
+func TestLocaleFormat(t *testing.T) {
+	date := time.Date(2024, time.March, 4, 9, 5, 0, 0, time.UTC)
+	nl := LookupLocale("nl")
+	if formatted := nl.FormatTime(date, "Monday 2 January 2006, Mon 2 Jan"); formatted != "maandag 4 maart 2024, ma 4 mrt" {
+		t.Errorf("expected Dutch names got %q", formatted)
+	}
+	if formatted := LookupLocale("en").FormatTime(date, "Mon 2 Jan"); formatted != "Mon 4 Mar" {
+		t.Errorf("expected English names got %q", formatted)
+	}
+
+	tests := []struct {
+		locale   string
+		value    float64
+		decimals int
+		expected string
+	}{
+		{"en", 1234567.891, 2, "1,234,567.89"},
+		{"nl", 1234567.891, 1, "1.234.567,9"},
+		{"de", -1234, 0, "-1.234"},
+		{"nl", 12, 0, "12"},
+		{"nl", -0.001, 1, "0,0"},
+	}
+	for _, test := range tests {
+		if formatted := LookupLocale(test.locale).FormatNumber(test.value, test.decimals); formatted != test.expected {
+			t.Errorf("%s %v: expected %q got %q", test.locale, test.value, test.expected, formatted)
+		}
+	}
+
+	if formatted := nl.formatValue("1234.5 MB"); formatted != "1.234,5 MB" {
+		t.Errorf("expected 1.234,5 MB got %q", formatted)
+	}
+	if formatted := nl.formatValue("unlimited"); formatted != "unlimited" {
+		t.Errorf("expected the value as is got %q", formatted)
+	}
+}
+
+func TestRenderLocale(t *testing.T) {
+	message := models.Message{
+		Timezone:      "Europe/Amsterdam",
+		Timestamp:     1700000000,
+		Media:         []models.Media{{StartTimestamp: 1700000000}},
+		DataUsage:     "1536.25 MB",
+		NumberOfMedia: "1200",
+		Data:          map[string]string{LocaleField: "nl_NL"},
+	}
+
+	rendered, err := Render("{{date}} {{time}} | {{eventdatetime}} | {{dataUsage}} | {{numberOfMedia}} | {{locale}}", message, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := "14-11-2023 23:13:20 | 14-11-2023 23:13:20 | 1.536,25 MB | 1.200 | nl-NL"
+	if rendered != expected {
+		t.Errorf("expected %q got %q", expected, rendered)
+	}
+
+	rendered, _ = Render(`{{formatTime "Monday 2 January" mediaTimestamp}} {{number 1 1234.56}}`, message, nil)
+	if rendered != "dinsdag 14 november 1.234,6" {
+		t.Errorf("expected Dutch formatting got %q", rendered)
+	}
+
+	// Without locale in the message, the locale of the options is used
+	message.Data = nil
+	opts := NewOptions().SetLocale("de").Build()
+	rendered, _ = Render("{{date}} {{dataUsage}}", message, opts)
+	if rendered != "14.11.2023 1.536,25 MB" {
+		t.Errorf("expected German formatting got %q", rendered)
+	}
+
+	// Explicit layouts take precedence over the layouts of the locale
+	opts = NewOptions().SetLocale("nl").SetDateFormat("2 Jan 2006", "15:04", "2 Jan 2006 15:04").Build()
+	rendered, _ = Render("{{date}} {{time}}", message, opts)
+	if rendered != "14 nov 2023 23:13" {
+		t.Errorf("expected the explicit layouts got %q", rendered)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	catalog, err := LoadCatalogFS(fstest.MapFS{
+		"en.json":    {Data: []byte(`{"motion_detected": "Motion detected by %s", "watch": "Watch the recording"}`)},
+		"nl.json":    {Data: []byte(`{"motion_detected": "Beweging gedetecteerd door %s"}`)},
+		"nl-BE.json": {Data: []byte(`{"watch": "Bekijk de opname"}`)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	opts := NewOptions().SetCatalog(catalog).Build()
+	source := `{{t "motion_detected" devicename}}. {{t "watch"}}. {{t "unknown"}}`
+	tests := map[string]string{
+		"nl-BE": "Beweging gedetecteerd door camera. Bekijk de opname. unknown",
+		"nl":    "Beweging gedetecteerd door camera. Watch the recording. unknown",
+		"fr":    "Motion detected by camera. Watch the recording. unknown",
+	}
+	for locale, expected := range tests {
+		message := models.Message{DeviceName: "camera", Data: map[string]string{LocaleField: locale}}
+		rendered, err := Render(source, message, opts)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", locale, err)
+		}
+		if rendered != expected {
+			t.Errorf("%s: expected %q got %q", locale, expected, rendered)
+		}
+	}
+
+	if _, err := LoadCatalogFS(fstest.MapFS{"nl.json": {Data: []byte(`{`)}}); err == nil {
+		t.Errorf("expected an error for an invalid catalog")
+	}
+}
+
+func TestSetLocales(t *testing.T) {
+	store, err := LoadFS(fstest.MapFS{
+		"motion/subject.txt":    {Data: []byte("Motion detected")},
+		"motion/subject.nl.txt": {Data: []byte("Beweging gedetecteerd")},
+		"motion/text.txt":       {Data: []byte("{{devicename}} detected motion")},
+		"motion/text.nl.txt":    {Data: []byte("{{devicename}} heeft beweging gedetecteerd")},
+		"motion/html.html":      {Data: []byte("<p>{{devicename}}</p>")},
+		"motion/slack.fr.md":    {Data: []byte("*{{devicename}}* a détecté un mouvement")},
+	}, NewOptions().SetLocale("en").Build())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	set, _ := store.Get(context.Background(), "motion")
+	if !reflect.DeepEqual(set.Locales(), []string{"fr", "nl"}) {
+		t.Errorf("expected locales [fr nl] got %v", set.Locales())
+	}
+
+	tests := []struct {
+		locale   string
+		variant  string
+		expected string
+	}{
+		{"nl-BE", VariantSubject, "Beweging gedetecteerd"},
+		{"nl-BE", VariantSlack, "garage heeft beweging gedetecteerd"},
+		{"nl", VariantHTML, "<p>garage</p>"},
+		{"fr", VariantSlack, "*garage* a détecté un mouvement"},
+		{"fr", VariantSubject, "Motion detected"},
+		{"", VariantShort, "garage detected motion"},
+	}
+	for _, test := range tests {
+		message := models.Message{DeviceName: "garage", Data: map[string]string{LocaleField: test.locale}}
+		rendered, err := set.Render(test.variant, message)
+		if err != nil {
+			t.Fatalf("%s/%s: unexpected error %v", test.locale, test.variant, err)
+		}
+		if rendered != test.expected {
+			t.Errorf("%s/%s: expected %q got %q", test.locale, test.variant, test.expected, rendered)
+		}
+	}
+
+	if set.Lookup(VariantSubject) == nil {
+		t.Errorf("expected the subject in the locale of the options")
+	}
+
+	// The variant of the selected template tells whether the fallback was selected
+	message := models.Message{Data: map[string]string{LocaleField: "nl"}}
+	if variant := set.Select(VariantSlack, message).Variant(); variant != VariantText {
+		t.Errorf("expected the text variant got %q", variant)
+	}
+}
@@ -0,0 +1,326 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/uug-ai/models/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The variants a named template can hold, one for every kind of channel
+const (
+	// VariantSubject is the title of the message, e.g. the subject of an email
+	VariantSubject = "subject"
+	// VariantHTML is the HTML body of an email
+	VariantHTML = "html"
+	// VariantText is the plain text body of an email, and the fallback of the other variants
+	VariantText = "text"
+	// VariantSlack is the body of a Slack message, formatted as mrkdwn
+	VariantSlack = "slack"
+	// VariantTelegram is the body of a Telegram message, formatted with the HTML subset of Telegram
+	VariantTelegram = "telegram"
+	// VariantShort is a short text, e.g. for SMS and Pushover
+	VariantShort = "short"
+)
+
+var (
+	// ErrTemplateNotFound is returned when a store has no template with the requested ID
+	ErrTemplateNotFound = errors.New("template not found")
+	// ErrVariantNotFound is returned when a template has no variant for the requested channel
+	ErrVariantNotFound = errors.New("template variant not found")
+)
+
+// htmlVariants are the variants which are parsed as HTML, so the values of the message are escaped
+var htmlVariants = map[string]bool{
+	VariantHTML:     true,
+	VariantTelegram: true,
+}
+
+// fallbacks are the variants which are rendered when a template has no variant for the channel
+var fallbacks = map[string][]string{
+	VariantSlack:    {VariantText},
+	VariantTelegram: {VariantText},
+	VariantShort:    {VariantText},
+}
+
+// Definition is the source of a named template, as stored in MongoDB
+type Definition struct {
+	Id string `json:"id" bson:"_id"`
+	// Variants holds the source of the template by variant, e.g. "subject", "html" and "text"
+	Variants map[string]string `json:"variants" bson:"variants"`
+	// Locales holds the translated variants by locale, e.g. "nl": {"subject": "..."}
+	Locales map[string]map[string]string `json:"locales,omitempty" bson:"locales,omitempty"`
+}
+
+// Set is a parsed named template, holding a template for every variant and locale
+type Set struct {
+	Id       string
+	options  *Options
+	variants map[string]map[string]*Template
+}
+
+// NewSet parses the variants of a named template. The html and telegram variants are parsed as
+// HTML templates, the other variants as plain text templates.
+func NewSet(definition Definition, opts *Options) (*Set, error) {
+	if definition.Id == "" {
+		return nil, errors.New("template id is required")
+	}
+	set := &Set{Id: definition.Id, options: withDefaults(opts), variants: map[string]map[string]*Template{}}
+	if err := set.parse("", definition.Variants); err != nil {
+		return nil, err
+	}
+	for locale, variants := range definition.Locales {
+		if err := set.parse(normalizeLocale(locale), variants); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// parse parses the variants of a locale, the default variants have no locale
+func (s *Set) parse(locale string, variants map[string]string) error {
+	if s.variants[locale] == nil {
+		s.variants[locale] = map[string]*Template{}
+	}
+	for variant, source := range variants {
+		name := s.Id + "/" + variant
+		if locale != "" {
+			name = s.Id + "/" + locale + "/" + variant
+		}
+		var t *Template
+		var err error
+		if htmlVariants[variant] {
+			t, err = NewHTML(name, source, s.options)
+		} else {
+			t, err = New(name, source, s.options)
+		}
+		if err != nil {
+			return err
+		}
+		t.variant = variant
+		s.variants[locale][variant] = t
+	}
+	return nil
+}
+
+// Variants returns the default variants of the template, sorted by name
+func (s *Set) Variants() []string {
+	variants := make([]string, 0, len(s.variants[""]))
+	for variant := range s.variants[""] {
+		variants = append(variants, variant)
+	}
+	sort.Strings(variants)
+	return variants
+}
+
+// Locales returns the locales the template is translated in, sorted by name
+func (s *Set) Locales() []string {
+	locales := []string{}
+	for locale := range s.variants {
+		if locale != "" {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Lookup returns the template of the variant in the locale of the options, see Select
+func (s *Set) Lookup(variant string) *Template {
+	return s.lookup(s.options.Locale, variant)
+}
+
+// Select returns the template of the variant in the locale of the message. The locales of the fallback
+// chain of the message are tried in order, e.g. "nl-BE", "nl", the locale of the options and the default
+// variants. In every locale the variant is tried first, then its fallback (the text variant).
+// It returns nil when none exists.
+func (s *Set) Select(variant string, message models.Message) *Template {
+	return s.lookup(MessageLocale(message, s.options), variant)
+}
+
+// lookup returns the template of the variant for the fallback chain of the locale
+func (s *Set) lookup(locale string, variant string) *Template {
+	for _, tag := range append(LocaleChain(locale, s.options.Locale), "") {
+		variants := s.variants[tag]
+		if t, ok := variants[variant]; ok {
+			return t
+		}
+		for _, fallback := range fallbacks[variant] {
+			if t, ok := variants[fallback]; ok {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// Render renders the variant, or its fallback, in the locale of the message
+func (s *Set) Render(variant string, message models.Message) (string, error) {
+	t := s.Select(variant, message)
+	if t == nil {
+		return "", fmt.Errorf("%w: %s/%s", ErrVariantNotFound, s.Id, variant)
+	}
+	return t.Render(message)
+}
+
+// Store holds named templates
+type Store interface {
+	// Get returns the template with the ID, or ErrTemplateNotFound
+	Get(ctx context.Context, id string) (*Set, error)
+}
+
+// MemoryStore holds named templates in memory
+type MemoryStore struct {
+	options *Options
+
+	mu   sync.RWMutex
+	sets map[string]*Set
+}
+
+// NewMemoryStore creates an empty in-memory Store, the templates are rendered with the options
+func NewMemoryStore(opts *Options) *MemoryStore {
+	return &MemoryStore{
+		options: withDefaults(opts),
+		sets:    map[string]*Set{},
+	}
+}
+
+// Add parses the definition and adds it to the store, replacing the template with the same ID
+func (s *MemoryStore) Add(definition Definition) error {
+	set, err := NewSet(definition, s.options)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.sets[set.Id] = set
+	s.mu.Unlock()
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Set, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set, ok := s.sets[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, id)
+	}
+	return set, nil
+}
+
+// LoadFS loads the templates of a file system, e.g. an embed.FS. Every directory in the root
+// is a template, named after the directory, and every file in it is a variant, named after the
+// file without its extension. Translated variants have the locale before the extension:
+//
+//	motion/subject.txt
+//	motion/subject.nl.txt
+//	motion/html.html
+//	motion/html.nl.html
+//	motion/text.txt
+//	motion/slack.md
+//
+// Use fs.Sub to load the templates from a subdirectory of an embed.FS.
+func LoadFS(fsys fs.FS, opts *Options) (*MemoryStore, error) {
+	store := NewMemoryStore(opts)
+	dirs, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		files, err := fs.ReadDir(fsys, dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		definition := Definition{Id: dir.Name(), Variants: map[string]string{}}
+		for _, file := range files {
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			source, err := fs.ReadFile(fsys, path.Join(dir.Name(), file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			parts := strings.Split(file.Name(), ".")
+			if len(parts) < 3 {
+				definition.Variants[parts[0]] = string(source)
+				continue
+			}
+			if definition.Locales == nil {
+				definition.Locales = map[string]map[string]string{}
+			}
+			locale := parts[len(parts)-2]
+			if definition.Locales[locale] == nil {
+				definition.Locales[locale] = map[string]string{}
+			}
+			definition.Locales[locale][parts[0]] = string(source)
+		}
+		if err := store.Add(definition); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// LoadDir loads the templates of a directory, see LoadFS for the layout of the directory
+func LoadDir(dir string, opts *Options) (*MemoryStore, error) {
+	return LoadFS(os.DirFS(dir), opts)
+}
+
+// Collection is the MongoDB collection the templates are stored in by default
+const Collection = "templates"
+
+// MongoStore holds named templates in a MongoDB collection
+type MongoStore struct {
+	collection *mongo.Collection
+	options    *Options
+}
+
+// NewMongoStore creates a Store on the MongoDB collection, the templates are rendered with the options
+func NewMongoStore(collection *mongo.Collection, opts *Options) *MongoStore {
+	return &MongoStore{
+		collection: collection,
+		options:    withDefaults(opts),
+	}
+}
+
+// Get implements Store
+func (s *MongoStore) Get(ctx context.Context, id string) (*Set, error) {
+	var definition Definition
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&definition)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewSet(definition, s.options)
+}
+
+// Save stores the definition, replacing the template with the same ID. The definition
+// is parsed first, so an invalid template is never stored.
+func (s *MongoStore) Save(ctx context.Context, definition Definition) error {
+	if _, err := NewSet(definition, s.options); err != nil {
+		return err
+	}
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": definition.Id}, definition, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Delete removes the template with the ID
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
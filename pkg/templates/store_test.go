@@ -0,0 +1,126 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"motion/subject.txt":   {Data: []byte("{{devicename}} detected motion")},
+		"motion/html.html":     {Data: []byte("<p>{{devicename}}</p>")},
+		"motion/text.txt":      {Data: []byte("{{devicename}} detected {{classifications}}")},
+		"motion/slack.md":      {Data: []byte("*{{devicename}}* detected {{classifications}}")},
+		"motion/telegram.html": {Data: []byte("<b>{{devicename}}</b>")},
+		"motion/.DS_Store":     {Data: []byte("ignored")},
+		"offline/text.txt":     {Data: []byte("{{devicename}} is offline")},
+		"README.md":            {Data: []byte("not a template")},
+	}
+
+	store, err := LoadFS(fsys, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	set, err := store.Get(context.Background(), "motion")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{"html", "slack", "subject", "telegram", "text"}
+	if !reflect.DeepEqual(set.Variants(), expected) {
+		t.Errorf("expected variants %v got %v", expected, set.Variants())
+	}
+
+	message := models.Message{DeviceName: "<Front door>", Classifications: []string{"person"}}
+	tests := map[string]string{
+		VariantSubject:  "<Front door> detected motion",
+		VariantHTML:     "<p>&lt;Front door&gt;</p>",
+		VariantText:     "<Front door> detected person",
+		VariantSlack:    "*<Front door>* detected person",
+		VariantTelegram: "<b>&lt;Front door&gt;</b>",
+		VariantShort:    "<Front door> detected person",
+	}
+	for variant, expected := range tests {
+		rendered, err := set.Render(variant, message)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", variant, err)
+		}
+		if rendered != expected {
+			t.Errorf("%s: expected %q got %q", variant, expected, rendered)
+		}
+	}
+
+	offline, err := store.Get(context.Background(), "offline")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if offline.Lookup(VariantTelegram) == nil || offline.Lookup(VariantTelegram).IsHTML() {
+		t.Errorf("expected the telegram variant to fall back to the plain text variant")
+	}
+	if _, err := offline.Render(VariantHTML, message); !errors.Is(err, ErrVariantNotFound) {
+		t.Errorf("expected ErrVariantNotFound got %v", err)
+	}
+
+	if _, err := store.Get(context.Background(), "unknown"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound got %v", err)
+	}
+}
+
+func TestLoadFSInvalidTemplate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"motion/text.txt": {Data: []byte("{{if devicename}}")},
+	}
+	if _, err := LoadFS(fsys, nil); err == nil {
+		t.Errorf("expected an error for an invalid template")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "motion"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "motion", "text.txt"), []byte("{{upper devicename}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := LoadDir(dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	set, err := store.Get(context.Background(), "motion")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	rendered, _ := set.Render(VariantShort, models.Message{DeviceName: "garage"})
+	if rendered != "GARAGE" {
+		t.Errorf("expected GARAGE got %q", rendered)
+	}
+}
+
+func TestMemoryStoreAdd(t *testing.T) {
+	store := NewMemoryStore(NewOptions().SetDefault("devicename", "your camera").Build())
+	if err := store.Add(Definition{Variants: map[string]string{VariantText: "text"}}); err == nil {
+		t.Errorf("expected an error for a template without id")
+	}
+	if err := store.Add(Definition{Id: "motion", Variants: map[string]string{VariantText: "{{end}}"}}); err == nil {
+		t.Errorf("expected an error for an invalid template")
+	}
+
+	if err := store.Add(Definition{Id: "motion", Variants: map[string]string{VariantText: "{{devicename}}"}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	set, _ := store.Get(context.Background(), "motion")
+	rendered, _ := set.Render(VariantText, models.Message{})
+	if !strings.Contains(rendered, "your camera") {
+		t.Errorf("expected the default of the store got %q", rendered)
+	}
+}
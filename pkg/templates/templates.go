@@ -0,0 +1,518 @@
+// Package templates renders notification templates from a models.Message.
+//
+// Templates use the text/template syntax, and every variable of a message is available as
+// a function, so the placeholders of the existing email templates keep working:
+//
+//	Hi {{user}}, {{devicename}} detected {{classifications}} on {{date}} at {{time}}.
+//	{{if link}}<a href="{{link}}">Watch the recording</a>{{end}}
+//
+// Following variables are available:
+//   - {{user}}: user that triggered the message
+//   - {{title}}: title of the message
+//   - {{text}}: text of the message
+//   - {{link}}: link to the media (recording)
+//   - {{thumbnail}}: image (either a base64 or a url), an <img> tag in HTML templates
+//   - {{classifications}}: list of classifications detected in the recording
+//   - {{timezone}}: timezone of the account generating the event
+//   - {{date}}, {{time}}, {{datetime}}: date and time of the media
+//   - {{eventdate}}, {{eventtime}}, {{eventdatetime}}: date and time of the notification
+//   - {{devicename}}, {{deviceid}}: device generating the event
+//   - {{sites}}, {{groups}}: the sites and groups the device is part of
+//   - {{numberOfMedia}}: number of media attached to the message
+//   - {{dataUsage}}: data usage of the message
+//
+// Any other {{key}} is looked up in the Data of the message, or can be read with {{data "key"}}.
+// Missing values render as an empty string, unless a default is configured in the Options.
+//
+// Dates, times and numbers are formatted for the locale of the message (its "locale" Data key),
+// and {{t "key"}} renders the translation of a key from the Catalog of the Options.
+package templates
+
+import (
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"net/url"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+// Options holds the configuration used to render templates
+type Options struct {
+	// Defaults holds the value of a variable when it is missing from the message, e.g. "devicename": "your camera"
+	Defaults map[string]string
+	// Timezone is used for dates and times when the message has no timezone, defaults to UTC
+	Timezone string
+	// Locale is used when the message has no locale in its Data, defaults to DefaultLocale
+	Locale string
+	// Catalog holds the translations of {{t "key"}}
+	Catalog *Catalog
+	// DateFormat, TimeFormat and DateTimeFormat are the layouts of {{date}}, {{time}} and {{datetime}},
+	// they default to the layouts of the locale
+	DateFormat     string
+	TimeFormat     string
+	DateTimeFormat string
+	// ThumbnailWidth is the width of the <img> rendered by {{thumbnail}} in HTML templates
+	ThumbnailWidth string
+}
+
+// OptionsBuilder provides a fluent interface for building template options
+type OptionsBuilder struct {
+	options *Options
+}
+
+// NewOptions creates a new template options builder
+func NewOptions() *OptionsBuilder {
+	return &OptionsBuilder{
+		options: &Options{
+			Defaults:       map[string]string{},
+			ThumbnailWidth: "400px",
+		},
+	}
+}
+
+// SetDefault sets the value of a variable when it is missing from the message
+func (b *OptionsBuilder) SetDefault(variable string, value string) *OptionsBuilder {
+	b.options.Defaults[variable] = value
+	return b
+}
+
+// SetTimezone sets the timezone used when the message has no timezone
+func (b *OptionsBuilder) SetTimezone(timezone string) *OptionsBuilder {
+	b.options.Timezone = timezone
+	return b
+}
+
+// SetLocale sets the locale used when the message has no locale
+func (b *OptionsBuilder) SetLocale(locale string) *OptionsBuilder {
+	b.options.Locale = locale
+	return b
+}
+
+// SetCatalog sets the catalog holding the translations of the templates
+func (b *OptionsBuilder) SetCatalog(catalog *Catalog) *OptionsBuilder {
+	b.options.Catalog = catalog
+	return b
+}
+
+// SetDateFormat sets the layouts of {{date}}, {{time}} and {{datetime}}
+func (b *OptionsBuilder) SetDateFormat(date string, time string, datetime string) *OptionsBuilder {
+	b.options.DateFormat = date
+	b.options.TimeFormat = time
+	b.options.DateTimeFormat = datetime
+	return b
+}
+
+// SetThumbnailWidth sets the width of the image rendered by {{thumbnail}} in HTML templates
+func (b *OptionsBuilder) SetThumbnailWidth(width string) *OptionsBuilder {
+	b.options.ThumbnailWidth = width
+	return b
+}
+
+// Build returns the configured Options
+func (b *OptionsBuilder) Build() *Options {
+	return b.options
+}
+
+// Template is a parsed template which renders a message, either as text or as escaped HTML
+type Template struct {
+	name    string
+	source  string
+	variant string
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+	options *Options
+}
+
+// variables are the names of the variables of a message
+var variables = []string{
+	"user", "title", "text", "link", "thumbnail", "classifications", "timezone",
+	"date", "time", "datetime", "eventdate", "eventtime", "eventdatetime",
+	"devicename", "deviceid", "sites", "groups", "numberOfMedia", "dataUsage",
+}
+
+// keywords are the names which are reserved by text/template
+var keywords = map[string]bool{
+	"end": true, "else": true, "break": true, "continue": true, "nil": true, "true": true, "false": true,
+}
+
+// placeholder matches a {{key}} action
+var placeholder = regexp.MustCompile(`{{-?\s*([A-Za-z_][A-Za-z0-9_]*)\s*-?}}`)
+
+// New parses a plain text template. Options are optional, nil uses the defaults of NewOptions.
+func New(name string, text string, opts *Options) (*Template, error) {
+	t := &Template{name: name, source: text, options: withDefaults(opts)}
+	parsed, err := texttemplate.New(name).Funcs(t.funcs(models.Message{}, false)).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t.text = parsed
+	return t, nil
+}
+
+// NewHTML parses an HTML template, values of the message are escaped depending on their context
+func NewHTML(name string, text string, opts *Options) (*Template, error) {
+	t := &Template{name: name, source: text, options: withDefaults(opts)}
+	parsed, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(t.funcs(models.Message{}, true))).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t.html = parsed
+	return t, nil
+}
+
+// The payload formats of NewPayload
+const (
+	FormatJSON = "json"
+	FormatForm = "form"
+	FormatXML  = "xml"
+)
+
+// payloadEscaper is the function which escapes the output of every action of a payload template
+const payloadEscaper = "_payload_escape"
+
+// NewPayload parses a template of a JSON, form-encoded or XML payload. The output of every action is
+// escaped for the format, so values of the message can be used inside JSON strings, form values, and
+// XML text and attributes:
+//
+//	{"title": "{{title}}", "camera": "{{devicename}}"}
+//	title={{title}}&camera={{devicename}}
+//	<event camera="{{devicename}}">{{title}}</event>
+func NewPayload(name string, text string, format string, opts *Options) (*Template, error) {
+	var escape func(string) string
+	switch format {
+	case FormatJSON:
+		escape = escapeJSON
+	case FormatForm:
+		escape = url.QueryEscape
+	case FormatXML:
+		escape = escapeXML
+	default:
+		return nil, fmt.Errorf("unsupported payload format %q", format)
+	}
+
+	t := &Template{name: name, source: text, options: withDefaults(opts)}
+	funcs := t.funcs(models.Message{}, false)
+	funcs[payloadEscaper] = func(value any) string { return escape(fmt.Sprint(value)) }
+	parsed, err := texttemplate.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, tmpl := range parsed.Templates() {
+		if tmpl.Tree != nil {
+			escapeActions(tmpl.Tree.Root)
+		}
+	}
+	t.text = parsed
+	return t, nil
+}
+
+// escapeActions pipes the output of every action in the node through the payload escaper,
+// the way html/template adds its escapers
+func escapeActions(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, n := range node.Nodes {
+			escapeActions(n)
+		}
+	case *parse.ActionNode:
+		// Assignments, e.g. {{$name := devicename}}, have no output
+		if len(node.Pipe.Decl) == 0 {
+			escaper := parse.NewIdentifier(payloadEscaper).SetTree(nil).SetPos(node.Pos)
+			node.Pipe.Cmds = append(node.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: node.Pos, Args: []parse.Node{escaper}})
+		}
+	case *parse.IfNode:
+		escapeActions(node.List)
+		escapeActions(node.ElseList)
+	case *parse.RangeNode:
+		escapeActions(node.List)
+		escapeActions(node.ElseList)
+	case *parse.WithNode:
+		escapeActions(node.List)
+		escapeActions(node.ElseList)
+	}
+}
+
+// escapeJSON escapes the value for use inside a JSON string
+func escapeJSON(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded[1 : len(encoded)-1])
+}
+
+// escapeXML escapes the value for use in XML text and attribute values
+func escapeXML(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+// Must panics when the template can't be parsed, it is meant for templates which are part of the program
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Name returns the name of the template
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Variant returns the variant of a named template the template was parsed from, e.g. "slack",
+// it is empty for a template which is not part of a Set
+func (t *Template) Variant() string {
+	return t.variant
+}
+
+// IsHTML reports whether the template renders escaped HTML
+func (t *Template) IsHTML() bool {
+	return t.html != nil
+}
+
+// Render renders the template for the message
+func (t *Template) Render(message models.Message) (string, error) {
+	var out strings.Builder
+	if t.html != nil {
+		// The parsed template is never executed, so it can be cloned to bind the message
+		clone, err := t.html.Clone()
+		if err != nil {
+			return "", err
+		}
+		if err := clone.Funcs(htmltemplate.FuncMap(t.funcs(message, true))).Execute(&out, message); err != nil {
+			return "", err
+		}
+		return out.String(), nil
+	}
+
+	clone, err := t.text.Clone()
+	if err != nil {
+		return "", err
+	}
+	if err := clone.Funcs(t.funcs(message, false)).Execute(&out, message); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// Render parses and renders a plain text template in one go
+func Render(text string, message models.Message, opts *Options) (string, error) {
+	t, err := New("message", text, opts)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(message)
+}
+
+// funcs returns the functions of the template, bound to the message. The {{key}} placeholders
+// in the source of the template which aren't variables are looked up in the Data of the message.
+func (t *Template) funcs(message models.Message, isHTML bool) texttemplate.FuncMap {
+	values := Values(message, t.options)
+	value := func(name string) string {
+		if v := values[name]; v != "" {
+			return v
+		}
+		return t.options.Defaults[name]
+	}
+
+	funcs := texttemplate.FuncMap{}
+	for _, match := range placeholder.FindAllStringSubmatch(t.source, -1) {
+		name := match[1]
+		if keywords[name] {
+			continue
+		}
+		funcs[name] = func() string {
+			if v := message.Data[name]; v != "" {
+				return v
+			}
+			return t.options.Defaults[name]
+		}
+	}
+	for _, name := range variables {
+		funcs[name] = func() string { return value(name) }
+	}
+	if isHTML {
+		funcs["thumbnail"] = func() htmltemplate.HTML { return t.thumbnailHTML(message) }
+	}
+
+	funcs["data"] = func(key string) string {
+		if v := message.Data[key]; v != "" {
+			return v
+		}
+		return t.options.Defaults[key]
+	}
+	funcs["default"] = func(fallback string, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+	funcs["join"] = func(separator string, values []string) string { return strings.Join(values, separator) }
+	funcs["upper"] = strings.ToUpper
+	funcs["lower"] = strings.ToLower
+	funcs["thumbnailUrl"] = func() string { return ThumbnailUrl(message) }
+	funcs["mediaTimestamp"] = func() time.Time { return mediaTime(message, t.options) }
+	funcs["eventTimestamp"] = func() time.Time { return eventTime(message, t.options) }
+	locale := MessageLocale(message, t.options)
+	funcs["locale"] = func() string { return locale }
+	funcs["formatTime"] = func(layout string, value time.Time) string {
+		if value.IsZero() {
+			return ""
+		}
+		return LookupLocale(locale).FormatTime(value, layout)
+	}
+	funcs["number"] = func(decimals int, value float64) string {
+		return LookupLocale(locale).FormatNumber(value, decimals)
+	}
+	funcs["t"] = func(key string, args ...any) string {
+		if t.options.Catalog == nil {
+			return key
+		}
+		return t.options.Catalog.Translate(locale, key, args...)
+	}
+	return funcs
+}
+
+// thumbnailHTML returns an <img> tag for the thumbnail of the message
+func (t *Template) thumbnailHTML(message models.Message) htmltemplate.HTML {
+	src := ThumbnailUrl(message)
+	if message.Thumbnail != "" {
+		src = message.Thumbnail
+		if !strings.HasPrefix(src, "data:") && !strings.HasPrefix(src, "http") {
+			src = "data:image/jpeg;base64," + src
+		}
+	}
+	if src == "" {
+		return ""
+	}
+	return htmltemplate.HTML(fmt.Sprintf(`<img src="%s" width="%s" height="auto" />`,
+		html.EscapeString(src), html.EscapeString(t.options.ThumbnailWidth)))
+}
+
+// Values returns the variables of the message by name, as rendered in a text template.
+// Missing values are empty.
+func Values(message models.Message, opts *Options) map[string]string {
+	opts = withDefaults(opts)
+	values := map[string]string{
+		"title":      message.Title,
+		"text":       message.Body,
+		"timezone":   message.Timezone,
+		"devicename": message.DeviceName,
+		"deviceid":   message.DeviceId,
+	}
+
+	values["user"] = message.User
+	if values["user"] == "" {
+		values["user"] = message.Data["user"]
+	}
+
+	values["link"] = VideoUrl(message)
+	if values["link"] == "" {
+		values["link"] = message.Data["link"]
+	}
+
+	values["thumbnail"] = ThumbnailUrl(message)
+	if values["thumbnail"] == "" {
+		values["thumbnail"] = message.Thumbnail
+	}
+
+	values["classifications"] = strings.Join(message.Classifications, ", ")
+
+	// Dates, times and numbers are formatted for the locale of the message
+	locale := LookupLocale(MessageLocale(message, opts))
+	values["numberOfMedia"] = locale.formatValue(message.NumberOfMedia)
+	values["dataUsage"] = locale.formatValue(message.DataUsage)
+
+	dateFormat := cmp.Or(opts.DateFormat, locale.DateFormat)
+	timeFormat := cmp.Or(opts.TimeFormat, locale.TimeFormat)
+	dateTimeFormat := cmp.Or(opts.DateTimeFormat, locale.DateTimeFormat)
+	if t := mediaTime(message, opts); !t.IsZero() {
+		values["date"] = locale.FormatTime(t, dateFormat)
+		values["time"] = locale.FormatTime(t, timeFormat)
+		values["datetime"] = locale.FormatTime(t, dateTimeFormat)
+	}
+	if t := eventTime(message, opts); !t.IsZero() {
+		values["eventdate"] = locale.FormatTime(t, dateFormat)
+		values["eventtime"] = locale.FormatTime(t, timeFormat)
+		values["eventdatetime"] = locale.FormatTime(t, dateTimeFormat)
+	}
+
+	sites := []string{}
+	for _, site := range message.Sites {
+		sites = append(sites, site.Name)
+	}
+	values["sites"] = strings.Join(sites, ", ")
+
+	groups := []string{}
+	for _, group := range message.Groups {
+		groups = append(groups, group.Name)
+	}
+	values["groups"] = strings.Join(groups, ", ")
+
+	return values
+}
+
+// mediaTime returns the start of the first media in the timezone of the message
+func mediaTime(message models.Message, opts *Options) time.Time {
+	if len(message.Media) == 0 || message.Media[0].StartTimestamp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(message.Media[0].StartTimestamp, 0).In(location(message, opts))
+}
+
+// eventTime returns the time of the notification in the timezone of the message
+func eventTime(message models.Message, opts *Options) time.Time {
+	if message.Timestamp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(message.Timestamp, 0).In(location(message, opts))
+}
+
+// location returns the timezone of the message, or the default timezone when
+// the message has no (valid) timezone
+func location(message models.Message, opts *Options) *time.Location {
+	for _, timezone := range []string{message.Timezone, opts.Timezone} {
+		if timezone == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// VideoUrl returns the video url of the first media attached to the message
+func VideoUrl(message models.Message) string {
+	if len(message.Media) > 0 && message.Media[0].AtRuntimeMetadata != nil {
+		return message.Media[0].AtRuntimeMetadata.VideoUrl
+	}
+	return ""
+}
+
+// ThumbnailUrl returns the thumbnail url of the first media attached to the message
+func ThumbnailUrl(message models.Message) string {
+	if len(message.Media) > 0 && message.Media[0].AtRuntimeMetadata != nil {
+		return message.Media[0].AtRuntimeMetadata.ThumbnailUrl
+	}
+	return ""
+}
+
+// withDefaults returns the options, or the default options when nil
+func withDefaults(opts *Options) *Options {
+	if opts == nil {
+		return NewOptions().Build()
+	}
+	return opts
+}
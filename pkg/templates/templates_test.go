@@ -0,0 +1,212 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uug-ai/models/pkg/models"
+)
+
+func testMessage() models.Message {
+	return models.Message{
+		Title:           "Motion detected",
+		Body:            "Something moved",
+		User:            "cedric",
+		Timezone:        "Europe/Brussels",
+		Timestamp:       1700000060,
+		DeviceId:        "camera-1",
+		DeviceName:      "Front door",
+		Classifications: []string{"person", "car"},
+		Sites:           []models.Site{{Name: "Home"}, {Name: "Office"}},
+		Groups:          []models.Group{{Name: "Outdoor"}},
+		NumberOfMedia:   "2",
+		DataUsage:       "12 MB",
+		Media: []models.Media{{
+			StartTimestamp: 1700000000,
+			AtRuntimeMetadata: &models.MediaAtRuntimeMetadata{
+				VideoUrl:     "https://example.com/video.mp4?a=1&b=2",
+				ThumbnailUrl: "https://example.com/thumbnail.jpg",
+			},
+		}},
+		Data: map[string]string{"tab1_title": "Overview", "plan": "pro"},
+	}
+}
+
+func TestRenderVariables(t *testing.T) {
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"{{user}}", "cedric"},
+		{"{{title}}: {{text}}", "Motion detected: Something moved"},
+		{"{{link}}", "https://example.com/video.mp4?a=1&b=2"},
+		{"{{thumbnail}}", "https://example.com/thumbnail.jpg"},
+		{"{{classifications}}", "person, car"},
+		{"{{timezone}}", "Europe/Brussels"},
+		{"{{date}} {{time}}", "2023-11-14 23:13:20"},
+		{"{{datetime}}", "2023-11-14 23:13:20"},
+		{"{{eventdate}} {{eventtime}}", "2023-11-14 23:14:20"},
+		{"{{eventdatetime}}", "2023-11-14 23:14:20"},
+		{"{{devicename}} ({{deviceid}})", "Front door (camera-1)"},
+		{"{{sites}} / {{groups}}", "Home, Office / Outdoor"},
+		{"{{numberOfMedia}} media, {{dataUsage}}", "2 media, 12 MB"},
+		{"{{tab1_title}} {{plan}} {{data \"plan\"}}", "Overview pro pro"},
+		{"[{{tab2_title}}]", "[]"},
+		{"{{if link}}watch{{end}}{{- if not thumbnailUrl}}none{{else}} it{{end}}", "watch it"},
+		{"{{join \" | \" .Classifications}}", "person | car"},
+		{"{{formatTime \"Jan 2, 15:04\" mediaTimestamp}}", "Nov 14, 23:13"},
+		{"{{upper devicename}}", "FRONT DOOR"},
+	}
+
+	for _, test := range tests {
+		rendered, err := Render(test.template, testMessage(), nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", test.template, err)
+		}
+		if rendered != test.expected {
+			t.Errorf("%s: expected %q got %q", test.template, test.expected, rendered)
+		}
+	}
+}
+
+func TestRenderDefaults(t *testing.T) {
+	opts := NewOptions().
+		SetDefault("devicename", "your camera").
+		SetDefault("plan", "free").
+		SetTimezone("America/New_York").
+		Build()
+
+	message := models.Message{Timestamp: 1700000000}
+	rendered, err := Render("{{devicename}} {{plan}} {{eventdatetime}} [{{user}}] {{default \"nobody\" user}}", message, opts)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := "your camera free 2023-11-14 17:13:20 [] nobody"
+	if rendered != expected {
+		t.Errorf("expected %q got %q", expected, rendered)
+	}
+
+	// An unknown timezone falls back to the default timezone
+	message.Timezone = "Nowhere/Unknown"
+	rendered, _ = Render("{{eventtime}}", message, opts)
+	if rendered != "17:13:20" {
+		t.Errorf("expected the default timezone got %q", rendered)
+	}
+
+	// Without timezones dates are rendered in UTC, and missing dates are empty
+	rendered, _ = Render("{{eventtime}}|{{date}}", message, nil)
+	if rendered != "22:13:20|" {
+		t.Errorf("expected UTC and an empty date got %q", rendered)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	message := testMessage()
+	message.DeviceName = "<script>alert(1)</script>"
+
+	tmpl := Must(NewHTML("email", `<p>{{devicename}}</p><a href="{{link}}">{{text}}</a>{{thumbnail}}`, nil))
+	if !tmpl.IsHTML() {
+		t.Errorf("expected an HTML template")
+	}
+	rendered, err := tmpl.Render(message)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if strings.Contains(rendered, "<script>") {
+		t.Errorf("expected the device name to be escaped got %s", rendered)
+	}
+	if !strings.Contains(rendered, "&lt;script&gt;") {
+		t.Errorf("expected the escaped device name got %s", rendered)
+	}
+	if !strings.Contains(rendered, `href="https://example.com/video.mp4?a=1&amp;b=2"`) {
+		t.Errorf("expected the link in the href got %s", rendered)
+	}
+	if !strings.Contains(rendered, `<img src="https://example.com/thumbnail.jpg" width="400px" height="auto" />`) {
+		t.Errorf("expected the thumbnail image got %s", rendered)
+	}
+
+	message.Thumbnail = "aGVsbG8="
+	rendered, _ = tmpl.Render(message)
+	if !strings.Contains(rendered, `<img src="data:image/jpeg;base64,aGVsbG8="`) {
+		t.Errorf("expected the base64 thumbnail got %s", rendered)
+	}
+
+	message.Thumbnail = ""
+	message.Media = nil
+	rendered, _ = tmpl.Render(message)
+	if strings.Contains(rendered, "<img") {
+		t.Errorf("expected no image without thumbnail got %s", rendered)
+	}
+}
+
+func TestRenderPayload(t *testing.T) {
+	message := testMessage()
+	message.DeviceName = `Front "door" & <garden>`
+
+	tests := []struct {
+		name     string
+		format   string
+		text     string
+		expected string
+	}{
+		{
+			name:     "JSON",
+			format:   FormatJSON,
+			text:     `{"camera": "{{devicename}}", "sites": "{{sites}}"{{if link}}, "link": "{{link}}"{{end}}}`,
+			expected: `{"camera": "Front \"door\" \u0026 \u003cgarden\u003e", "sites": "Home, Office", "link": "https://example.com/video.mp4?a=1\u0026b=2"}`,
+		},
+		{
+			name:     "Form",
+			format:   FormatForm,
+			text:     `camera={{devicename}}&plan={{data "plan"}}`,
+			expected: `camera=Front+%22door%22+%26+%3Cgarden%3E&plan=pro`,
+		},
+		{
+			name:     "XML",
+			format:   FormatXML,
+			text:     `{{$camera := devicename}}<event camera="{{$camera}}">{{title | upper}}</event>`,
+			expected: `<event camera="Front &#34;door&#34; &amp; &lt;garden&gt;">MOTION DETECTED</event>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := Must(NewPayload("payload", tt.text, tt.format, nil)).Render(message)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if rendered != tt.expected {
+				t.Errorf("expected %s got %s", tt.expected, rendered)
+			}
+		})
+	}
+
+	if _, err := NewPayload("payload", "{{title}}", "yaml", nil); err == nil {
+		t.Errorf("expected an error for an unsupported format")
+	}
+}
+
+func TestTemplateConcurrentRender(t *testing.T) {
+	tmpl := Must(New("title", "{{devicename}}", nil))
+	done := make(chan string, 2)
+	for _, name := range []string{"first", "second"} {
+		go func() {
+			message := testMessage()
+			message.DeviceName = name
+			rendered, _ := tmpl.Render(message)
+			done <- rendered
+		}()
+	}
+	results := map[string]bool{<-done: true, <-done: true}
+	if !results["first"] || !results["second"] {
+		t.Errorf("expected every render to use its own message got %v", results)
+	}
+}
+
+func TestNewInvalidTemplate(t *testing.T) {
+	if _, err := New("broken", "{{if user}}", nil); err == nil {
+		t.Errorf("expected an error for an unterminated template")
+	}
+	if _, err := NewHTML("broken", "{{", nil); err == nil {
+		t.Errorf("expected an error for an invalid template")
+	}
+}